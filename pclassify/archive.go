@@ -0,0 +1,350 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"photoutils/pclassify/pclassifylib"
+	"photoutils/pcopy/pcopylib"
+)
+
+// isArchive reports whether file is an archive sourcePath may be, classified
+// entry by entry.
+func isArchive(file string) bool {
+	extName := strings.ToLower(filepath.Ext(file))
+	return extName == ".zip" || extName == ".tar"
+}
+
+// archiveEntry is a regular file of an archive sourcePath, read in place
+// until staged on disk to be classified.
+type archiveEntry struct {
+	name    string
+	size    int64
+	modTime time.Time
+	open    func() (io.ReadCloser, error)
+
+	once sync.Once
+	err  error
+}
+
+// entryInfo describes an archive entry to walkFn like a file found on disk.
+type entryInfo struct {
+	entry *archiveEntry
+}
+
+func (fi entryInfo) Name() string       { return path.Base(fi.entry.name) }
+func (fi entryInfo) Size() int64        { return fi.entry.size }
+func (fi entryInfo) Mode() os.FileMode  { return 0644 }
+func (fi entryInfo) ModTime() time.Time { return fi.entry.modTime }
+func (fi entryInfo) IsDir() bool        { return false }
+func (fi entryInfo) Sys() interface{}   { return nil }
+
+// readArchive lists the regular files of the zip or tar archive at file, in
+// archive order. The archive is read from until closed.
+func readArchive(file string) ([]*archiveEntry, io.Closer, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var entries []*archiveEntry
+	if strings.ToLower(filepath.Ext(file)) == ".zip" {
+		entries, err = readZip(f)
+	} else {
+		entries, err = readTar(f)
+	}
+	if err != nil {
+		f.Close()
+		return nil, nil, err
+	}
+
+	return entries, f, nil
+}
+
+// sectionOpener reads size bytes of f from offset, where an entry is stored
+// as is.
+func sectionOpener(f io.ReaderAt, offset, size int64) func() (io.ReadCloser, error) {
+	return func() (io.ReadCloser, error) {
+		return ioutil.NopCloser(io.NewSectionReader(f, offset, size)), nil
+	}
+}
+
+func readZip(f *os.File) ([]*archiveEntry, error) {
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	archive, err := zip.NewReader(f, fi.Size())
+	if err != nil {
+		return nil, err
+	}
+
+	entries := []*archiveEntry{}
+	for _, zf := range archive.File {
+		if !zf.FileInfo().Mode().IsRegular() {
+			continue
+		}
+
+		// Stored entries are read in place, compressed ones inflated as read.
+		entry := &archiveEntry{name: zf.Name, size: int64(zf.UncompressedSize64), modTime: zf.Modified, open: zf.Open}
+		if zf.Method == zip.Store {
+			offset, err := zf.DataOffset()
+			if err != nil {
+				return nil, err
+			}
+			entry.open = sectionOpener(f, offset, entry.size)
+		}
+		entries = append(entries, entry)
+	}
+
+	return entries, nil
+}
+
+// offsetReader tracks the offset a tar reader has reached in its file, where
+// the data of the current entry starts.
+type offsetReader struct {
+	f      *os.File
+	offset int64
+}
+
+func (r *offsetReader) Read(p []byte) (int, error) {
+	n, err := r.f.Read(p)
+	r.offset += int64(n)
+	return n, err
+}
+
+func (r *offsetReader) Seek(offset int64, whence int) (int64, error) {
+	pos, err := r.f.Seek(offset, whence)
+	if err == nil {
+		r.offset = pos
+	}
+	return pos, err
+}
+
+func readTar(f *os.File) ([]*archiveEntry, error) {
+	r := &offsetReader{f: f}
+	archive := tar.NewReader(r)
+	entries := []*archiveEntry{}
+	for {
+		header, err := archive.Next()
+		if err == io.EOF {
+			return entries, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+
+		// Entries are stored as is, read straight from the archive file.
+		entries = append(entries, &archiveEntry{
+			name:    header.Name,
+			size:    header.Size,
+			modTime: header.ModTime,
+			open:    sectionOpener(f, r.offset, header.Size),
+		})
+	}
+}
+
+// stagedPath returns where the archive entry name is staged under dir, false
+// for names reaching out of dir.
+func stagedPath(dir, name string) (string, bool) {
+	name = path.Clean("/" + strings.Replace(name, `\`, "/", -1))[1:]
+	if len(name) == 0 {
+		return "", false
+	}
+
+	return filepath.Join(dir, filepath.FromSlash(name)), true
+}
+
+// stage writes the entry to staged, dated as in the archive, the first time
+// it is called.
+func (entry *archiveEntry) stage(staged string) error {
+	entry.once.Do(func() {
+		entry.err = writeEntry(entry, staged)
+	})
+	return entry.err
+}
+
+func writeEntry(entry *archiveEntry, staged string) error {
+	if err := os.MkdirAll(filepath.Dir(staged), 0755); err != nil {
+		return err
+	}
+
+	r, err := entry.open()
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	w, err := os.Create(staged)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(w, r); err != nil {
+		w.Close()
+		os.Remove(staged)
+		return err
+	}
+	if err := w.Close(); err != nil {
+		os.Remove(staged)
+		return err
+	}
+
+	os.Chtimes(staged, entry.modTime, entry.modTime)
+	return nil
+}
+
+// archiveEntries are the entries of an archive sourcePath by the path they
+// are staged at, guarded by archiveMutex.
+var (
+	archiveEntries = map[string]*archiveEntry{}
+	archiveMutex   sync.Mutex
+)
+
+func lookupArchiveEntry(file string) *archiveEntry {
+	archiveMutex.Lock()
+	defer archiveMutex.Unlock()
+
+	return archiveEntries[file]
+}
+
+// isArchiveEntry reports whether file is where an archive entry is staged,
+// whether written yet or not.
+func isArchiveEntry(file string) bool {
+	return lookupArchiveEntry(file) != nil
+}
+
+// stageArchiveFile writes the archive entry of file where it is staged,
+// along with its camera companions, to be classified.
+func stageArchiveFile(file string) error {
+	for _, name := range append([]string{file}, findSidecars(file)...) {
+		if entry := lookupArchiveEntry(name); entry != nil {
+			if err := entry.stage(name); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// getArchiveRating reads the rating of the archive entry of file in place,
+// from the entry itself then an XMP sidecar entry.
+func getArchiveRating(file string) (int, bool) {
+	for _, name := range append([]string{file}, pclassifylib.XmpSidecars(file)...) {
+		entry := lookupArchiveEntry(name)
+		if entry == nil {
+			continue
+		}
+
+		r, err := entry.open()
+		if err != nil {
+			continue
+		}
+		rating, ok := pclassifylib.GetRatingFrom(r)
+		r.Close()
+		if ok {
+			return rating, true
+		}
+	}
+
+	return 0, false
+}
+
+// checkArchiveSource tells the options an archive sourcePath can not be
+// classified with.
+func checkArchiveSource() error {
+	if target == source {
+		return errors.New("pclassify: error: argument destPath: required with an archive sourcePath")
+	}
+
+	conflicts := []struct {
+		set  bool
+		name string
+	}{
+		{planMode, "-plan"},
+		{countOnly, "-count-only"},
+		{extStatsMode, "-ext-stats"},
+		{dupScanMode, "-dup-scan"},
+		{dedupSource, "-dedup-source"},
+		{renameMode, "-rename"},
+		{parallelMode, "-parallel-walk"},
+		{maxPerFolder > 0, "-max-per-folder"},
+		{len(stateFile) != 0, "-state"},
+	}
+	for _, c := range conflicts {
+		if c.set {
+			return errors.New(fmt.Sprintf("pclassify: error: argument %s: not allowed with an archive sourcePath", c.name))
+		}
+	}
+
+	return nil
+}
+
+// walkArchiveSource hands the entries of archive to walkFn as if found in a
+// source folder, at the path of a temporary folder they are staged at once
+// queued for classification. The cleanup returned closes the archive and
+// removes the folder, once the files queued are all classified.
+func walkArchiveSource(archive string, walkFn filepath.WalkFunc) func() {
+	entries, closer, err := readArchive(archive)
+	if err != nil {
+		pcopylib.OutputNote("pclassify: warning: %s: malformed archive, %s\n", archive, err)
+		return func() {}
+	}
+
+	stageDir, err := ioutil.TempDir("", "pclassify-")
+	if err != nil {
+		closer.Close()
+		pcopylib.OutputNote("pclassify: error: %s: can not stage archive entries, %s\n", archive, err)
+		return func() {}
+	}
+	cleanup := func() {
+		closer.Close()
+		os.RemoveAll(stageDir)
+	}
+
+	// All are known before the walk, so companions are found whatever their
+	// order in the archive.
+	root := filepath.Join(stageDir, filepath.Base(archive))
+	staged := make([]string, len(entries))
+	archiveMutex.Lock()
+	for i, entry := range entries {
+		if name, ok := stagedPath(root, entry.name); ok {
+			staged[i] = name
+			archiveEntries[name] = entry
+		}
+	}
+	archiveMutex.Unlock()
+
+	for i, entry := range entries {
+		if len(staged[i]) == 0 {
+			pcopylib.OutputNote("pclassify: warning: %s: %s: read failed, skipped\n", archive, entry.name)
+			continue
+		}
+
+		if !recursiveMode && strings.Contains(strings.Trim(entry.name, "/"), "/") {
+			continue
+		}
+
+		if err := walkFn(staged[i], entryInfo{entry}, nil); err != nil {
+			break
+		}
+	}
+
+	return cleanup
+}
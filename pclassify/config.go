@@ -0,0 +1,124 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// defaultConfigPath returns where the config file is read from when -config
+// is not given, photoutils/config under the user config directory, like
+// ~/.config/photoutils/config.
+func defaultConfigPath() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+
+	return filepath.Join(dir, "photoutils", "config")
+}
+
+// readConfig reads a config file of "key = value" lines, where lines starting
+// with # are comments and values may be quoted.
+func readConfig(path string) (map[string]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	config := map[string]string{}
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if len(text) == 0 || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		fields := strings.SplitN(text, "=", 2)
+		if len(fields) != 2 {
+			return nil, errors.New(fmt.Sprintf("line %d: expected key = value", line))
+		}
+
+		value := strings.TrimSpace(fields[1])
+		if len(value) >= 2 && value[0] == '"' && value[len(value)-1] == '"' {
+			value = value[1 : len(value)-1]
+		}
+		config[strings.TrimSpace(fields[0])] = value
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return config, nil
+}
+
+// profileKeys are the settings a profile, written as profiles.name.key, may
+// hold.
+var profileKeys = []string{"birthday", "photo_format", "video_format"}
+
+// parseBirthday parses a birthday written like 2011-03-16.
+func parseBirthday(value string) (time.Time, error) {
+	return time.Parse("2006-01-02", value)
+}
+
+// checkBirthdayFormat reports whether format names a birthday folder from
+// the two integers of the years and months of age.
+func checkBirthdayFormat(format string) bool {
+	return len(format) != 0 && !strings.Contains(fmt.Sprintf(format, 1, 2), "%!")
+}
+
+// applyProfile sets the birthday and birthday folder formats from the profile
+// called name in config.
+func applyProfile(config map[string]string, name string) error {
+	prefix := "profiles." + name + "."
+
+	found := false
+	for key := range config {
+		if !strings.HasPrefix(key, prefix) {
+			continue
+		}
+		found = true
+
+		known := false
+		for _, profileKey := range profileKeys {
+			known = known || key == prefix+profileKey
+		}
+		if !known {
+			return errors.New(fmt.Sprintf("%s: unknown setting (choose from %s)", key, strings.Join(profileKeys, ", ")))
+		}
+	}
+
+	if !found {
+		return errors.New(fmt.Sprintf("no profile %s", name))
+	}
+
+	if value, ok := config[prefix+"birthday"]; ok {
+		date, err := parseBirthday(value)
+		if err != nil {
+			return errors.New(fmt.Sprintf("%sbirthday: invalid date %s, expected like 2011-03-16", prefix, value))
+		}
+		birthday = date
+	}
+
+	if value, ok := config[prefix+"photo_format"]; ok {
+		if !checkBirthdayFormat(value) {
+			return errors.New(fmt.Sprintf("%sphoto_format: invalid format %s, expected two %%d for years and months", prefix, value))
+		}
+		birthdayPhotoFormat = value
+	}
+
+	if value, ok := config[prefix+"video_format"]; ok {
+		if !checkBirthdayFormat(value) {
+			return errors.New(fmt.Sprintf("%svideo_format: invalid format %s, expected two %%d for years and months", prefix, value))
+		}
+		birthdayVideoFormat = value
+	}
+
+	return nil
+}
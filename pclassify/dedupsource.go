@@ -0,0 +1,57 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"photoutils/pcopy/pcopylib"
+	"strings"
+)
+
+// findSourceDups hashes the files the walk would classify and returns those
+// whose content an earlier one in walk order already has, mapped to it, so
+// only one of each content is classified.
+func findSourceDups(source, target string) map[string]string {
+	targetInfo, _ := os.Stat(target)
+	index := newDupIndex()
+	dups := map[string]string{}
+
+	filepath.Walk(source, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return nil
+		}
+
+		if info.IsDir() {
+			if path == source {
+				return nil
+			}
+			if !recursiveMode || (targetInfo != nil && os.SameFile(info, targetInfo)) {
+				return filepath.SkipDir
+			}
+			if skipSorted && (isClassifiedFolder(info.Name(), classifyMode) || strings.EqualFold(info.Name(), otherDir) || strings.EqualFold(info.Name(), screenshotsDir)) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		if !info.Mode().IsRegular() || info.Name() == pcopylib.LockFileName || isSidecarFile(path) {
+			return nil
+		}
+		if !isMediaFile(path) && !isScreenshotFile(path) && (len(otherDir) == 0 || isHiddenFile(path)) {
+			return nil
+		}
+
+		if original := index.find(path, info); len(original) != 0 {
+			dups[path] = original
+			return nil
+		}
+		index.add(path, info.Size())
+
+		return nil
+	})
+
+	if len(dups) != 0 {
+		fmt.Printf("pclassify: %d file(s) repeated in source, only one of each classified\n", len(dups))
+	}
+	return dups
+}
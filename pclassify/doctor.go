@@ -0,0 +1,48 @@
+package main
+
+import (
+	"fmt"
+	"photoutils/pclassify/pclassifylib"
+	"photoutils/pcopy/pcopylib"
+)
+
+var classifyModeOptions = []struct {
+	opt  string
+	mode typeClassifyMode
+}{
+	{"-m", monthMode},
+	{"-y", yearMode},
+	{"-b", birthdayMode},
+	{"-d", dateMode},
+	{"-w", weekMode},
+	{"-season", seasonMode},
+	{"-weekday", weekdayMode},
+	{"-orientation", orientationMode},
+	{"-software", softwareMode},
+	{"-focal", focalMode},
+	{"-megapixels", megapixelMode},
+}
+
+// runDoctor prints how file would be dated, classified and hashed, without
+// modifying anything.
+func runDoctor(file string) {
+	fmt.Printf("%-21s%s\n", "file:", file)
+
+	date, dateSource, err := pclassifylib.ResolveCaptureTime(file)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	fmt.Printf("%-21s%s (from %s)\n", "capture time:", date.Format("2006-01-02 15:04:05 MST"), dateSource)
+
+	for _, option := range classifyModeOptions {
+		folderName, err := getFolderName(file, date, option.mode)
+		if err != nil {
+			folderName = fmt.Sprint(err)
+		}
+		fmt.Printf("%-21s%s\n", "folder "+option.opt+":", folderName)
+	}
+
+	fmt.Printf("%-21s%s\n", "partial hash:", pcopylib.PartialHash(file))
+	fmt.Printf("%-21s%s\n", "full hash:", pcopylib.FullHash(file))
+}
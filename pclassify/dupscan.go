@@ -0,0 +1,134 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"photoutils/pcopy/pcopylib"
+)
+
+// contentHash returns the hash files of the same size are compared by, as
+// when classifying: the full hash in full hash mode or for small files, and
+// that of sampled blocks otherwise.
+func contentHash(file string, size int64) string {
+	if fullHashMode || size <= pcopylib.FullHashBelow {
+		return pcopylib.FullHash(file)
+	}
+
+	return pcopylib.PartialHash(file)
+}
+
+// dupIndex indexes files by size, hashing those of a size only once a file
+// of that size is looked up.
+type dupIndex struct {
+	bySize map[int64][]string
+	hashes map[int64]map[string][]string
+}
+
+func newDupIndex() *dupIndex {
+	return &dupIndex{bySize: map[int64][]string{}, hashes: map[int64]map[string][]string{}}
+}
+
+func (d *dupIndex) add(file string, size int64) {
+	d.bySize[size] = append(d.bySize[size], file)
+	if hashes, ok := d.hashes[size]; ok {
+		hash := contentHash(file, size)
+		hashes[hash] = append(hashes[hash], file)
+	}
+}
+
+// find returns a file of the index with the content of file other than file
+// itself, "" when none.
+func (d *dupIndex) find(file string, info os.FileInfo) string {
+	size := info.Size()
+	if len(d.bySize[size]) == 0 {
+		return ""
+	}
+
+	hashes, ok := d.hashes[size]
+	if !ok {
+		hashes = map[string][]string{}
+		for _, indexed := range d.bySize[size] {
+			hash := contentHash(indexed, size)
+			hashes[hash] = append(hashes[hash], indexed)
+		}
+		d.hashes[size] = hashes
+	}
+
+	hash := contentHash(file, size)
+	if len(hash) == 0 {
+		return ""
+	}
+
+	for _, found := range hashes[hash] {
+		if fi, err := os.Stat(found); err != nil || !os.SameFile(fi, info) {
+			return found
+		}
+	}
+	return ""
+}
+
+// runDupScan prints how many source files are already somewhere under target,
+// by content, and how much classifying the others would add, without
+// classifying anything.
+func runDupScan(source, target string) {
+	index := newDupIndex()
+	filepath.Walk(target, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			fmt.Printf("pclassify: warning: %s: read failed, skipped\n", path)
+			return nil
+		}
+
+		if info.Mode().IsRegular() && info.Name() != pcopylib.LockFileName {
+			index.add(path, info.Size())
+		}
+		return nil
+	})
+
+	targetInfo, _ := os.Stat(target)
+	sourceIndex := newDupIndex()
+	files, inTarget, inSource, added := 0, 0, 0, 0
+	inTargetBytes, addedBytes := int64(0), int64(0)
+
+	filepath.Walk(source, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			fmt.Printf("pclassify: warning: %s: read failed, skipped\n", path)
+			return nil
+		}
+
+		if info.IsDir() {
+			if path == source {
+				return nil
+			}
+			if !recursiveMode || (targetInfo != nil && os.SameFile(info, targetInfo)) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		if !info.Mode().IsRegular() || info.Name() == pcopylib.LockFileName {
+			return nil
+		}
+		if !isMediaFile(path) && !isScreenshotFile(path) && len(otherDir) == 0 {
+			return nil
+		}
+
+		files++
+		switch {
+		case len(index.find(path, info)) != 0:
+			inTarget++
+			inTargetBytes += info.Size()
+		case len(sourceIndex.find(path, info)) != 0:
+			inSource++
+		default:
+			added++
+			addedBytes += info.Size()
+		}
+		sourceIndex.add(path, info.Size())
+
+		return nil
+	})
+
+	fmt.Printf("pclassify: %d source file(s), %d already in %s (%d bytes), %d repeated in source\n", files, inTarget, target, inTargetBytes, inSource)
+	fmt.Printf("pclassify: %d file(s) would be added, %d bytes\n", added, addedBytes)
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+)
+
+// extractThumb, when set, is the directory the JPEG thumbnails embedded in
+// the EXIF of classified photos are written to, under the same folders as
+// the photos.
+var extractThumb string = ""
+
+var extractedThumbCount int64 = 0
+
+// writeExifThumbnail writes thumb, the embedded thumbnail of the photo
+// classified to targetFile, to where it goes under extractThumb: the same
+// path relative to target, with a .jpg extension. A thumbnail already there
+// is left as it is.
+func writeExifThumbnail(thumb []byte, target, targetFile string) error {
+	relative, err := filepath.Rel(target, targetFile)
+	if err != nil {
+		return err
+	}
+
+	ext := strings.ToLower(filepath.Ext(relative))
+	if ext != ".jpg" && ext != ".jpeg" {
+		relative += ".jpg"
+	}
+
+	thumbFile := filepath.Join(extractThumb, relative)
+	if err := os.MkdirAll(filepath.Dir(thumbFile), 0755); err != nil {
+		return err
+	}
+
+	// one already there is that of the same target, from an earlier run
+	f, err := os.OpenFile(thumbFile, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if os.IsExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(thumb); err != nil {
+		f.Close()
+		os.Remove(thumbFile)
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(thumbFile)
+		return err
+	}
+
+	atomic.AddInt64(&extractedThumbCount, 1)
+	return nil
+}
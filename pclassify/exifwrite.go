@@ -0,0 +1,288 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"photoutils/pclassify/pclassifylib"
+	"sort"
+	"strings"
+	"time"
+)
+
+// findExifSegment returns where the APP1 Exif segment of the JPEG data starts
+// and ends, start being -1 when there is none, and the offset a new one
+// should be inserted at.
+func findExifSegment(data []byte) (int, int, int, error) {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return -1, 0, 0, errors.New("not a JPEG file")
+	}
+
+	insertAt := 2
+	for offset := 2; offset+4 <= len(data); {
+		if data[offset] != 0xFF {
+			return -1, 0, 0, errors.New("malformed JPEG segment")
+		}
+
+		marker := data[offset+1]
+		if marker == 0xDA || marker == 0xD9 {
+			break
+		}
+
+		length := int(binary.BigEndian.Uint16(data[offset+2 : offset+4]))
+		if length < 2 || offset+2+length > len(data) {
+			return -1, 0, 0, errors.New("malformed JPEG segment")
+		}
+
+		segment := data[offset+4 : offset+2+length]
+		if marker == 0xE1 && bytes.HasPrefix(segment, []byte("Exif\x00\x00")) {
+			return offset, offset + 2 + length, 0, nil
+		}
+
+		// keep a JFIF APP0 segment first
+		if marker == 0xE0 {
+			insertAt = offset + 2 + length
+		}
+
+		offset += 2 + length
+	}
+
+	return -1, 0, insertAt, nil
+}
+
+// ifdEntry is a TIFF IFD entry whose value fits in or is at Value.
+type ifdEntry struct {
+	Tag   uint16
+	Type  uint16
+	Count uint32
+	Value uint32
+}
+
+// buildExifSegment returns an APP1 segment holding only DateTimeOriginal.
+func buildExifSegment(date time.Time) []byte {
+	tiff := new(bytes.Buffer)
+	order := binary.BigEndian
+	write := func(data interface{}) {
+		binary.Write(tiff, order, data)
+	}
+
+	// header, IFD0 at 8 with the Exif IFD pointer, Exif IFD at 26, date at 44
+	tiff.WriteString("MM")
+	write(uint16(42))
+	write(uint32(8))
+
+	write(uint16(1))
+	write(ifdEntry{0x8769, 4, 1, 26})
+	write(uint32(0))
+
+	write(uint16(1))
+	write(ifdEntry{0x9003, 2, 20, 44})
+	write(uint32(0))
+
+	tiff.WriteString(date.Format("2006:01:02 15:04:05"))
+	tiff.WriteByte(0)
+
+	segment := new(bytes.Buffer)
+	segment.Write([]byte{0xFF, 0xE1})
+	binary.Write(segment, order, uint16(2+6+tiff.Len()))
+	segment.WriteString("Exif\x00\x00")
+	segment.Write(tiff.Bytes())
+	return segment.Bytes()
+}
+
+// readIFD returns the entries of the IFD at offset in the TIFF data and the
+// offset of the IFD following it.
+func readIFD(tiff []byte, order binary.ByteOrder, offset uint32) ([]ifdEntry, uint32, error) {
+	if uint64(offset)+2 > uint64(len(tiff)) {
+		return nil, 0, errors.New("malformed exif")
+	}
+
+	count := int(order.Uint16(tiff[offset:]))
+	end := int(offset) + 2 + count*12
+	if end+4 > len(tiff) {
+		return nil, 0, errors.New("malformed exif")
+	}
+
+	entries := make([]ifdEntry, count)
+	for i := range entries {
+		raw := tiff[int(offset)+2+i*12:]
+		entries[i] = ifdEntry{order.Uint16(raw), order.Uint16(raw[2:]), order.Uint32(raw[4:]), order.Uint32(raw[8:])}
+	}
+
+	return entries, order.Uint32(tiff[end:]), nil
+}
+
+// appendTiff appends data to the TIFF data at the even offset it returns.
+func appendTiff(tiff []byte, data []byte) ([]byte, uint32) {
+	if len(tiff)%2 != 0 {
+		tiff = append(tiff, 0)
+	}
+
+	return append(tiff, data...), uint32(len(tiff))
+}
+
+// encodeIFD returns the IFD of entries, sorted by tag, followed by next.
+func encodeIFD(entries []ifdEntry, next uint32, order binary.ByteOrder) []byte {
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Tag < entries[j].Tag })
+
+	ifd := new(bytes.Buffer)
+	binary.Write(ifd, order, uint16(len(entries)))
+	binary.Write(ifd, order, entries)
+	binary.Write(ifd, order, next)
+	return ifd.Bytes()
+}
+
+// addExifDate returns the APP1 Exif segment with DateTimeOriginal set to date.
+// The IFDs it changes are written anew at the end, so that every value the
+// others point at stays where it is.
+func addExifDate(segment []byte, date time.Time) ([]byte, error) {
+	const header = 4 + 6
+	if len(segment) < header+8 {
+		return nil, errors.New("malformed exif")
+	}
+
+	tiff := append([]byte(nil), segment[header:]...)
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return nil, errors.New("malformed exif")
+	}
+
+	ifd0 := order.Uint32(tiff[4:])
+	entries, next, err := readIFD(tiff, order, ifd0)
+	if err != nil {
+		return nil, err
+	}
+
+	tiff, dateOffset := appendTiff(tiff, append([]byte(date.Format("2006:01:02 15:04:05")), 0))
+	dateEntry := ifdEntry{0x9003, 2, 20, dateOffset}
+
+	pointer := -1
+	for i, entry := range entries {
+		if entry.Tag == 0x8769 {
+			pointer = i
+		}
+	}
+
+	if pointer < 0 {
+		var exifIFD uint32
+		tiff, exifIFD = appendTiff(tiff, encodeIFD([]ifdEntry{dateEntry}, 0, order))
+		entries = append(entries, ifdEntry{0x8769, 4, 1, exifIFD})
+		tiff, ifd0 = appendTiff(tiff, encodeIFD(entries, next, order))
+		order.PutUint32(tiff[4:], ifd0)
+	} else {
+		exifEntries, exifNext, err := readIFD(tiff, order, entries[pointer].Value)
+		if err != nil {
+			return nil, err
+		}
+
+		// an unreadable date is replaced
+		replaced := false
+		for i, entry := range exifEntries {
+			if entry.Tag == dateEntry.Tag {
+				exifEntries[i] = dateEntry
+				replaced = true
+			}
+		}
+		if !replaced {
+			exifEntries = append(exifEntries, dateEntry)
+		}
+
+		var exifIFD uint32
+		tiff, exifIFD = appendTiff(tiff, encodeIFD(exifEntries, exifNext, order))
+		order.PutUint32(tiff[int(ifd0)+2+pointer*12+8:], exifIFD)
+	}
+
+	if 2+6+len(tiff) > 0xFFFF {
+		return nil, errors.New("exif too large")
+	}
+
+	updated := new(bytes.Buffer)
+	updated.Write([]byte{0xFF, 0xE1})
+	binary.Write(updated, binary.BigEndian, uint16(2+6+len(tiff)))
+	updated.WriteString("Exif\x00\x00")
+	updated.Write(tiff)
+	return updated.Bytes(), nil
+}
+
+// exifDateToWrite returns the date file resolves to when it is a JPEG whose
+// date does not come from its EXIF, and whether there is one to write.
+func exifDateToWrite(file string) (time.Time, bool, error) {
+	date, dateSource, err := pclassifylib.ResolveCaptureTime(file)
+	if err != nil || pclassifylib.IsExifSource(dateSource) {
+		return time.Time{}, false, nil
+	}
+
+	if strings.ToLower(filepath.Ext(file)) != ".jpg" {
+		return time.Time{}, false, errors.New("writing exif is only supported for JPEG")
+	}
+
+	return date, true, nil
+}
+
+// withExifDate returns the JPEG data with date as DateTimeOriginal, added to
+// the EXIF it has or in one of its own.
+func withExifDate(data []byte, date time.Time) ([]byte, error) {
+	start, end, insertAt, err := findExifSegment(data)
+	if err != nil {
+		return nil, err
+	}
+
+	segment := buildExifSegment(date)
+	if start >= 0 {
+		segment, err = addExifDate(data[start:end], date)
+		if err != nil {
+			return nil, err
+		}
+		insertAt = start
+		data = append(data[:start:start], data[end:]...)
+	}
+
+	content := make([]byte, 0, len(data)+len(segment))
+	content = append(content, data[:insertAt]...)
+	content = append(content, segment...)
+	content = append(content, data[insertAt:]...)
+	return content, nil
+}
+
+// stageExifDate writes a copy of the JPEG file with date in its EXIF to a
+// temporary folder, dated as file, and returns it. Classifying the copy
+// rather than file leaves the source alone while comparing the target with
+// what it is written as, so a rerun finds it identical.
+func stageExifDate(file string, date time.Time) (string, error) {
+	fi, err := os.Stat(file)
+	if err != nil {
+		return "", err
+	}
+
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return "", err
+	}
+
+	content, err := withExifDate(data, date)
+	if err != nil {
+		return "", err
+	}
+
+	stageDir, err := ioutil.TempDir("", "pclassify-")
+	if err != nil {
+		return "", err
+	}
+
+	staged := filepath.Join(stageDir, filepath.Base(file))
+	if err := ioutil.WriteFile(staged, content, fi.Mode().Perm()); err != nil {
+		os.RemoveAll(stageDir)
+		return "", err
+	}
+
+	os.Chtimes(staged, fi.ModTime(), fi.ModTime())
+	return staged, nil
+}
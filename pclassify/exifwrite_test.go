@@ -0,0 +1,80 @@
+package main
+
+import (
+	"image"
+	"image/jpeg"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestClassifyWriteExifTwice(t *testing.T) {
+	defer func(b bool) { writeExif = b }(writeExif)
+	writeExif = true
+
+	dir, err := ioutil.TempDir("", "pclassify-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	file := filepath.Join(dir, "photo.jpg")
+	f, err := os.Create(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := jpeg.Encode(f, image.NewGray(image.Rect(0, 0, 1, 1)), nil); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	date := time.Date(2019, 6, 1, 12, 0, 0, 0, time.Local)
+	if err := os.Chtimes(file, date, date); err != nil {
+		t.Fatal(err)
+	}
+
+	source, err := ioutil.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	target := filepath.Join(dir, "sorted")
+	for i := 0; i < 2; i++ {
+		if err := classify(file, target, true, false, monthMode); err != nil {
+			t.Fatalf("classify run %d: %s", i+1, err)
+		}
+	}
+
+	var written []string
+	filepath.Walk(target, func(path string, fi os.FileInfo, err error) error {
+		if err == nil && !fi.IsDir() {
+			written = append(written, path)
+		}
+		return nil
+	})
+	if len(written) != 1 {
+		t.Fatalf("classify twice wrote %q, want one file", written)
+	}
+	if strings.Contains(filepath.Base(written[0]), "(1)") {
+		t.Errorf("classify twice wrote %s, want the first copy kept", written[0])
+	}
+
+	content, err := ioutil.ReadFile(written[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(content) == string(source) {
+		t.Errorf("%s has no exif date written", written[0])
+	}
+
+	after, err := ioutil.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(after) != string(source) {
+		t.Errorf("copy mode changed the source %s", file)
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+type extStat struct {
+	ext   string
+	count int
+	bytes int64
+}
+
+// runExtStats prints how many files of each extension there are under source
+// and their total size, most common first, without classifying anything.
+// Extensions pclassify does not classify are marked.
+func runExtStats(source string) {
+	stats := map[string]*extStat{}
+
+	filepath.Walk(source, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			fmt.Printf("pclassify: warning: %s: read failed, skipped\n", path)
+			return nil
+		}
+
+		if info.IsDir() {
+			if !recursiveMode && path != source {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+
+		ext := strings.ToLower(filepath.Ext(path))
+		stat, ok := stats[ext]
+		if !ok {
+			stat = &extStat{ext: ext}
+			stats[ext] = stat
+		}
+		stat.count++
+		stat.bytes += info.Size()
+
+		return nil
+	})
+
+	sorted := make([]*extStat, 0, len(stats))
+	for _, stat := range stats {
+		sorted = append(sorted, stat)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].count != sorted[j].count {
+			return sorted[i].count > sorted[j].count
+		}
+		return sorted[i].ext < sorted[j].ext
+	})
+
+	fmt.Printf("%-10s %8s %14s\n", "extension", "files", "bytes")
+
+	totalCount, totalBytes := 0, int64(0)
+	for _, stat := range sorted {
+		name := stat.ext
+		if len(name) == 0 {
+			name = "(none)"
+		}
+
+		note := ""
+		if !isMediaFile(stat.ext) {
+			note = "  not classified"
+		}
+
+		fmt.Printf("%-10s %8d %14d%s\n", name, stat.count, stat.bytes, note)
+		totalCount += stat.count
+		totalBytes += stat.bytes
+	}
+
+	fmt.Printf("%-10s %8d %14d\n", "total", totalCount, totalBytes)
+}
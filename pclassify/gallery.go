@@ -0,0 +1,238 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"image"
+	"image/jpeg"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// galleryFileName is the index -gallery writes into the folders files were
+// classified into, starting with galleryMarker to tell it from a file of the
+// user's of the same name.
+const (
+	galleryFileName = "index.html"
+	galleryMarker   = "<!-- photoutils gallery -->"
+)
+
+// thumbnailsDir is the subfolder of a folder -thumbnails writes the
+// thumbnails of its photos to. Photos of more than thumbnailMaxPixels are not
+// decoded for one.
+const (
+	thumbnailsDir      = ".thumbnails"
+	thumbnailMaxPixels = 50000000
+)
+
+var (
+	galleryMode   bool = false
+	thumbnails    bool = false
+	thumbnailSize int  = 256
+)
+
+// folderSet collects the folders files were classified into, it is safe for
+// concurrent use by the workers.
+type folderSet struct {
+	mutex   sync.Mutex
+	folders map[string]bool
+}
+
+var galleryFolders = &folderSet{folders: map[string]bool{}}
+
+func (s *folderSet) add(folder string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.folders[filepath.Clean(folder)] = true
+}
+
+func (s *folderSet) list() []string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	folders := make([]string, 0, len(s.folders))
+	for folder := range s.folders {
+		folders = append(folders, folder)
+	}
+	sort.Strings(folders)
+	return folders
+}
+
+// isGalleryFile reports whether file is an index written by -gallery.
+func isGalleryFile(file string) bool {
+	if !strings.EqualFold(filepath.Ext(file), filepath.Ext(galleryFileName)) {
+		return false
+	}
+
+	f, err := os.Open(file)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+
+	head := make([]byte, len(galleryMarker))
+	if _, err := io.ReadFull(f, head); err != nil {
+		return false
+	}
+	return string(head) == galleryMarker
+}
+
+// galleryPath returns where the index of folder goes: index.html, or when a
+// file of the user's has that name, the first of index-1.html, index-2.html
+// and so on that is free or an index written before.
+func galleryPath(folder string) string {
+	ext := filepath.Ext(galleryFileName)
+	base := strings.TrimSuffix(galleryFileName, ext)
+	for i := 0; ; i++ {
+		name := galleryFileName
+		if i > 0 {
+			name = fmt.Sprintf("%s-%d%s", base, i, ext)
+		}
+
+		file := filepath.Join(folder, name)
+		if _, err := os.Lstat(file); os.IsNotExist(err) || isGalleryFile(file) {
+			return file
+		}
+	}
+}
+
+// scaleDown returns img fitted within size pixels on its long side, sampling
+// the nearest pixels, or img itself when it already fits.
+func scaleDown(img image.Image, size int) image.Image {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if width <= size && height <= size {
+		return img
+	}
+
+	thumbWidth, thumbHeight := size, height*size/width
+	if height > width {
+		thumbWidth, thumbHeight = width*size/height, size
+	}
+	if thumbWidth == 0 {
+		thumbWidth = 1
+	}
+	if thumbHeight == 0 {
+		thumbHeight = 1
+	}
+
+	thumb := image.NewRGBA(image.Rect(0, 0, thumbWidth, thumbHeight))
+	for y := 0; y < thumbHeight; y++ {
+		for x := 0; x < thumbWidth; x++ {
+			thumb.Set(x, y, img.At(bounds.Min.X+x*width/thumbWidth, bounds.Min.Y+y*height/thumbHeight))
+		}
+	}
+	return thumb
+}
+
+// writeThumbnail writes the thumbnail of the photo name in folder, unless one
+// newer than the photo is there already, and returns its path relative to
+// folder. It is false for files image can not decode, or too large to.
+func writeThumbnail(folder, name string) (string, bool) {
+	source := filepath.Join(folder, name)
+	f, err := os.Open(source)
+	if err != nil {
+		return "", false
+	}
+	defer f.Close()
+
+	config, _, err := image.DecodeConfig(f)
+	if err != nil || config.Width*config.Height > thumbnailMaxPixels {
+		return "", false
+	}
+
+	thumbName := path.Join(thumbnailsDir, name+".jpg")
+	thumbFile := filepath.Join(folder, thumbnailsDir, name+".jpg")
+	if thumbInfo, err := os.Stat(thumbFile); err == nil {
+		if info, err := f.Stat(); err == nil && !info.ModTime().After(thumbInfo.ModTime()) {
+			return thumbName, true
+		}
+	}
+
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return "", false
+	}
+	img, _, err := image.Decode(f)
+	if err != nil {
+		return "", false
+	}
+
+	if err := os.MkdirAll(filepath.Dir(thumbFile), 0755); err != nil {
+		return "", false
+	}
+	out, err := os.Create(thumbFile)
+	if err != nil {
+		return "", false
+	}
+	defer out.Close()
+
+	if err := jpeg.Encode(out, scaleDown(img, thumbnailSize), &jpeg.Options{Quality: 80}); err != nil {
+		return "", false
+	}
+	return thumbName, true
+}
+
+// writeGallery writes an index of the files and subfolders of folder, with
+// thumbnails of its photos when -thumbnails is set.
+func writeGallery(folder string) error {
+	entries, err := ioutil.ReadDir(folder)
+	if err != nil {
+		return err
+	}
+
+	title := html.EscapeString(filepath.Base(folder))
+	var page bytes.Buffer
+	fmt.Fprintln(&page, galleryMarker)
+	fmt.Fprintln(&page, "<!DOCTYPE html>")
+	fmt.Fprintln(&page, "<html>")
+	fmt.Fprintln(&page, "<head>")
+	fmt.Fprintln(&page, "<meta charset=\"utf-8\">")
+	fmt.Fprintf(&page, "<title>%s</title>\n", title)
+	fmt.Fprintln(&page, "<style>li { display: inline-block; margin: 4px; vertical-align: top; text-align: center; }</style>")
+	fmt.Fprintln(&page, "</head>")
+	fmt.Fprintln(&page, "<body>")
+	fmt.Fprintf(&page, "<h1>%s</h1>\n", title)
+	fmt.Fprintln(&page, "<ul>")
+
+	for _, entry := range entries {
+		name := entry.Name()
+		if strings.HasPrefix(name, ".") {
+			continue
+		}
+
+		href := html.EscapeString(url.PathEscape(name))
+		label := html.EscapeString(name)
+		if entry.IsDir() {
+			fmt.Fprintf(&page, "<li><a href=\"./%s/\">%s/</a></li>\n", href, label)
+			continue
+		}
+
+		if !entry.Mode().IsRegular() || isGalleryFile(filepath.Join(folder, name)) {
+			continue
+		}
+
+		if thumbnails {
+			if thumb, ok := writeThumbnail(folder, name); ok {
+				src := html.EscapeString((&url.URL{Path: thumb}).EscapedPath())
+				fmt.Fprintf(&page, "<li><a href=\"./%s\"><img src=\"%s\" alt=\"%s\"><br>%s</a></li>\n", href, src, label, label)
+				continue
+			}
+		}
+		fmt.Fprintf(&page, "<li><a href=\"./%s\">%s</a></li>\n", href, label)
+	}
+
+	fmt.Fprintln(&page, "</ul>")
+	fmt.Fprintln(&page, "</body>")
+	fmt.Fprintln(&page, "</html>")
+
+	return ioutil.WriteFile(galleryPath(folder), page.Bytes(), 0644)
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"photoutils/pclassify/pclassifylib"
+	"photoutils/pcopy/pcopylib"
+)
+
+// unpackLivpFile writes the still and the clip of a live photo package to a
+// temporary directory, leaving the source tree alone, and returns their
+// paths, dated like the package so that both land in the same folder. The
+// caller removes the directory once they are classified. A package that can
+// not be unpacked is left to be classified as is.
+func unpackLivpFile(file string) ([]string, error) {
+	stageDir, err := ioutil.TempDir("", "pclassify-")
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("pclassify: warning: %s: %s, classified as is", file, err))
+	}
+
+	parts, err := pclassifylib.UnpackLivp(file, stageDir)
+	if err != nil {
+		os.RemoveAll(stageDir)
+
+		// failing to read the package or write its parts is no sign of it
+		// being malformed
+		if _, ok := err.(*os.PathError); ok {
+			return nil, errors.New(fmt.Sprintf("pclassify: warning: %s: %s, classified as is", file, err))
+		}
+		return nil, errors.New(fmt.Sprintf("pclassify: warning: %s: malformed live photo, classified as is", file))
+	}
+
+	if date, _, err := pclassifylib.ResolveCaptureTime(file); err == nil {
+		for _, part := range parts {
+			os.Chtimes(part, date, date)
+		}
+	}
+
+	for _, part := range parts {
+		pcopylib.OutputAction(file, "unpacked", ">>>>>>", part, "live photo unpacked")
+	}
+	return parts, nil
+}
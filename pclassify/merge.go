@@ -0,0 +1,249 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"photoutils/pcopy/pcopylib"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// folderLayouts are the folder name layouts taken as naming the same period
+// as the folders of a classify mode, the first is the one generated.
+var folderLayouts = map[typeClassifyMode][]string{
+	monthMode: {"2006-01", "2006-01-January", "2006-01-Jan", "2006_01", "2006.01", "200601"},
+	yearMode:  {"2006"},
+	dateMode:  {"2006-01-02", "2006_01_02", "2006.01.02", "20060102"},
+}
+
+var (
+	existingFolderMutex sync.Mutex
+	existingFolders     = map[string]string{}
+)
+
+// minFolderYear and maxFolderYear bound the years folder names are taken to
+// stand for, so that a folder of digits like 123412 is not read as a month.
+const (
+	minFolderYear = 1800
+	maxFolderYear = 2199
+)
+
+// parseFolderPeriod returns the period a folder name stands for in a classify
+// mode, truncated to the start of it.
+func parseFolderPeriod(folderName string, classifyMode typeClassifyMode) (time.Time, bool) {
+	for _, layout := range folderLayouts[classifyMode] {
+		if t, err := time.Parse(layout, folderName); err == nil && t.Year() >= minFolderYear && t.Year() <= maxFolderYear {
+			return t, true
+		}
+	}
+
+	return time.Time{}, false
+}
+
+// smartFolderPatterns match folder names starting with a date in any usual
+// format, like 2023_05, May 2023 or 2023-05-14 Beach, by the classify mode of
+// the period they stand for. Day patterns come first, so that a day is not
+// read as a month followed by text.
+var smartFolderPatterns = []struct {
+	classifyMode typeClassifyMode
+	pattern      *regexp.Regexp
+}{
+	{dateMode, regexp.MustCompile(`^(?P<year>\d{4})[-_. ]?(?P<month>\d{2})[-_. ]?(?P<day>\d{2})(?:$|\D)`)},
+	{dateMode, regexp.MustCompile(`^(?P<day>\d{1,2})[-_. ]+(?P<name>[A-Za-z]+)[-_. ]+(?P<year>\d{4})(?:$|\D)`)},
+	{monthMode, regexp.MustCompile(`^(?P<year>\d{4})[-_. ]?(?P<month>\d{2})(?:$|\D)`)},
+	{monthMode, regexp.MustCompile(`^(?P<name>[A-Za-z]+)[-_. ,]+(?P<year>\d{4})(?:$|\D)`)},
+	{monthMode, regexp.MustCompile(`^(?P<year>\d{4})[-_. ]+(?P<name>[A-Za-z]+)(?:$|[^A-Za-z])`)},
+	{yearMode, regexp.MustCompile(`^(?P<year>\d{4})(?:$|\D)`)},
+}
+
+// parseMonthName returns the month an English month name, or a start of it
+// of at least 3 letters like Sep or Sept, stands for, 0 if none.
+func parseMonthName(name string) time.Month {
+	for month := time.January; month <= time.December; month++ {
+		full := month.String()
+		if len(name) >= 3 && len(name) <= len(full) && strings.EqualFold(name, full[:len(name)]) {
+			return month
+		}
+	}
+
+	return 0
+}
+
+// parseSmartFolderPeriod returns the period a folder name starting with a
+// date in any usual format stands for, if any, and of which classify mode.
+func parseSmartFolderPeriod(folderName string) (time.Time, typeClassifyMode, bool) {
+	for _, smart := range smartFolderPatterns {
+		match := smart.pattern.FindStringSubmatch(folderName)
+		if match == nil {
+			continue
+		}
+
+		year, month, day := 0, 1, 1
+		for idx, name := range smart.pattern.SubexpNames() {
+			switch name {
+			case "year":
+				year, _ = strconv.Atoi(match[idx])
+			case "month":
+				month, _ = strconv.Atoi(match[idx])
+			case "day":
+				day, _ = strconv.Atoi(match[idx])
+			case "name":
+				month = int(parseMonthName(match[idx]))
+			}
+		}
+
+		// out of range parts make no date rather than a normalized one
+		period := time.Date(year, time.Month(month), day, 0, 0, 0, 0, time.UTC)
+		if period.Year() != year || int(period.Month()) != month || period.Day() != day || year < minFolderYear || year > maxFolderYear {
+			continue
+		}
+		return period, smart.classifyMode, true
+	}
+
+	return time.Time{}, 0, false
+}
+
+// periodEnd returns the end of the period of a classify mode starting at
+// start.
+func periodEnd(start time.Time, classifyMode typeClassifyMode) time.Time {
+	switch classifyMode {
+	case dateMode:
+		return start.AddDate(0, 0, 1)
+	case monthMode:
+		return start.AddDate(0, 1, 0)
+	}
+	return start.AddDate(1, 0, 0)
+}
+
+var (
+	weekFolderPattern   = regexp.MustCompile(`(?i)^\d{4}-W\d{2}$`)
+	seasonFolderPattern = regexp.MustCompile(`(?i)^\d{4}-(Winter|Spring|Summer|Autumn)$`)
+
+	// focal mode folders, whatever their boundaries
+	focalFolderPattern = regexp.MustCompile(`(?i)^(Wide \(<\d+mm\)|Normal \(\d+-\d+mm\)|Tele \(>\d+mm\))$`)
+
+	// megapixel mode folders, whatever their tiers
+	megapixelFolderPattern = regexp.MustCompile(`(?i)^(<[\d.]+MP|[\d.]+-[\d.]+MP|>[\d.]+MP)$`)
+)
+
+// birthdayFolderPattern matches the names of birthday mode folders made with
+// format, in any case.
+func birthdayFolderPattern(format string) *regexp.Regexp {
+	pattern := strings.Replace(regexp.QuoteMeta(format), "%02d", "%d", -1)
+	pattern = strings.Replace(pattern, "%d", `\d+`, -1)
+	return regexp.MustCompile("(?i)^" + pattern + "$")
+}
+
+// isClassifiedFolder reports whether a folder name is one a classify mode
+// creates, in any case, so a folder sorted by an earlier run can be told
+// apart.
+func isClassifiedFolder(folderName string, classifyMode typeClassifyMode) bool {
+	switch classifyMode {
+	case monthMode, yearMode, dateMode:
+		_, ok := parseFolderPeriod(folderName, classifyMode)
+		return ok
+	case birthdayMode:
+		return strings.EqualFold(folderName, beforeBirthFolder) || birthdayFolderPattern(weekOfAgeFormat).MatchString(folderName) || birthdayFolderPattern(birthdayPhotoFormat).MatchString(folderName) || birthdayFolderPattern(birthdayVideoFormat).MatchString(folderName)
+	case weekMode:
+		return weekFolderPattern.MatchString(folderName)
+	case seasonMode:
+		return seasonFolderPattern.MatchString(folderName)
+	case weekdayMode:
+		for day := time.Sunday; day <= time.Saturday; day++ {
+			if strings.EqualFold(folderName, day.String()) {
+				return true
+			}
+		}
+	case orientationMode:
+		for _, orientation := range orientationFolders {
+			if strings.EqualFold(folderName, orientation) {
+				return true
+			}
+		}
+	case softwareMode:
+		for _, software := range softwareFolders {
+			if strings.EqualFold(folderName, software) {
+				return true
+			}
+		}
+	case focalMode:
+		return strings.EqualFold(folderName, unknownFocalFolder) || focalFolderPattern.MatchString(folderName)
+	case megapixelMode:
+		return strings.EqualFold(folderName, otherMegapixelFolder) || megapixelFolderPattern.MatchString(folderName)
+	}
+
+	return false
+}
+
+// findExistingFolder returns the name of a folder in target standing for the
+// same period as folderName under another format, or folderName if there is
+// none. Format drift is warned about once per folder, and only followed when
+// merge is set. When smart is set, folders named in any usual date format
+// whose period holds that of folderName are matched too, and followed.
+func findExistingFolder(target, folderName string, classifyMode typeClassifyMode, merge, smart bool) string {
+	key := target + "\x00" + folderName
+
+	existingFolderMutex.Lock()
+	defer existingFolderMutex.Unlock()
+
+	if existing, ok := existingFolders[key]; ok {
+		return existing
+	}
+
+	existing := folderName
+	if pcopylib.IsTargetExist(filepath.Join(target, folderName)) == pcopylib.FileExistStatus_Directory {
+		existingFolders[key] = existing
+		return existing
+	}
+
+	if period, ok := parseFolderPeriod(folderName, classifyMode); ok {
+		end := periodEnd(period, classifyMode)
+		smartFolder, smartSpan := "", time.Duration(0)
+		entries, _ := ioutil.ReadDir(target)
+		for _, entry := range entries {
+			if !entry.IsDir() || entry.Name() == folderName {
+				continue
+			}
+
+			if other, ok := parseFolderPeriod(entry.Name(), classifyMode); ok {
+				if !other.Equal(period) {
+					continue
+				}
+				if merge || smart {
+					fmt.Printf("pclassify: warning: %s: existing folder used for %s\n", entry.Name(), folderName)
+					existing = entry.Name()
+				} else {
+					fmt.Printf("pclassify: warning: %s: existing folder has another format than %s, use -merge-existing to reuse it\n", entry.Name(), folderName)
+				}
+				smartFolder = ""
+				break
+			}
+
+			if !smart {
+				continue
+			}
+
+			// A folder holds the files of any period within its own, like May
+			// 2023 those of 2023-05-16, the narrowest one is taken.
+			other, otherMode, ok := parseSmartFolderPeriod(entry.Name())
+			if !ok || other.After(period) || periodEnd(other, otherMode).Before(end) {
+				continue
+			}
+			if span := periodEnd(other, otherMode).Sub(other); len(smartFolder) == 0 || span < smartSpan {
+				smartFolder, smartSpan = entry.Name(), span
+			}
+		}
+
+		if len(smartFolder) != 0 {
+			fmt.Printf("pclassify: warning: %s: existing folder used for %s\n", smartFolder, folderName)
+			existing = smartFolder
+		}
+	}
+
+	existingFolders[key] = existing
+	return existing
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"photoutils/pclassify/pclassifylib"
+	"photoutils/pcopy/pcopylib"
+	"strings"
+)
+
+// findMotionVideoOffset returns the offset of the MP4 stream appended to a
+// motion photo, or -1 when the JPEG carries no embedded video.
+func findMotionVideoOffset(data []byte) int {
+	eoi := bytes.Index(data, []byte{0xFF, 0xD9})
+	if eoi < 0 {
+		return -1
+	}
+
+	for start := eoi; ; {
+		idx := bytes.Index(data[start:], []byte("ftyp"))
+		if idx < 0 {
+			return -1
+		}
+		idx += start
+
+		if idx >= 4 {
+			boxSize := binary.BigEndian.Uint32(data[idx-4 : idx])
+			if boxSize >= 8 && boxSize <= 256 && idx-4 > eoi {
+				return idx - 4
+			}
+		}
+		start = idx + 4
+	}
+}
+
+// extractMotionVideo writes the video embedded in a motion photo to a .mp4
+// file named after it in a temporary directory, leaving the source tree
+// alone, and returns its path. The caller removes the directory once the
+// video is classified.
+func extractMotionVideo(file string) (string, error) {
+	extName := strings.ToLower(filepath.Ext(file))
+	if extName != ".jpg" {
+		return "", nil
+	}
+
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return "", errors.New(fmt.Sprintf("pclassify: warning: %s: read motion photo failed", file))
+	}
+
+	offset := findMotionVideoOffset(data)
+	if offset < 0 {
+		return "", nil
+	}
+
+	stageDir, err := ioutil.TempDir("", "pclassify-")
+	if err != nil {
+		return "", errors.New(fmt.Sprintf("pclassify: warning: %s: %s, motion video not extracted", file, err))
+	}
+
+	name := filepath.Base(file)
+	video := filepath.Join(stageDir, name[:len(name)-len(filepath.Ext(name))]+".mp4")
+	if err := ioutil.WriteFile(video, data[offset:], 0644); err != nil {
+		os.RemoveAll(stageDir)
+		return "", errors.New(fmt.Sprintf("pclassify: warning: %s: write motion video failed", video))
+	}
+
+	// keep the clip in the same bucket as its still
+	if date, _, err := pclassifylib.ResolveCaptureTime(file); err == nil {
+		os.Chtimes(video, date, date)
+	}
+
+	pcopylib.OutputAction(file, "extracted", ">>>>>>", video, "motion video extracted")
+	return video, nil
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"photoutils/pclassify/pclassifylib"
+	"photoutils/pcopy/pcopylib"
+	"strings"
+	"time"
+)
+
+// unknownField stands for a placeholder of -out a file has no value for.
+const unknownField = "Unknown"
+
+// outTemplate is the -out template naming the whole target path of files
+// relative to destPath, like {date:2006/01}/{camera}/{name}{ext}.
+var outTemplate string = ""
+
+// outPlaceholders are the placeholders of -out, those taking an argument
+// written like {date:2006-01}.
+var outPlaceholders = []string{"date:layout", "name", "ext", "camera", "make", "model", "exif:field"}
+
+// expandOutTemplate returns the target path of file taken at date under
+// template. Values read from the file are kept from making directories.
+func expandOutTemplate(template, file string, date time.Time) (string, error) {
+	var out strings.Builder
+	for rest := template; len(rest) != 0; {
+		open := strings.IndexByte(rest, '{')
+		if open < 0 {
+			out.WriteString(rest)
+			break
+		}
+
+		closing := strings.IndexByte(rest[open:], '}')
+		if closing < 0 {
+			return "", errors.New("unclosed {")
+		}
+
+		out.WriteString(rest[:open])
+		value, err := expandPlaceholder(rest[open+1:open+closing], file, date)
+		if err != nil {
+			return "", err
+		}
+		out.WriteString(value)
+		rest = rest[open+closing+1:]
+	}
+
+	return filepath.Clean(filepath.FromSlash(out.String())), nil
+}
+
+func expandPlaceholder(placeholder, file string, date time.Time) (string, error) {
+	name, arg := placeholder, ""
+	if idx := strings.IndexByte(placeholder, ':'); idx >= 0 {
+		name, arg = placeholder[:idx], placeholder[idx+1:]
+	}
+
+	switch {
+	case name == "date" && len(arg) != 0:
+		return date.Format(arg), nil
+	case name == "name" && len(arg) == 0:
+		base := filepath.Base(file)
+		return pcopylib.EncodeName(base[:len(base)-len(filepath.Ext(base))]), nil
+	case name == "ext" && len(arg) == 0:
+		return filepath.Ext(file), nil
+	case name == "camera" && len(arg) == 0:
+		if model, ok := pclassifylib.GetExifField(file, "Model"); ok {
+			return fieldValue(model), nil
+		}
+		return getFieldValue(file, "Make"), nil
+	case name == "make" && len(arg) == 0:
+		return getFieldValue(file, "Make"), nil
+	case name == "model" && len(arg) == 0:
+		return getFieldValue(file, "Model"), nil
+	case name == "exif" && len(arg) != 0:
+		return getFieldValue(file, arg), nil
+	}
+
+	return "", errors.New(fmt.Sprintf("unknown placeholder {%s} (choose from {%s})", placeholder, strings.Join(outPlaceholders, "}, {")))
+}
+
+func getFieldValue(file, field string) string {
+	value, ok := pclassifylib.GetExifField(file, field)
+	if !ok {
+		return unknownField
+	}
+	return fieldValue(value)
+}
+
+// fieldValue makes an EXIF value fit for a single path element.
+func fieldValue(value string) string {
+	value = strings.NewReplacer("/", "_", `\`, "_").Replace(value)
+	if value == "." || value == ".." {
+		return unknownField
+	}
+	return pcopylib.EncodeName(value)
+}
+
+// checkOutTemplate reports whether template expands to a relative path
+// within destPath.
+func checkOutTemplate(template string) error {
+	path, err := expandOutTemplate(template, "IMG_0001.jpg", time.Now())
+	if err != nil {
+		return err
+	}
+
+	if filepath.IsAbs(path) || path == "." || path == ".." || strings.HasPrefix(path, ".."+string(filepath.Separator)) {
+		return errors.New("expected a path relative to destPath")
+	}
+	return nil
+}
@@ -1,42 +1,340 @@
 package main
 
 import (
+	"context"
 	"errors"
+	"flag"
 	"fmt"
-	"github.com/rwcarlsen/goexif/exif"
+	"golang.org/x/sync/errgroup"
+	"io/ioutil"
+	"math"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"photoutils/pclassify/pclassifylib"
 	"photoutils/pcopy/pcopylib"
+	"regexp"
 	"runtime"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
 	"time"
 )
 
 func shortUsage(errInfo string) error {
-	str := fmt.Sprintln("usage: pclassify [-h] [-c] [-f] [-m | -y | -b | -d] sourcePath [destPath]")
+	str := fmt.Sprintln("usage: pclassify [-h] [-c] [-safe-move] [-plan] [-count-only] [-ext-stats] [-dup-scan] [-dedup-source] [-f] [-quick] [-mtime-tolerance duration] [-hash-cache path] [-full-hash-below size] [-sample-tier size] [-warn-skip-over size] [-r] [-dir-progress] [-parallel-walk] [-skip-sorted[=false]] [-prune] [-preserve-parent-times] [-dereference] [-album-prefix] [-merge-existing] [-merge-smart] [-raw-jpeg-split] [-video-subfolder name] [-max-per-folder n] [-two-pass] [-other-dir name] [-png] [-screenshots-dir name] [-screenshot-name regexp] [-screenshot-png[=false]] [-min-rating n] [-unrated-pass] [-rename] [-force] [-extract-motion] [-unpack-livp] [-write-exif] [-gallery] [-thumbnails] [-thumbnail-size px] [-extract-thumb dir] [-date-tag tags] [-date-priority sources] [-filename-date-format layouts] [-exif-scan size] [-tz zone] [-no-clobber] [-overwrite-if-larger] [-rename-always] [-empty policy] [-gzip] [-file-timeout duration] [-on-change policy] [-on-error policy] [-max-open n] [-limit n] [-near-dup-threshold n] [-collision strategy] [-collision-scope scope] [-name-encoding encoding] [-rename-clashes-log path] [-events-file path] [-state path] [-hook command] [-hook-once] [-hook-strict] [-ordered-output] [-log-format format] [-progress] [-preserve-btime] [-fsync policy] [-stats-json path] [-webhook url] [-chmod mode] [-dir-chmod mode] [-path-case policy] [-m | -y | -b | -d | -w | -season | -weekday | -orientation | -software | -focal | -megapixels | -out template] [-hemisphere north|south] [-birthday date] [-weekly-first-year] [-birthday-photo-format format] [-birthday-video-format format] [-profile name] [-config path] [-square-tolerance r] [-panorama-ratio r] [-focal-ranges wide,tele] [-megapixel-tiers n,...] sourcePath [destPath]\n       pclassify -doctor file")
 	str += fmt.Sprint(errInfo)
 	err := errors.New(str)
 	return err
 }
 
 func longUsage() {
-	fmt.Println("usage: pclassify [-h] [-c] [-f] [-m] [-y] [-b] sourcePath [destPath]")
+	fmt.Println("usage: pclassify [-h] [-c] [-safe-move] [-plan] [-count-only] [-ext-stats] [-dup-scan] [-dedup-source] [-f] [-quick] [-mtime-tolerance duration] [-hash-cache path] [-full-hash-below size] [-sample-tier size] [-warn-skip-over size] [-r] [-dir-progress] [-parallel-walk] [-skip-sorted[=false]] [-prune] [-preserve-parent-times] [-dereference] [-album-prefix] [-merge-existing] [-merge-smart] [-raw-jpeg-split] [-video-subfolder name] [-max-per-folder n] [-two-pass] [-other-dir name] [-png] [-screenshots-dir name] [-screenshot-name regexp] [-screenshot-png[=false]] [-min-rating n] [-unrated-pass] [-rename] [-force] [-extract-motion] [-unpack-livp] [-write-exif] [-gallery] [-thumbnails] [-thumbnail-size px] [-extract-thumb dir] [-date-tag tags] [-date-priority sources] [-filename-date-format layouts] [-exif-scan size] [-tz zone] [-no-clobber] [-overwrite-if-larger] [-rename-always] [-empty policy] [-gzip] [-file-timeout duration] [-on-change policy] [-on-error policy] [-max-open n] [-limit n] [-near-dup-threshold n] [-collision strategy] [-collision-scope scope] [-name-encoding encoding] [-rename-clashes-log path] [-events-file path] [-state path] [-hook command] [-hook-once] [-hook-strict] [-ordered-output] [-log-format format] [-progress] [-preserve-btime] [-fsync policy] [-stats-json path] [-webhook url] [-chmod mode] [-dir-chmod mode] [-path-case policy] [-m] [-y] [-b] [-d] [-w] [-season] [-weekday] [-orientation] [-software] [-focal] [-megapixels] [-out template] [-hemisphere north|south] [-birthday date] [-weekly-first-year] [-birthday-photo-format format] [-birthday-video-format format] [-profile name] [-config path] [-square-tolerance r] [-panorama-ratio r] [-focal-ranges wide,tele] [-megapixel-tiers n,...] sourcePath [destPath]\n       pclassify -doctor file")
 	fmt.Println("")
 	fmt.Println("positional arguments:")
-	fmt.Println("  sourcePath   source path for photos to be classified")
+	fmt.Println("  sourcePath   source path for photos to be classified, or a .zip or .tar")
+	fmt.Println("               archive of them, copied out entry by entry")
 	fmt.Println("  destPath     specify destination path for classified photos(use source")
-	fmt.Println("               path by default)")
+	fmt.Println("               path by default, classifying in place: photos already in")
+	fmt.Println("               the folder they belong to are left alone, and in recursive")
+	fmt.Println("               mode a destPath inside sourcePath is not scanned)")
 	fmt.Println("")
 	fmt.Println("optional arguments:")
 	fmt.Println("  -h, --help   show this help message and exit")
+	fmt.Println("  -doctor file print the exif date, folder for each classify mode and hashes")
+	fmt.Println("               of file, without classifying anything")
 	fmt.Println("  -c           copy file(s) from source to target(move file(s) by defualt)")
+	fmt.Println("  -safe-move   remove a moved source only once the full hash of its target")
+	fmt.Println("               matches, when it had to be copied across file systems or")
+	fmt.Println("               was found identical")
+	fmt.Println("  -plan        print the folder tree photos would be classified into,")
+	fmt.Println("               without copying or moving anything")
+	fmt.Println("  -count-only  print how many files of what total size there are to classify")
+	fmt.Println("               and into how many folders for each classify mode, without")
+	fmt.Println("               copying or moving anything")
+	fmt.Println("  -ext-stats   print the number and total size of source files of each")
+	fmt.Println("               extension, without classifying anything")
+	fmt.Println("  -dup-scan    print how many source files are already somewhere under")
+	fmt.Println("               destPath by content, and how much the others would add,")
+	fmt.Println("               without classifying anything")
+	fmt.Println("  -dedup-source")
+	fmt.Println("               classify only one of the source files sharing a content,")
+	fmt.Println("               skipping and reporting the others")
 	fmt.Println("  -f           use fullhash mode(more slower than default)")
+	fmt.Println("  -quick       take files of the same size and mtime as identical without")
+	fmt.Println("               hashing them")
+	fmt.Println("  -mtime-tolerance duration")
+	fmt.Println("               with -quick, take mtimes up to duration apart, like 2s, as the")
+	fmt.Println("               same, for copies to FAT or over the network that shift them(0 by")
+	fmt.Println("               default)")
+	fmt.Println("  -hash-cache path")
+	fmt.Println("               reuse the hashes recorded at path for files whose size and mtime")
+	fmt.Println("               are unchanged, and record those computed for the next run")
+	fmt.Println("  -full-hash-below size")
+	fmt.Println("               compare files under size, like 500K, by their full hash, and larger")
+	fmt.Println("               ones by sampled blocks(500K by default)")
+	fmt.Println("  -sample-tier size")
+	fmt.Println("               sample 4 blocks of files for every whole size, like 256M, up to 64,")
+	fmt.Println("               and 4 of smaller files(256M by default)")
+	fmt.Println("  -warn-skip-over size")
+	fmt.Println("               warn of every file larger than size, like 1G, skipped as identical")
+	fmt.Println("               without comparing full hashes, to double check it with -f")
+	fmt.Println("  -r           recursive mode")
+	fmt.Println("  -dir-progress")
+	fmt.Println("               report every source directory as soon as all of its files are")
+	fmt.Println("               handled, in recursive mode")
+	fmt.Println("  -parallel-walk")
+	fmt.Println("               read several source directories at once, faster on network")
+	fmt.Println("               shares(files are classified in no particular order)")
+	fmt.Println("  -skip-sorted[=false]")
+	fmt.Println("               skip source subdirectories named like the folders of the")
+	fmt.Println("               classify mode in recursive mode(on by default)")
+	fmt.Println("  -prune       remove source subdirectories left empty after moving")
+	fmt.Println("  -preserve-parent-times")
+	fmt.Println("               keep the modification times of the parents of directories")
+	fmt.Println("               removed by -prune")
+	fmt.Println("  -dereference copy the files symbolic links point to, instead of recreating")
+	fmt.Println("               the links")
+	fmt.Println("  -album-prefix")
+	fmt.Println("               prefix folder names with the name of the source subdirectory")
+	fmt.Println("               photos are in, like Wedding_2023-05-16")
+	fmt.Println("  -merge-existing")
+	fmt.Println("               classify into an existing folder of the same period named in")
+	fmt.Println("               another format, like 2023_05 for 2023-05")
+	fmt.Println("  -merge-smart  classify into an existing folder whose period holds the date,")
+	fmt.Println("               named in any usual date format, like May 2023 or 2023_05")
+	fmt.Println("               Holidays for 2023-05 or 2023-05-16, in -m, -y and -d modes")
+	fmt.Println("  -raw-jpeg-split")
+	fmt.Println("               put RAW photos into a raw subfolder of their folder and JPEG")
+	fmt.Println("               ones into a jpg subfolder, like 2023-05/raw")
+	fmt.Println("  -video-subfolder name")
+	fmt.Println("               put videos into the subfolder name of their folder, with")
+	fmt.Println("               -raw-jpeg-split(at the folder itself by default)")
+	fmt.Println("  -max-per-folder n")
+	fmt.Println("               split folders the run would put more than n files into by")
+	fmt.Println("               sub-period, counted first: dates by hour, like")
+	fmt.Println("               2023-05-16/14h, months by date and years by month, in -d, -m")
+	fmt.Println("               and -y modes")
+	fmt.Println("  -two-pass    with -max-per-folder, keep the capture times counting")
+	fmt.Println("               resolves rather than resolving them again, using more memory")
+	fmt.Println("  -other-dir name")
+	fmt.Println("               classify files that are not photos or videos into the folder")
+	fmt.Println("               name under destPath, rather than leaving them, hidden files")
+	fmt.Println("               excepted")
+	fmt.Println("  -png         classify PNG images like photos, rather than as files that")
+	fmt.Println("               are not, screenshots going to -screenshots-dir regardless")
+	fmt.Println("  -screenshots-dir name")
+	fmt.Println("               classify screenshots into the folder name under destPath,")
+	fmt.Println("               rather than by date")
+	fmt.Println("  -screenshot-name regexp")
+	fmt.Println("               take files whose name matches regexp as screenshots, \"\" for")
+	fmt.Println("               none(Screenshot, Screen Shot, Screen Capture and SCR_ names")
+	fmt.Println("               by default)")
+	fmt.Println("  -screenshot-png[=false]")
+	fmt.Println("               take PNG images with no camera make recorded as screenshots")
+	fmt.Println("               too(on by default)")
+	fmt.Println("  -min-rating n")
+	fmt.Println("               classify only photos rated at least n stars of 5 in their exif")
+	fmt.Println("               or xmp, unrated ones taken as 0")
+	fmt.Println("  -unrated-pass")
+	fmt.Println("               classify unrated photos regardless of -min-rating")
+	fmt.Println("  -rename      name files after the time they were taken, like")
+	fmt.Println("               20230516_131230.jpg, previewing the names first")
+	fmt.Println("  -force       proceed with -rename even when planned names collide")
+	fmt.Println("  -extract-motion")
+	fmt.Println("               extract videos embedded in motion photos as sibling .mp4")
+	fmt.Println("               files and classify them too")
+	fmt.Println("  -unpack-livp")
+	fmt.Println("               unpack .livp live photos into their photo and video and")
+	fmt.Println("               classify both, instead of the package as is")
+	fmt.Println("  -write-exif  write the date of JPEG photos without one into their exif as")
+	fmt.Println("               DateTimeOriginal, modifying the files at the target")
+	fmt.Println("  -gallery     write an index.html listing the files of every folder files")
+	fmt.Println("               were classified into, under index-1.html and so on when a")
+	fmt.Println("               file of that name is there already")
+	fmt.Println("  -thumbnails  show thumbnails of the photos that can be decoded in the")
+	fmt.Println("               -gallery indexes, written to .thumbnails in their folders")
+	fmt.Println("  -thumbnail-size px")
+	fmt.Println("               longest side of thumbnails in pixels(256 by default)")
+	fmt.Println("  -extract-thumb dir")
+	fmt.Println("               write the JPEG thumbnails embedded in the exif of classified")
+	fmt.Println("               photos under dir, in the same folders as the photos under")
+	fmt.Println("               destPath, leaving the photos as they are")
+	fmt.Println("  -date-tag tags")
+	fmt.Println("               comma separated exif tags tried in turn for the date a photo")
+	fmt.Println("               was taken(DateTimeOriginal,DateTimeDigitized,DateTime by")
+	fmt.Println("               default)")
+	fmt.Println("  -date-priority sources")
+	fmt.Println("               comma separated sources tried in turn for the date a file was")
+	fmt.Println("               taken, files none of them dates failing(exif,video,filename,")
+	fmt.Println("               mtime by default)")
+	fmt.Println("  -filename-date-format layouts")
+	fmt.Println("               comma separated Go time layouts, like 20060102_150405, of")
+	fmt.Println("               dates in the names of files without exif, tried before the")
+	fmt.Println("               known ones like IMG-20230516-WA0001")
+	fmt.Println("  -exif-scan size")
+	fmt.Println("               search up to size, like 8M, of JPEG, HEIC and RAW photos whose")
+	fmt.Println("               exif can not be decoded for it, 0 not to(4M by default)")
+	fmt.Println("  -tz zone     time zone used to bucket photos, an IANA name like")
+	fmt.Println("               Asia/Shanghai(local time zone by default)")
+	fmt.Println("  -no-clobber")
+	fmt.Println("               never rename or overwrite, skip any source whose target exists")
+	fmt.Println("               and leave it in place")
+	fmt.Println("  -overwrite-if-larger")
+	fmt.Println("               overwrite a same-name target smaller than its source instead")
+	fmt.Println("               of renaming(repairs interrupted copies)")
+	fmt.Println("  -rename-always")
+	fmt.Println("               rename around any existing target without comparing contents,")
+	fmt.Println("               identical files are then copied again under a new name")
+	fmt.Println("  -empty policy")
+	fmt.Println("               what to do with empty files: copy them, skip them, or report to")
+	fmt.Println("               handle them like others and list them at the end(copy by default)")
+	fmt.Println("  -gzip         write copies gzip compressed as file.ext.gz and compare")
+	fmt.Println("               existing ones by their decompressed content, uncompressed")
+	fmt.Println("               targets are not taken as duplicates of compressed ones")
+	fmt.Println("  -file-timeout duration")
+	fmt.Println("               abort and report a file whose copy makes no progress for")
+	fmt.Println("               longer than duration, like 5m(no limit by default)")
+	fmt.Println("  -on-change policy")
+	fmt.Println("               what to do about a file whose size or mtime changed while it was")
+	fmt.Println("               copied, as one an app is still writing: off, not checking, flag,")
+	fmt.Println("               listing it at the end, retry, copying it again up to 3 times, or")
+	fmt.Println("               skip, leaving it out, moves always keeping such a file(off by")
+	fmt.Println("               default)")
+	fmt.Println("  -on-error policy")
+	fmt.Println("               what to do once a file fails: continue with the others, or stop,")
+	fmt.Println("               leaving files not started yet and exiting with 1(continue by")
+	fmt.Println("               default)")
+	fmt.Println("  -max-open n")
+	fmt.Println("               open at most n files at once across copies and hashes(half the")
+	fmt.Println("               process open files limit by default)")
+	fmt.Println("  -limit n     handle only the first n files found and leave the others out,")
+	fmt.Println("               to try options on a subset(no limit by default)")
+	fmt.Println("  -near-dup-threshold n")
+	fmt.Println("               skip images whose perceptual hash differs from an existing target")
+	fmt.Println("               by at most n bits of 64, like re-encoded copies(off by default)")
+	fmt.Println("  -collision strategy")
+	fmt.Println("               how to rename a target colliding with a different file: numeric")
+	fmt.Println("               appends (1), timestamp the source mtime, hash a short content")
+	fmt.Println("               hash(numeric by default)")
+	fmt.Println("  -collision-scope scope")
+	fmt.Println("               where a target name has to be unique: folder its destination")
+	fmt.Println("               folder, tree the whole target tree, renaming a file whose name")
+	fmt.Println("               exists in any folder(folder by default)")
+	fmt.Println("  -name-encoding encoding")
+	fmt.Println("               how to write bytes of names that are not valid UTF-8: raw keeps")
+	fmt.Println("               them, escape percent-escapes them, transliterate reads them as")
+	fmt.Println("               Latin-1(raw by default)")
+	fmt.Println("  -rename-clashes-log path")
+	fmt.Println("               record every target collision to path as tab separated source,")
+	fmt.Println("               intended target, final target and whether it was identical")
+	fmt.Println("  -events-file path")
+	fmt.Println("               stream a JSON line to path for every file copied, moved, found")
+	fmt.Println("               identical, skipped or failed, like /dev/fd/3 for a pipe")
+	fmt.Println("  -state path")
+	fmt.Println("               record every source file handled to path as soon as it is, and")
+	fmt.Println("               skip those recorded unchanged, to resume an interrupted run")
+	fmt.Println("  -hook command")
+	fmt.Println("               run command for every file copied or moved, like \"thumbnail {dst}\",")
+	fmt.Println("               where {src} and {dst} are its source and target, reporting failures")
+	fmt.Println("  -hook-once   run the hook once at the end instead, with {src} and {dst}")
+	fmt.Println("               the source and target paths given")
+	fmt.Println("  -hook-strict stop handling files once a hook fails")
+	fmt.Println("  -ordered-output")
+	fmt.Println("               print what is done to every file in the order files are found,")
+	fmt.Println("               the same from one run to the next, while still handling them at once")
+	fmt.Println("  -log-format format")
+	fmt.Println("               how what is done to every file is printed: plain, like")
+	fmt.Println("               src -----> dst, tsv, tab separated action, src and dst, or")
+	fmt.Println("               quoted, plain with the paths quoted(plain by default)")
+	fmt.Println("  -progress    show percentage and time left while copying files of 100MB")
+	fmt.Println("               or more")
+	fmt.Println("  -preserve-btime")
+	fmt.Println("               give copied files the creation time of the source too, on macOS")
+	fmt.Println("               and Windows")
+	fmt.Println("  -fsync policy")
+	fmt.Println("               flush files to disk before reporting them done: file their")
+	fmt.Println("               content, dir their directory entry too, for drives unplugged")
+	fmt.Println("               right after(off by default)")
+	fmt.Println("  -stats-json path")
+	fmt.Println("               write a JSON summary of the run to path")
+	fmt.Println("  -webhook url")
+	fmt.Println("               post the -stats-json summary, with a status of finished,")
+	fmt.Println("               aborted or interrupted, to url when the run ends")
+	fmt.Println("  -chmod mode  give copied files the octal permissions mode, like 0644,")
+	fmt.Println("               instead of those of the source")
+	fmt.Println("  -dir-chmod mode")
+	fmt.Println("               give created directories the octal permissions mode, like 0755")
+	fmt.Println("  -path-case policy")
+	fmt.Println("               case of the folder names classified into: preserve them as")
+	fmt.Println("               made, lower or upper, for the same names on case sensitive")
+	fmt.Println("               and insensitive targets(preserve by default)")
 	fmt.Println("")
 	fmt.Println("  classify mode options:")
 	fmt.Println("    -m         classify photos by month(default)")
 	fmt.Println("    -y         classify photos by year")
 	fmt.Println("    -b         classify photos by birthday")
 	fmt.Println("    -d         classify photos by date")
+	fmt.Println("    -w         classify photos by ISO week, like 2023-W20")
+	fmt.Println("    -season    classify photos by season, like 2023-Spring")
+	fmt.Println("    -weekday   classify photos by day of week, like Monday")
+	fmt.Println("    -orientation")
+	fmt.Println("               classify photos and videos by shape, into Portrait,")
+	fmt.Println("               Landscape, Square, Panorama or Unknown")
+	fmt.Println("    -software  classify photos by the editor that last saved them, like")
+	fmt.Println("               Lightroom or Photoshop, from their EXIF Software, and camera")
+	fmt.Println("               originals into Original")
+	fmt.Println("    -focal     classify photos by the focal length they were taken at, 35mm")
+	fmt.Println("               equivalent when recorded, into Wide, Normal or Tele ranges")
+	fmt.Println("               and Unknown Focal")
+	fmt.Println("    -megapixels")
+	fmt.Println("               classify photos by resolution into megapixel tiers, like")
+	fmt.Println("               <5MP, 5-12MP, 12-24MP and >24MP, and files whose size can")
+	fmt.Println("               not be read from their header, videos among them, into Other")
+	fmt.Println("    -out template")
+	fmt.Println("               classify files to the path template expands to under")
+	fmt.Println("               destPath, folders and name alike, like")
+	fmt.Println("               {date:2006/01}/{camera}/{date:20060102_150405}{ext}, from")
+	fmt.Println("               {date:layout} in Go time layout, {name} and {ext} of the file,")
+	fmt.Println("               {camera}, {make}, {model} and {exif:field}, Unknown when unset")
+	fmt.Println("    -hemisphere north|south")
+	fmt.Println("               hemisphere the seasons follow(north by default)")
+	fmt.Println("    -birthday date")
+	fmt.Println("               birthday ages are counted from in -b mode, like 2011-03-16")
+	fmt.Println("    -weekly-first-year")
+	fmt.Println("               classify the first year of age by week in -b mode, like")
+	fmt.Println("               Week 03, and by month after")
+	fmt.Println("    -birthday-photo-format format")
+	fmt.Println("               printf format naming -b folders of photos from the years and")
+	fmt.Printf("               months of age, like \"Age %%dy %%dm photos\"(%%d岁%%d月照 by\n")
+	fmt.Println("               default)")
+	fmt.Println("    -birthday-video-format format")
+	fmt.Printf("               the same for videos(%%d岁%%d月视频 by default)\n")
+	fmt.Println("    -profile name")
+	fmt.Println("               take the birthday, and the photo_format and video_format")
+	fmt.Println("               printf formats naming -b folders from the years and months")
+	fmt.Println("               of age, from the profile set in the config file with lines")
+	fmt.Println("               like profiles.name.birthday = 2011-03-16")
+	fmt.Println("    -config path")
+	fmt.Println("               config file to read profiles from(photoutils/config under the")
+	fmt.Println("               user config directory by default)")
+	fmt.Println("    -square-tolerance r")
+	fmt.Println("               how far width over height may be from 1 for a Square(0.05 by")
+	fmt.Println("               default)")
+	fmt.Println("    -panorama-ratio r")
+	fmt.Println("               the ratio of the long side to the short one from which a photo")
+	fmt.Println("               is a Panorama(2 by default)")
+	fmt.Println("    -focal-ranges wide,tele")
+	fmt.Println("               focal lengths in mm below which photos are Wide and above")
+	fmt.Println("               which they are Tele(35,70 by default)")
+	fmt.Println("    -megapixel-tiers n,...")
+	fmt.Println("               ascending megapixel boundaries between the tiers of")
+	fmt.Println("               -megapixels(5,12,24 by default)")
+	fmt.Println("")
+	fmt.Println("paths may use environment variables like $HOME and a leading ~, write $$ for")
+	fmt.Println("a literal $")
 }
 
 type typeClassifyMode int
@@ -46,160 +344,650 @@ const (
 	yearMode
 	birthdayMode
 	dateMode
+	weekMode
+	seasonMode
+	weekdayMode
+	orientationMode
+	softwareMode
+	focalMode
+	megapixelMode
 	unknown
 )
 
 var (
-	copyMode     bool             = false
-	fullHashMode bool             = false
-	classifyMode typeClassifyMode = unknown
-	source       string           = ""
-	target       string           = ""
+	copyMode        bool             = false
+	doctorFile      string           = ""
+	planMode        bool             = false
+	countOnly       bool             = false
+	extStatsMode    bool             = false
+	dupScanMode     bool             = false
+	dedupSource     bool             = false
+	fullHashMode    bool             = false
+	recursiveMode   bool             = false
+	parallelMode    bool             = false
+	skipSorted      bool             = true
+	pruneMode       bool             = false
+	albumPrefix     bool             = false
+	mergeExisting   bool             = false
+	mergeSmart      bool             = false
+	rawJpegSplit    bool             = false
+	videoSubfolder  string           = ""
+	otherDir        string           = ""
+	minRating       int              = 0
+	unratedPass     bool             = false
+	renameMode      bool             = false
+	forceMode       bool             = false
+	extractMotion   bool             = false
+	unpackLivp      bool             = false
+	writeExif       bool             = false
+	southHemisphere bool             = false
+	pathCase        string           = "preserve"
+	clashLog        string           = ""
+	eventsFile      string           = ""
+	stateFile       string           = ""
+	hashCache       string           = ""
+	statsJSON       string           = ""
+	webhook         string           = ""
+	classifyMode    typeClassifyMode = unknown
+	source          string           = ""
+	target          string           = ""
+)
+
+// classifyModeValue is a boolean flag selecting one classify mode, the mode
+// options are mutually exclusive.
+type classifyModeValue struct {
+	opt  string
+	mode typeClassifyMode
+}
+
+var (
+	classifyModeOpt string = ""
+	classifyModeErr error  = nil
 )
 
+func (v *classifyModeValue) String() string {
+	return ""
+}
+
+func (v *classifyModeValue) IsBoolFlag() bool {
+	return true
+}
+
+func (v *classifyModeValue) Set(value string) error {
+	if enabled, err := strconv.ParseBool(value); err != nil || !enabled {
+		return err
+	}
+
+	if classifyMode != unknown && classifyMode != v.mode && classifyModeErr == nil {
+		classifyModeErr = errors.New(fmt.Sprintf("pclassify: error: options %s and %s are mutally exclusive", classifyModeOpt, v.opt))
+	}
+
+	classifyMode = v.mode
+	classifyModeOpt = v.opt
+	return nil
+}
+
 func parseArgs() error {
-	remainder := []string{}
-	invalidArg := []string{}
-
-	classifyModeMap := map[string]typeClassifyMode{"-b": birthdayMode, "-m": monthMode, "-y": yearMode, "-d": dateMode}
-
-	for idx, arg := range os.Args {
-		if idx == 0 {
-			continue
-		}
-
-		switch {
-		case arg == "-h" || arg == "--help":
-			longUsage()
-			os.Exit(0)
-		case arg == "-c":
-			copyMode = true
-		case arg == "-f":
-			fullHashMode = true
-		case arg == "-b" || arg == "-y" || arg == "-m" || arg == "-d":
-			if classifyMode == unknown {
-				classifyMode = classifyModeMap[arg]
-			} else {
-				for opt, mode := range classifyModeMap {
-					if mode == classifyMode {
-						return shortUsage(fmt.Sprintf("pclassify: error: options %s and %s are mutally exclusive", opt, arg))
-					}
-				}
-			}
-		case arg[:1] == "-":
-			invalidArg = append(invalidArg, arg)
-		default:
-			remainder = append(remainder, arg)
+	screenshotPattern := ""
+	fullHashBelow := ""
+	exifScan := ""
+	sampleTier := ""
+	warnSkipOver := ""
+	timeZone := ""
+	dateTags := ""
+	datePriority := ""
+	filenameDateFormat := ""
+	hemisphere := ""
+	birthdayValue := ""
+	photoFormat := ""
+	videoFormat := ""
+	profile := ""
+	configPath := ""
+	collision := ""
+	collisionScope := ""
+	nameEncoding := ""
+	fsync := ""
+	empty := ""
+	onError := ""
+	onChange := ""
+	logFormat := ""
+	fileMode := ""
+	dirMode := ""
+	focalRanges := ""
+	megapixelBounds := ""
+
+	flags := flag.NewFlagSet("pclassify", flag.ContinueOnError)
+	flags.SetOutput(ioutil.Discard)
+	flags.BoolVar(&copyMode, "c", false, "")
+	flags.StringVar(&doctorFile, "doctor", "", "")
+	flags.BoolVar(&pcopylib.SafeMove, "safe-move", false, "")
+	flags.BoolVar(&planMode, "plan", false, "")
+	flags.BoolVar(&countOnly, "count-only", false, "")
+	flags.BoolVar(&extStatsMode, "ext-stats", false, "")
+	flags.BoolVar(&dupScanMode, "dup-scan", false, "")
+	flags.BoolVar(&dedupSource, "dedup-source", false, "")
+	flags.BoolVar(&fullHashMode, "f", false, "")
+	flags.BoolVar(&pcopylib.QuickMode, "quick", false, "")
+	flags.DurationVar(&pcopylib.MtimeTolerance, "mtime-tolerance", 0, "")
+	flags.StringVar(&hashCache, "hash-cache", "", "")
+	flags.StringVar(&fullHashBelow, "full-hash-below", "500K", "")
+	flags.StringVar(&exifScan, "exif-scan", "4M", "")
+	flags.StringVar(&sampleTier, "sample-tier", "256M", "")
+	flags.StringVar(&warnSkipOver, "warn-skip-over", "", "")
+	flags.BoolVar(&recursiveMode, "r", false, "")
+	flags.BoolVar(&pcopylib.DirProgress, "dir-progress", false, "")
+	flags.BoolVar(&parallelMode, "parallel-walk", false, "")
+	flags.BoolVar(&skipSorted, "skip-sorted", true, "")
+	flags.BoolVar(&pruneMode, "prune", false, "")
+	flags.BoolVar(&pcopylib.PreserveParentTimes, "preserve-parent-times", false, "")
+	flags.BoolVar(&pcopylib.Dereference, "dereference", false, "")
+	flags.BoolVar(&albumPrefix, "album-prefix", false, "")
+	flags.BoolVar(&mergeExisting, "merge-existing", false, "")
+	flags.BoolVar(&mergeSmart, "merge-smart", false, "")
+	flags.BoolVar(&rawJpegSplit, "raw-jpeg-split", false, "")
+	flags.StringVar(&videoSubfolder, "video-subfolder", "", "")
+	flags.IntVar(&maxPerFolder, "max-per-folder", 0, "")
+	flags.BoolVar(&twoPass, "two-pass", false, "")
+	flags.StringVar(&otherDir, "other-dir", "", "")
+	flags.BoolVar(&classifyPng, "png", false, "")
+	flags.StringVar(&screenshotsDir, "screenshots-dir", "", "")
+	flags.StringVar(&screenshotPattern, "screenshot-name", defaultScreenshotName, "")
+	flags.BoolVar(&screenshotsPng, "screenshot-png", true, "")
+	flags.IntVar(&minRating, "min-rating", 0, "")
+	flags.BoolVar(&unratedPass, "unrated-pass", false, "")
+	flags.BoolVar(&renameMode, "rename", false, "")
+	flags.BoolVar(&forceMode, "force", false, "")
+	flags.BoolVar(&extractMotion, "extract-motion", false, "")
+	flags.BoolVar(&unpackLivp, "unpack-livp", false, "")
+	flags.BoolVar(&writeExif, "write-exif", false, "")
+	flags.BoolVar(&galleryMode, "gallery", false, "")
+	flags.BoolVar(&thumbnails, "thumbnails", false, "")
+	flags.IntVar(&thumbnailSize, "thumbnail-size", 256, "")
+	flags.StringVar(&extractThumb, "extract-thumb", "", "")
+	flags.BoolVar(&pcopylib.NoClobber, "no-clobber", false, "")
+	flags.BoolVar(&pcopylib.OverwriteIfLarger, "overwrite-if-larger", false, "")
+	flags.BoolVar(&pcopylib.RenameAlways, "rename-always", false, "")
+	flags.StringVar(&empty, "empty", "copy", "")
+	flags.BoolVar(&pcopylib.Gzip, "gzip", false, "")
+	flags.DurationVar(&pcopylib.FileTimeout, "file-timeout", 0, "")
+	flags.StringVar(&onChange, "on-change", "off", "")
+	flags.StringVar(&onError, "on-error", "continue", "")
+	flags.IntVar(&pcopylib.MaxOpenFiles, "max-open", 0, "")
+	flags.Int64Var(&pcopylib.FileLimit, "limit", 0, "")
+	flags.IntVar(&pcopylib.NearDupThreshold, "near-dup-threshold", -1, "")
+	flags.StringVar(&collision, "collision", "numeric", "")
+	flags.StringVar(&collisionScope, "collision-scope", "folder", "")
+	flags.StringVar(&nameEncoding, "name-encoding", "raw", "")
+	flags.StringVar(&clashLog, "rename-clashes-log", "", "")
+	flags.StringVar(&eventsFile, "events-file", "", "")
+	flags.StringVar(&stateFile, "state", "", "")
+	flags.StringVar(&pcopylib.Hook, "hook", "", "")
+	flags.BoolVar(&pcopylib.HookOnce, "hook-once", false, "")
+	flags.BoolVar(&pcopylib.HookStrict, "hook-strict", false, "")
+	flags.BoolVar(&pcopylib.OrderedOutput, "ordered-output", false, "")
+	flags.StringVar(&logFormat, "log-format", "plain", "")
+	flags.BoolVar(&pcopylib.Progress, "progress", false, "")
+	flags.BoolVar(&pcopylib.PreserveBirthTime, "preserve-btime", false, "")
+	flags.StringVar(&fsync, "fsync", "off", "")
+	flags.StringVar(&statsJSON, "stats-json", "", "")
+	flags.StringVar(&webhook, "webhook", "", "")
+	flags.StringVar(&fileMode, "chmod", "", "")
+	flags.StringVar(&dirMode, "dir-chmod", "", "")
+	flags.StringVar(&dateTags, "date-tag", "", "")
+	flags.StringVar(&datePriority, "date-priority", "", "")
+	flags.StringVar(&filenameDateFormat, "filename-date-format", "", "")
+	flags.StringVar(&timeZone, "tz", "", "")
+	flags.Var(&classifyModeValue{"-m", monthMode}, "m", "")
+	flags.Var(&classifyModeValue{"-y", yearMode}, "y", "")
+	flags.Var(&classifyModeValue{"-b", birthdayMode}, "b", "")
+	flags.Var(&classifyModeValue{"-d", dateMode}, "d", "")
+	flags.Var(&classifyModeValue{"-w", weekMode}, "w", "")
+	flags.Var(&classifyModeValue{"-season", seasonMode}, "season", "")
+	flags.Var(&classifyModeValue{"-weekday", weekdayMode}, "weekday", "")
+	flags.Var(&classifyModeValue{"-orientation", orientationMode}, "orientation", "")
+	flags.Var(&classifyModeValue{"-software", softwareMode}, "software", "")
+	flags.Var(&classifyModeValue{"-focal", focalMode}, "focal", "")
+	flags.Var(&classifyModeValue{"-megapixels", megapixelMode}, "megapixels", "")
+	flags.StringVar(&outTemplate, "out", "", "")
+	flags.Float64Var(&squareTolerance, "square-tolerance", 0.05, "")
+	flags.Float64Var(&panoramaRatio, "panorama-ratio", 2, "")
+	flags.StringVar(&focalRanges, "focal-ranges", "35,70", "")
+	flags.StringVar(&megapixelBounds, "megapixel-tiers", "5,12,24", "")
+	flags.StringVar(&hemisphere, "hemisphere", "north", "")
+	flags.StringVar(&pathCase, "path-case", "preserve", "")
+	flags.StringVar(&birthdayValue, "birthday", "", "")
+	flags.BoolVar(&weeklyFirstYear, "weekly-first-year", false, "")
+	flags.StringVar(&photoFormat, "birthday-photo-format", "", "")
+	flags.StringVar(&videoFormat, "birthday-video-format", "", "")
+	flags.StringVar(&profile, "profile", "", "")
+	flags.StringVar(&configPath, "config", "", "")
+
+	remainder, err := pcopylib.ParseFlags(flags, os.Args[1:])
+	switch {
+	case err == flag.ErrHelp:
+		longUsage()
+		os.Exit(0)
+	case err != nil && strings.HasPrefix(err.Error(), "flag provided but not defined: "):
+		return shortUsage(fmt.Sprintf("pclassify: error: unrecognized arguments: %s", strings.TrimPrefix(err.Error(), "flag provided but not defined: ")))
+	case err != nil:
+		return shortUsage(fmt.Sprintf("pclassify: error: %s", err))
+	case classifyModeErr != nil:
+		return shortUsage(fmt.Sprint(classifyModeErr))
+	}
+
+	switch hemisphere {
+	case "north":
+		southHemisphere = false
+	case "south":
+		southHemisphere = true
+	default:
+		return shortUsage(fmt.Sprintf("pclassify: error: argument -hemisphere: invalid choice: %s (choose from north, south)", hemisphere))
+	}
+
+	if pathCase != "preserve" && pathCase != "lower" && pathCase != "upper" {
+		return shortUsage(fmt.Sprintf("pclassify: error: argument -path-case: invalid choice: %s (choose from preserve, lower, upper)", pathCase))
+	}
+
+	if len(profile) != 0 {
+		if len(configPath) == 0 {
+			configPath = defaultConfigPath()
+		}
+
+		config, err := readConfig(configPath)
+		if os.IsNotExist(err) {
+			return shortUsage(fmt.Sprintf("pclassify: error: argument -profile: no config file %s", configPath))
+		}
+		if err == nil {
+			err = applyProfile(config, profile)
+		}
+		if err != nil {
+			return shortUsage(fmt.Sprintf("pclassify: error: argument -profile: %s: %s", configPath, err))
 		}
 	}
 
-	if len(remainder) > 2 {
-		invalidArg = append(invalidArg, remainder[:len(remainder)-2]...)
+	if len(birthdayValue) != 0 {
+		date, err := parseBirthday(birthdayValue)
+		if err != nil {
+			return shortUsage(fmt.Sprintf("pclassify: error: argument -birthday: invalid date %s, expected like 2011-03-16", birthdayValue))
+		}
+		birthday = date
 	}
 
-	if len(remainder) < 1 {
-		return shortUsage(fmt.Sprint("pclassify: error: too few arguments"))
+	if len(photoFormat) != 0 {
+		if !checkBirthdayFormat(photoFormat) {
+			return shortUsage(fmt.Sprintf("pclassify: error: argument -birthday-photo-format: invalid format %s, expected two %%d for years and months", photoFormat))
+		}
+		birthdayPhotoFormat = photoFormat
 	}
 
-	if len(invalidArg) > 0 {
-		return shortUsage(fmt.Sprintf("pclassify: error: unrecognized arguments: %s", strings.Join(invalidArg, " ")))
+	if len(videoFormat) != 0 {
+		if !checkBirthdayFormat(videoFormat) {
+			return shortUsage(fmt.Sprintf("pclassify: error: argument -birthday-video-format: invalid format %s, expected two %%d for years and months", videoFormat))
+		}
+		birthdayVideoFormat = videoFormat
 	}
 
-	source = remainder[0]
-	if len(remainder) == 2 {
-		target = remainder[1]
+	if squareTolerance < 0 || squareTolerance >= 1 {
+		return shortUsage(fmt.Sprintf("pclassify: error: argument -square-tolerance: invalid tolerance %g (choose from 0 to below 1)", squareTolerance))
 	}
 
-	if classifyMode == unknown {
-		classifyMode = monthMode
+	if panoramaRatio <= 1 {
+		return shortUsage(fmt.Sprintf("pclassify: error: argument -panorama-ratio: invalid ratio %g (choose above 1)", panoramaRatio))
 	}
 
-	if len(target) == 0 {
-		target = source
+	if wide, tele, err := parseFocalRanges(focalRanges); err == nil {
+		focalWide, focalTele = wide, tele
+	} else {
+		return shortUsage(fmt.Sprintf("pclassify: error: argument -focal-ranges: invalid ranges %s, expected like 35,70", focalRanges))
 	}
 
-	return nil
-}
+	if tiers, err := parseMegapixelTiers(megapixelBounds); err == nil {
+		megapixelTiers = tiers
+	} else {
+		return shortUsage(fmt.Sprintf("pclassify: error: argument -megapixel-tiers: invalid tiers %s, expected like 5,12,24", megapixelBounds))
+	}
 
-func getDateFromExif(file string) (error, time.Time) {
-	f, err := os.Open(file)
-	defer f.Close()
+	if len(outTemplate) != 0 {
+		if err := checkOutTemplate(outTemplate); err != nil {
+			return shortUsage(fmt.Sprintf("pclassify: error: argument -out: invalid template %s, %s", outTemplate, err))
+		}
+		if renameMode {
+			return shortUsage(fmt.Sprint("pclassify: error: argument -rename: not allowed with argument -out"))
+		}
+	}
 
-	if err != nil {
-		return errors.New("pclassify: warning: read exif info failed"), time.Now()
+	if len(videoSubfolder) != 0 && !rawJpegSplit {
+		return shortUsage(fmt.Sprint("pclassify: error: argument -video-subfolder: not allowed without argument -raw-jpeg-split"))
 	}
 
-	x, err := exif.Decode(f)
-	if err != nil {
-		return errors.New("pclassify: warning: read exif info failed"), time.Now()
+	if thumbnails && !galleryMode {
+		return shortUsage(fmt.Sprint("pclassify: error: argument -thumbnails: not allowed without argument -gallery"))
 	}
 
-	ts, err := x.Get(exif.DateTimeOriginal)
-	if err != nil {
-		return errors.New("pclassify: warning: read exif info failed"), time.Now()
+	if thumbnailSize <= 0 {
+		return shortUsage(fmt.Sprintf("pclassify: error: argument -thumbnail-size: invalid size %d (choose above 0)", thumbnailSize))
 	}
 
-	const layout = "2006:01:02 15:04:05"
-	t, err := time.ParseInLocation(layout, ts.StringVal(), time.Local)
-	if err != nil {
-		return errors.New("pclassify: warning: read exif info failed"), time.Now()
+	if len(extractThumb) != 0 {
+		extractThumb = filepath.Clean(pcopylib.ExpandPath(extractThumb))
+		if status := pcopylib.IsFileExist(extractThumb); status != pcopylib.FileExistStatus_NotExist && status != pcopylib.FileExistStatus_Directory {
+			return shortUsage(fmt.Sprintf("pclassify: error: argument -extract-thumb: %s: Not a directory", extractThumb))
+		}
 	}
 
-	return nil, t
-}
+	if len(videoSubfolder) != 0 && (strings.ContainsAny(videoSubfolder, `/\`) || videoSubfolder == "." || videoSubfolder == "..") {
+		return shortUsage(fmt.Sprintf("pclassify: error: argument -video-subfolder: invalid folder name %s", videoSubfolder))
+	}
 
-func getDateFromModifyTime(file string) (error, time.Time) {
-	fi, err := os.Stat(file)
-	if err != nil {
-		return errors.New("pclassify: warning: get file MT_TIME failed"), time.Now()
+	if len(otherDir) != 0 && (strings.ContainsAny(otherDir, `/\`) || otherDir == "." || otherDir == "..") {
+		return shortUsage(fmt.Sprintf("pclassify: error: argument -other-dir: invalid folder name %s", otherDir))
 	}
 
-	return nil, fi.ModTime()
-}
+	if len(screenshotsDir) != 0 && (strings.ContainsAny(screenshotsDir, `/\`) || screenshotsDir == "." || screenshotsDir == "..") {
+		return shortUsage(fmt.Sprintf("pclassify: error: argument -screenshots-dir: invalid folder name %s", screenshotsDir))
+	}
 
-func makeFolderByMonth(target string, date time.Time) (string, error) {
-	dateString := date.Format("2006-01")
-	folderPath := filepath.Join(target, dateString)
+	if len(screenshotPattern) == 0 {
+		screenshotName = nil
+	} else if pattern, err := regexp.Compile(screenshotPattern); err == nil {
+		screenshotName = pattern
+	} else {
+		return shortUsage(fmt.Sprintf("pclassify: error: argument -screenshot-name: invalid regexp %s, %s", screenshotPattern, err))
+	}
 
-	if pcopylib.IsFileExist(folderPath) != pcopylib.FileExistStatus_Directory {
-		os.Mkdir(folderPath, os.ModePerm|os.ModeDir)
+	if minRating < 0 || minRating > 5 {
+		return shortUsage(fmt.Sprintf("pclassify: error: argument -min-rating: invalid rating %d (choose from 0 to 5)", minRating))
 	}
 
-	if pcopylib.IsFileExist(folderPath) != pcopylib.FileExistStatus_Directory {
-		return "", errors.New("pclassify: error: make folder by month failed")
+	if len(dateTags) != 0 {
+		if err := pclassifylib.SetDateTags(dateTags); err != nil {
+			return shortUsage(fmt.Sprintf("pclassify: error: argument -date-tag: %s (choose from %s)", err, strings.Join(pclassifylib.DateTagNames(), ", ")))
+		}
 	}
 
-	return folderPath, nil
-}
+	if len(datePriority) != 0 {
+		if err := pclassifylib.SetDatePriority(datePriority); err != nil {
+			return shortUsage(fmt.Sprintf("pclassify: error: argument -date-priority: %s (choose from %s)", err, strings.Join(pclassifylib.DateSourceNames(), ", ")))
+		}
+	}
 
-func makeFolderByYear(target string, date time.Time) (string, error) {
-	dateString := date.Format("2006")
-	folderPath := filepath.Join(target, dateString)
+	if len(filenameDateFormat) != 0 {
+		if err := pclassifylib.SetFilenameDateFormats(filenameDateFormat); err != nil {
+			return shortUsage(fmt.Sprintf("pclassify: error: argument -filename-date-format: %s", err))
+		}
+	}
 
-	if pcopylib.IsFileExist(folderPath) != pcopylib.FileExistStatus_Directory {
-		os.Mkdir(folderPath, os.ModePerm|os.ModeDir)
+	if len(timeZone) != 0 {
+		loc, err := time.LoadLocation(timeZone)
+		if err != nil {
+			return shortUsage(fmt.Sprintf("pclassify: error: argument -tz: unknown time zone %s", timeZone))
+		}
+		pclassifylib.Location = loc
 	}
 
-	if pcopylib.IsFileExist(folderPath) != pcopylib.FileExistStatus_Directory {
-		return "", errors.New("pclassify: error: make folder by month failed")
+	collisionMap := map[string]pcopylib.CollisionStrategy{"numeric": pcopylib.CollisionStrategy_Numeric, "timestamp": pcopylib.CollisionStrategy_Timestamp, "hash": pcopylib.CollisionStrategy_Hash}
+	if strategy, ok := collisionMap[collision]; ok {
+		pcopylib.Collision = strategy
+	} else {
+		return shortUsage(fmt.Sprintf("pclassify: error: argument -collision: invalid choice: %s (choose from numeric, timestamp, hash)", collision))
 	}
 
-	return folderPath, nil
+	collisionScopeMap := map[string]pcopylib.CollisionScope{"folder": pcopylib.CollisionScope_Folder, "tree": pcopylib.CollisionScope_Tree}
+	if scope, ok := collisionScopeMap[collisionScope]; ok {
+		pcopylib.TargetCollisionScope = scope
+	} else {
+		return shortUsage(fmt.Sprintf("pclassify: error: argument -collision-scope: invalid choice: %s (choose from folder, tree)", collisionScope))
+	}
+
+	nameEncodingMap := map[string]pcopylib.NameEncoding{"raw": pcopylib.NameEncoding_Raw, "escape": pcopylib.NameEncoding_Escape, "transliterate": pcopylib.NameEncoding_Transliterate}
+	if encoding, ok := nameEncodingMap[nameEncoding]; ok {
+		pcopylib.TargetNameEncoding = encoding
+	} else {
+		return shortUsage(fmt.Sprintf("pclassify: error: argument -name-encoding: invalid choice: %s (choose from raw, escape, transliterate)", nameEncoding))
+	}
+
+	logFormatMap := map[string]pcopylib.LogFormat{"plain": pcopylib.LogFormat_Plain, "tsv": pcopylib.LogFormat_TSV, "quoted": pcopylib.LogFormat_Quoted}
+	if format, ok := logFormatMap[logFormat]; ok {
+		pcopylib.ActionLogFormat = format
+	} else {
+		return shortUsage(fmt.Sprintf("pclassify: error: argument -log-format: invalid choice: %s (choose from plain, tsv, quoted)", logFormat))
+	}
+
+	onChangeMap := map[string]pcopylib.ChangePolicy{"off": pcopylib.ChangePolicy_Off, "flag": pcopylib.ChangePolicy_Flag, "retry": pcopylib.ChangePolicy_Retry, "skip": pcopylib.ChangePolicy_Skip}
+	if policy, ok := onChangeMap[onChange]; ok {
+		pcopylib.OnChange = policy
+	} else {
+		return shortUsage(fmt.Sprintf("pclassify: error: argument -on-change: invalid choice: %s (choose from off, flag, retry, skip)", onChange))
+	}
+
+	onErrorMap := map[string]pcopylib.ErrorPolicy{"continue": pcopylib.ErrorPolicy_Continue, "stop": pcopylib.ErrorPolicy_Stop}
+	if policy, ok := onErrorMap[onError]; ok {
+		pcopylib.OnError = policy
+	} else {
+		return shortUsage(fmt.Sprintf("pclassify: error: argument -on-error: invalid choice: %s (choose from continue, stop)", onError))
+	}
+
+	emptyMap := map[string]pcopylib.EmptyPolicy{"copy": pcopylib.EmptyPolicy_Copy, "skip": pcopylib.EmptyPolicy_Skip, "report": pcopylib.EmptyPolicy_Report}
+	if policy, ok := emptyMap[empty]; ok {
+		pcopylib.EmptyFiles = policy
+	} else {
+		return shortUsage(fmt.Sprintf("pclassify: error: argument -empty: invalid choice: %s (choose from copy, skip, report)", empty))
+	}
+
+	fsyncMap := map[string]pcopylib.FsyncPolicy{"off": pcopylib.FsyncPolicy_Off, "file": pcopylib.FsyncPolicy_File, "dir": pcopylib.FsyncPolicy_Dir}
+	if policy, ok := fsyncMap[fsync]; ok {
+		pcopylib.Fsync = policy
+	} else {
+		return shortUsage(fmt.Sprintf("pclassify: error: argument -fsync: invalid choice: %s (choose from off, file, dir)", fsync))
+	}
+
+	if size, err := pcopylib.ParseSize(exifScan); err == nil {
+		pclassifylib.ExifScanSize = size
+	} else {
+		return shortUsage(fmt.Sprintf("pclassify: error: argument -exif-scan: invalid size %s", exifScan))
+	}
+
+	if size, err := pcopylib.ParseSize(fullHashBelow); err == nil {
+		pcopylib.FullHashBelow = size
+	} else {
+		return shortUsage(fmt.Sprintf("pclassify: error: argument -full-hash-below: invalid size %s", fullHashBelow))
+	}
+
+	if size, err := pcopylib.ParseSize(sampleTier); err == nil && size > 0 {
+		pcopylib.SampleTier = size
+	} else {
+		return shortUsage(fmt.Sprintf("pclassify: error: argument -sample-tier: invalid size %s", sampleTier))
+	}
+
+	if len(warnSkipOver) != 0 {
+		size, err := pcopylib.ParseSize(warnSkipOver)
+		if err != nil {
+			return shortUsage(fmt.Sprintf("pclassify: error: argument -warn-skip-over: invalid size %s", warnSkipOver))
+		}
+		pcopylib.WarnSkipOver = size
+	}
+
+	if pcopylib.MaxOpenFiles < 0 || pcopylib.MaxOpenFiles == 1 {
+		return shortUsage(fmt.Sprintf("pclassify: error: argument -max-open: invalid count %d (choose at least 2)", pcopylib.MaxOpenFiles))
+	}
+
+	if pcopylib.FileLimit < 0 {
+		return shortUsage(fmt.Sprintf("pclassify: error: argument -limit: invalid count %d", pcopylib.FileLimit))
+	}
+
+	if pcopylib.RenameAlways && pcopylib.NoClobber {
+		return shortUsage(fmt.Sprint("pclassify: error: argument -rename-always: not allowed with argument -no-clobber"))
+	}
+
+	if pcopylib.RenameAlways && pcopylib.Collision != pcopylib.CollisionStrategy_Numeric {
+		return shortUsage(fmt.Sprintf("pclassify: error: argument -rename-always: not allowed with argument -collision %s", collision))
+	}
+
+	if len(webhook) != 0 {
+		if err := pcopylib.CheckWebhookURL(webhook); err != nil {
+			return shortUsage(fmt.Sprintf("pclassify: error: argument -webhook: invalid url %s, %s", webhook, err))
+		}
+	}
+
+	if pcopylib.Gzip && pcopylib.OverwriteIfLarger {
+		return shortUsage(fmt.Sprint("pclassify: error: argument -overwrite-if-larger: not allowed with argument -gzip"))
+	}
+
+	if pcopylib.MtimeTolerance < 0 {
+		return shortUsage(fmt.Sprintf("pclassify: error: argument -mtime-tolerance: invalid tolerance %s (choose 0 or above)", pcopylib.MtimeTolerance))
+	}
+
+	if pcopylib.MtimeTolerance != 0 && !pcopylib.QuickMode {
+		return shortUsage(fmt.Sprint("pclassify: error: argument -mtime-tolerance: not allowed without argument -quick"))
+	}
+
+	if len(pcopylib.Hook) == 0 && pcopylib.HookOnce {
+		return shortUsage(fmt.Sprint("pclassify: error: argument -hook-once: not allowed without argument -hook"))
+	}
+
+	if len(pcopylib.Hook) == 0 && pcopylib.HookStrict {
+		return shortUsage(fmt.Sprint("pclassify: error: argument -hook-strict: not allowed without argument -hook"))
+	}
+
+	if len(fileMode) != 0 {
+		perm, err := strconv.ParseUint(fileMode, 8, 32)
+		if err != nil || perm == 0 || perm > 0777 {
+			return shortUsage(fmt.Sprintf("pclassify: error: argument -chmod: invalid mode %s", fileMode))
+		}
+		pcopylib.FileMode = os.FileMode(perm)
+	}
+
+	if len(dirMode) != 0 {
+		perm, err := strconv.ParseUint(dirMode, 8, 32)
+		if err != nil || perm == 0 || perm > 0777 {
+			return shortUsage(fmt.Sprintf("pclassify: error: argument -dir-chmod: invalid mode %s", dirMode))
+		}
+		pcopylib.DirMode = os.FileMode(perm)
+	}
+
+	if len(doctorFile) != 0 {
+		return nil
+	}
+
+	if len(remainder) > 2 {
+		return shortUsage(fmt.Sprintf("pclassify: error: unrecognized arguments: %s", strings.Join(remainder[:len(remainder)-2], " ")))
+	}
+
+	if len(remainder) < 1 {
+		return shortUsage(fmt.Sprint("pclassify: error: too few arguments"))
+	}
+
+	for idx, arg := range remainder {
+		remainder[idx] = pcopylib.ExpandPath(arg)
+	}
+
+	for _, arg := range remainder {
+		if len(arg) == 0 {
+			return shortUsage(fmt.Sprint("pclassify: error: empty path argument"))
+		}
+	}
+
+	// the walk tells the root apart by its path, which has to be clean, like
+	// those of the files under it
+	source = filepath.Clean(remainder[0])
+	if len(remainder) == 2 {
+		target = filepath.Clean(remainder[1])
+	}
+
+	if len(outTemplate) != 0 && classifyMode != unknown {
+		return shortUsage(fmt.Sprintf("pclassify: error: options %s and -out are mutally exclusive", classifyModeOpt))
+	}
+
+	if classifyMode == unknown {
+		classifyMode = monthMode
+	}
+
+	if err := checkMaxPerFolder(); err != nil {
+		return shortUsage(err.Error())
+	}
+
+	if len(target) == 0 {
+		target = source
+	}
+
+	return nil
+}
+
+var (
+	imageExtensions = map[string]bool{".jpg": true, ".cr2": true, ".tif": true, ".tiff": true, ".dng": true, ".nef": true, ".arw": true, ".heic": true, ".heif": true, ".livp": true}
+	videoExtensions = map[string]bool{".mp4": true, ".mov": true, ".3gp": true}
+)
+
+// classifyPng makes PNG images be classified like photos.
+var classifyPng bool = false
+
+// isMediaFile reports whether file has the extension of a photo or video
+// pclassify classifies.
+func isMediaFile(file string) bool {
+	extName := strings.ToLower(filepath.Ext(file))
+	return imageExtensions[extName] || videoExtensions[extName] || (classifyPng && extName == ".png")
+}
+
+func folderNameByMonth(date time.Time) string {
+	return date.Format("2006-01")
+}
+
+func folderNameByYear(date time.Time) string {
+	return date.Format("2006")
 }
 
-func makeFolderByBirthday(target string, date time.Time, file string) (string, error) {
-	birthday := time.Date(2011, 3, 16, 13, 12, 30, 0, time.Local)
+// beforeBirthFolder receives the photos taken before the birthday in birthday
+// mode.
+const beforeBirthFolder = "_before_birth"
 
+var beforeBirthCount int64 = 0
+
+// birthday is the day ages are counted from in birthday mode, only its date
+// is used.
+var birthday time.Time = time.Date(2011, 3, 16, 0, 0, 0, 0, time.UTC)
+
+// birthdayPhotoFormat and birthdayVideoFormat name the folders of birthday
+// mode from the years and months of age.
+var (
+	birthdayPhotoFormat string = "%d岁%d月照"
+	birthdayVideoFormat string = "%d岁%d月视频"
+)
+
+// weeklyFirstYear makes birthday mode classify the first year of age by week
+// rather than by month.
+var weeklyFirstYear bool = false
+
+// weekOfAgeFormat names the weekly folders of the first year of age.
+const weekOfAgeFormat = "Week %02d"
+
+// folderNameByWeekOfAge names the folder after the week of age day is in,
+// counted from 1. The one or two days after the 52nd week and before the first
+// birthday are counted in it rather than in a week of their own.
+func folderNameByWeekOfAge(day time.Time) string {
+	week := int(day.Sub(birthday).Hours()/24)/7 + 1
+	if week > 52 {
+		week = 52
+	}
+
+	return fmt.Sprintf(weekOfAgeFormat, week)
+}
+
+func folderNameByBirthday(date time.Time, file string) (string, error) {
 	deltaYear := date.Year() - birthday.Year()
 	deltaMonth := date.Month() - birthday.Month()
 
 	monthAfterBirth := int(deltaYear)*12 + int(deltaMonth)
-	if date.Day() >= 16 {
+	if date.Day() >= birthday.Day() {
 		monthAfterBirth += 1
 	}
 
-	if monthAfterBirth < 0 {
-		return "", errors.New("pclassify: error: the date photo taken is earlier than birthday")
+	if monthAfterBirth < 1 {
+		return beforeBirthFolder, nil
+	}
+
+	day := time.Date(date.Year(), date.Month(), date.Day(), 0, 0, 0, 0, time.UTC)
+	if weeklyFirstYear && day.Before(birthday.AddDate(1, 0, 0)) {
+		return folderNameByWeekOfAge(day), nil
 	}
 
 	yearTag := monthAfterBirth / 12
@@ -212,91 +1000,596 @@ func makeFolderByBirthday(target string, date time.Time, file string) (string, e
 	dateString := ""
 	extName := strings.ToLower(filepath.Ext(file))
 	switch {
-	case extName == ".jpg" || extName == ".cr2":
-		dateString = fmt.Sprintf("%d岁%d月照", yearTag, monthTag)
-	case extName == ".mp4" || extName == ".mov" || extName == ".3gp":
-		dateString = fmt.Sprintf("%d岁%d月视频", yearTag, monthTag)
+	case imageExtensions[extName]:
+		dateString = fmt.Sprintf(birthdayPhotoFormat, yearTag, monthTag)
+	case videoExtensions[extName]:
+		dateString = fmt.Sprintf(birthdayVideoFormat, yearTag, monthTag)
 	}
 
-	folderPath := filepath.Join(target, dateString)
+	return dateString, nil
+}
+
+func folderNameByDate(date time.Time) string {
+	return date.Format("2006-01-02")
+}
 
-	if pcopylib.IsFileExist(folderPath) != pcopylib.FileExistStatus_Directory {
-		os.Mkdir(folderPath, os.ModePerm|os.ModeDir)
+// folderNameByWeek names the folder after the ISO week, whose year differs
+// from the calendar year for days around new year, 2021-01-01 is in 2020-W53.
+func folderNameByWeek(date time.Time) string {
+	year, week := date.ISOWeek()
+	return fmt.Sprintf("%d-W%02d", year, week)
+}
+
+// folderNameBySeason names the folder after the meteorological season, the
+// one spanning new year is counted in the year it starts, so January 2024 is
+// in 2023-Winter.
+func folderNameBySeason(date time.Time) string {
+	seasons := []string{"Winter", "Spring", "Summer", "Autumn"}
+	if southHemisphere {
+		seasons = []string{"Summer", "Autumn", "Winter", "Spring"}
 	}
 
-	if pcopylib.IsFileExist(folderPath) != pcopylib.FileExistStatus_Directory {
-		return "", errors.New("pclassify: error: make folder by month failed")
+	year := date.Year()
+	if date.Month() < time.March {
+		year -= 1
 	}
 
-	return folderPath, nil
+	return fmt.Sprintf("%d-%s", year, seasons[int(date.Month())%12/3])
 }
 
-func makeFolderByDate(target string, date time.Time) (string, error) {
-	dateString := date.Format("2006-01-02")
-	folderPath := filepath.Join(target, dateString)
+func folderNameByWeekday(date time.Time) string {
+	return date.Weekday().String()
+}
 
-	if pcopylib.IsFileExist(folderPath) != pcopylib.FileExistStatus_Directory {
-		os.Mkdir(folderPath, os.ModePerm|os.ModeDir)
+// belowRatingCount is the number of files left out by -min-rating.
+var belowRatingCount int64 = 0
+
+// isRatedEnough reports whether file is rated at least minRating, taking an
+// unrated file as 0 unless -unrated-pass is set.
+func isRatedEnough(file string) bool {
+	getRating := pclassifylib.GetRating
+	if isArchiveEntry(file) {
+		getRating = getArchiveRating
 	}
 
-	if pcopylib.IsFileExist(folderPath) != pcopylib.FileExistStatus_Directory {
-		return "", errors.New("pclassify: error: make folder by month failed")
+	rating, ok := getRating(file)
+	if !ok {
+		return unratedPass
 	}
 
-	return folderPath, nil
+	return rating >= minRating
 }
 
-func classify(file, target string, copyMode, fullHashMode bool, classifyMode typeClassifyMode) error {
-	err, date := getDateFromExif(file)
+var (
+	squareTolerance float64 = 0.05
+	panoramaRatio   float64 = 2
+)
+
+// orientationFolders are the folders of orientation mode, photos whose size
+// can not be read go to the last one.
+var orientationFolders = []string{"Portrait", "Landscape", "Square", "Panorama", "Unknown"}
+
+func folderNameByOrientation(file string) string {
+	width, height, err := pclassifylib.GetDimensions(file)
 	if err != nil {
-		err, date = getDateFromModifyTime(file)
+		return orientationFolders[4]
+	}
+
+	ratio := float64(width) / float64(height)
+	switch {
+	case ratio >= panoramaRatio || 1/ratio >= panoramaRatio:
+		return orientationFolders[3]
+	case math.Abs(ratio-1) <= squareTolerance:
+		return orientationFolders[2]
+	case width > height:
+		return orientationFolders[1]
+	}
+
+	return orientationFolders[0]
+}
+
+// softwareEditors maps what the EXIF Software of photos saved by editors
+// contains, lower cased, to the folder of software mode they go to. Photos
+// without Software, or with that of a camera, go to the first of
+// softwareFolders.
+var softwareEditors = []struct {
+	match  string
+	folder string
+}{
+	{"lightroom", "Lightroom"},
+	{"photoshop", "Photoshop"},
+	{"capture one", "Capture One"},
+	{"darktable", "darktable"},
+	{"gimp", "GIMP"},
+	{"affinity", "Affinity Photo"},
+	{"snapseed", "Snapseed"},
+	{"vsco", "VSCO"},
+	{"picasa", "Picasa"},
+	{"luminar", "Luminar"},
+	{"dxo", "DxO"},
+}
+
+// softwareFolders are the folders of software mode.
+var softwareFolders = func() []string {
+	folders := []string{"Original"}
+	for _, editor := range softwareEditors {
+		folders = append(folders, editor.folder)
+	}
+	return folders
+}()
+
+func folderNameBySoftware(file string) string {
+	software, ok := pclassifylib.GetSoftware(file)
+	if !ok {
+		return softwareFolders[0]
 	}
 
+	software = strings.ToLower(software)
+	for _, editor := range softwareEditors {
+		if strings.Contains(software, editor.match) {
+			return editor.folder
+		}
+	}
+
+	return softwareFolders[0]
+}
+
+var (
+	focalWide int = 35
+	focalTele int = 70
+)
+
+// parseFocalRanges parses the boundaries of the focal ranges written like
+// 35,70.
+func parseFocalRanges(value string) (int, int, error) {
+	fields := strings.Split(value, ",")
+	if len(fields) != 2 {
+		return 0, 0, errors.New("expected wide,tele")
+	}
+
+	wide, err := strconv.Atoi(strings.TrimSpace(fields[0]))
 	if err != nil {
-		return err
+		return 0, 0, err
+	}
+	tele, err := strconv.Atoi(strings.TrimSpace(fields[1]))
+	if err != nil {
+		return 0, 0, err
 	}
 
-	folderPath := ""
+	if wide <= 0 || tele < wide {
+		return 0, 0, errors.New("expected 0 < wide <= tele")
+	}
+	return wide, tele, nil
+}
+
+// unknownFocalFolder is where focal mode puts photos without a focal length.
+const unknownFocalFolder = "Unknown Focal"
+
+func folderNameByFocal(file string) string {
+	focal, ok := pclassifylib.GetFocalLength(file)
+	switch {
+	case !ok:
+		return unknownFocalFolder
+	case focal < float64(focalWide):
+		return fmt.Sprintf("Wide (<%dmm)", focalWide)
+	case focal > float64(focalTele):
+		return fmt.Sprintf("Tele (>%dmm)", focalTele)
+	}
+
+	return fmt.Sprintf("Normal (%d-%dmm)", focalWide, focalTele)
+}
+
+// megapixelTiers are the ascending boundaries between the tiers of megapixel
+// mode.
+var megapixelTiers = []float64{5, 12, 24}
+
+// parseMegapixelTiers parses tier boundaries written like 5,12,24.
+func parseMegapixelTiers(value string) ([]float64, error) {
+	tiers := []float64{}
+	for _, field := range strings.Split(value, ",") {
+		tier, err := strconv.ParseFloat(strings.TrimSpace(field), 64)
+		if err != nil {
+			return nil, err
+		}
+
+		if tier <= 0 || (len(tiers) != 0 && tier <= tiers[len(tiers)-1]) {
+			return nil, errors.New("expected ascending boundaries above 0")
+		}
+		tiers = append(tiers, tier)
+	}
+
+	return tiers, nil
+}
+
+// otherMegapixelFolder is where megapixel mode puts files whose size can not
+// be read.
+const otherMegapixelFolder = "Other"
+
+func folderNameByMegapixels(file string) string {
+	megapixels, ok := pclassifylib.GetMegapixels(file)
+	if !ok {
+		return otherMegapixelFolder
+	}
+
+	format := func(tier float64) string {
+		return strconv.FormatFloat(tier, 'f', -1, 64)
+	}
+
+	if megapixels < megapixelTiers[0] {
+		return fmt.Sprintf("<%sMP", format(megapixelTiers[0]))
+	}
+	for i := 1; i < len(megapixelTiers); i++ {
+		if megapixels < megapixelTiers[i] {
+			return fmt.Sprintf("%s-%sMP", format(megapixelTiers[i-1]), format(megapixelTiers[i]))
+		}
+	}
+
+	return fmt.Sprintf(">%sMP", format(megapixelTiers[len(megapixelTiers)-1]))
+}
+
+// getFolderName returns the name of the folder file taken at date is
+// classified into, without touching the file system.
+func getFolderName(file string, date time.Time, classifyMode typeClassifyMode) (string, error) {
 	switch classifyMode {
 	case monthMode:
-		folderPath, err = makeFolderByMonth(target, date)
+		return folderNameByMonth(date), nil
 	case yearMode:
-		folderPath, err = makeFolderByYear(target, date)
+		return folderNameByYear(date), nil
 	case birthdayMode:
-		folderPath, err = makeFolderByBirthday(target, date, file)
+		return folderNameByBirthday(date, file)
 	case dateMode:
-		folderPath, err = makeFolderByDate(target, date)
+		return folderNameByDate(date), nil
+	case weekMode:
+		return folderNameByWeek(date), nil
+	case seasonMode:
+		return folderNameBySeason(date), nil
+	case weekdayMode:
+		return folderNameByWeekday(date), nil
+	case orientationMode:
+		return folderNameByOrientation(file), nil
+	case softwareMode:
+		return folderNameBySoftware(file), nil
+	case focalMode:
+		return folderNameByFocal(file), nil
+	case megapixelMode:
+		return folderNameByMegapixels(file), nil
+	}
+
+	return "", nil
+}
+
+// rawExtensions are the extensions of RAW photos, split from JPEG ones by
+// -raw-jpeg-split.
+var rawExtensions = map[string]bool{".cr2": true, ".dng": true, ".nef": true, ".arw": true}
+
+// getSplitSubfolder returns the subfolder of its folder file goes to with
+// -raw-jpeg-split, "" for the folder itself.
+func getSplitSubfolder(file string) string {
+	extName := strings.ToLower(filepath.Ext(file))
+	switch {
+	case rawExtensions[extName]:
+		return "raw"
+	case extName == ".jpg" || extName == ".jpeg":
+		return "jpg"
+	case videoExtensions[extName]:
+		return videoSubfolder
+	}
+
+	return ""
+}
+
+func makeFolder(target, folderName string) (string, error) {
+	folderPath := filepath.Join(target, folderName)
+
+	pcopylib.MkdirAll(folderPath)
+
+	if pcopylib.IsTargetExist(folderPath) != pcopylib.FileExistStatus_Directory {
+		return "", errors.New(fmt.Sprintf("pclassify: error: make folder %s failed", folderName))
+	}
+
+	return folderPath, nil
+}
+
+// getAlbumPrefix returns the name of the source subdirectory file is in,
+// followed by an underscore, or "" for files directly in source.
+func getAlbumPrefix(file string) string {
+	parent := filepath.Dir(file)
+	if parent == filepath.Clean(source) {
+		return ""
+	}
+
+	return filepath.Base(parent) + "_"
+}
+
+// applyPathCase returns folderName in the case -path-case asks for.
+func applyPathCase(folderName string) string {
+	switch pathCase {
+	case "lower":
+		return strings.ToLower(folderName)
+	case "upper":
+		return strings.ToUpper(folderName)
+	}
+
+	return folderName
+}
+
+// resolveTarget returns the name of the folder under target file is
+// classified into, in the case -path-case asks for, and the name it gets
+// there.
+func resolveTarget(file string, classifyMode typeClassifyMode) (string, string, error) {
+	folderName, fileName, err := resolveFolder(file, classifyMode)
+	return applyPathCase(folderName), fileName, err
+}
+
+func resolveFolder(file string, classifyMode typeClassifyMode) (string, string, error) {
+	if isScreenshotFile(file) {
+		return screenshotsDir, pcopylib.EncodeName(filepath.Base(file)), nil
+	}
+
+	if !isMediaFile(file) {
+		return otherDir, pcopylib.EncodeName(filepath.Base(file)), nil
+	}
+
+	date, err := resolveCaptureTime(file)
+	if err != nil {
+		return "", "", err
+	}
+
+	if len(outTemplate) != 0 {
+		path, err := expandOutTemplate(outTemplate, file, date)
+		if err != nil {
+			return "", "", err
+		}
+		return filepath.Dir(path), filepath.Base(path), nil
+	}
+
+	folderName, err := getFolderName(file, date, classifyMode)
+	if err != nil {
+		return "", "", err
+	}
+
+	if folderName == beforeBirthFolder {
+		atomic.AddInt64(&beforeBirthCount, 1)
+	}
+
+	if albumPrefix && len(folderName) != 0 {
+		folderName = getAlbumPrefix(file) + folderName
+	}
+
+	if overfullFolders[folderName] {
+		folderName = filepath.Join(folderName, getSubPeriodFolder(date, classifyMode))
 	}
 
+	fileName := pcopylib.EncodeName(filepath.Base(file))
+	if renameMode {
+		fileName = getCaptureTimeName(file, date)
+	}
+
+	return folderName, fileName, nil
+}
+
+func classify(file, target string, copyMode, fullHashMode bool, classifyMode typeClassifyMode) error {
+	folderName, fileName, err := resolveTarget(file, classifyMode)
 	if err != nil {
 		return err
 	}
 
-	targetFile := filepath.Join(folderPath, filepath.Base(file))
-	err = pcopylib.CopyFile(file, targetFile, !copyMode, fullHashMode)
+	if len(outTemplate) == 0 {
+		folderName = findExistingFolder(target, folderName, classifyMode, mergeExisting, mergeSmart)
+	}
+	if rawJpegSplit {
+		folderName = filepath.Join(folderName, applyPathCase(getSplitSubfolder(file)))
+	}
+
+	folderPath, err := makeFolder(target, folderName)
 	if err != nil {
 		return err
 	}
 
+	// read before a move takes the photo away
+	var thumb []byte
+	hasThumb := false
+	if len(extractThumb) != 0 {
+		thumb, hasThumb = pclassifylib.GetExifThumbnail(file)
+	}
+
+	// the date goes into a copy of the source, which copy mode leaves alone
+	copySource := file
+	if writeExif {
+		exifDate, hasExifDate, err := exifDateToWrite(file)
+		if err != nil {
+			pcopylib.Outputf(file, "pclassify: warning: %s: %s, exif not written\n", file, err)
+		}
+
+		if hasExifDate {
+			staged, err := stageExifDate(file, exifDate)
+			if err != nil {
+				pcopylib.Outputf(file, "pclassify: warning: %s: write exif failed, %s\n", file, err)
+			} else {
+				defer os.RemoveAll(filepath.Dir(staged))
+				pcopylib.OutputAlias(staged, file)
+				copySource = staged
+			}
+		}
+	}
+
+	targetFile := filepath.Join(folderPath, fileName)
+	written, err := pcopylib.CopyFileTo(copySource, targetFile, !copyMode, fullHashMode)
+	if err != nil {
+		return err
+	}
+
+	// moving the copy leaves the source to remove once it is classified
+	if copySource != file && !copyMode && len(written) != 0 {
+		os.Remove(file)
+	}
+
+	if hasThumb && len(written) != 0 {
+		if err := writeExifThumbnail(thumb, target, written); err != nil {
+			pcopylib.Outputf(file, "pclassify: warning: %s: extract thumbnail failed, %s\n", file, err)
+		}
+	}
+
+	// companions follow where the primary was written, (1) and all
+	if len(written) != 0 {
+		classifySidecars(file, written, copyMode, fullHashMode)
+	}
+	if galleryMode {
+		galleryFolders.add(filepath.Dir(targetFile))
+	}
 	return nil
 }
 
-func main() {
-	runtime.GOMAXPROCS(runtime.NumCPU())
+// stopFailure tells what file failed with for -on-error stop to report,
+// without the prefix the error was printed with.
+func stopFailure(file string, err error) error {
+	message := strings.TrimPrefix(err.Error(), "pclassify: error: ")
+	return fmt.Errorf("%s: %s", file, strings.TrimPrefix(message, "pcopy: error: "))
+}
 
+// notifyWebhook posts the summary of the run to -webhook, only warning when
+// it fails.
+func notifyWebhook(status string, elapsed time.Duration) {
+	if len(webhook) == 0 {
+		return
+	}
+
+	if err := pcopylib.PostWebhook(webhook, status, elapsed); err != nil {
+		fmt.Printf("pclassify: warning: %s: webhook failed, %s\n", webhook, err)
+	}
+}
+
+// notifyOnInterrupt posts an interrupted run to -webhook before exiting.
+func notifyOnInterrupt(startTime time.Time) {
+	if len(webhook) == 0 {
+		return
+	}
+
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-interrupt
+		notifyWebhook("interrupted", time.Since(startTime))
+		os.Exit(130)
+	}()
+}
+
+// run classifies source into target and returns the exit status, so that
+// what it defers, like unlocking the source, is done before main exits.
+func run() int {
 	if err := parseArgs(); err != nil {
 		fmt.Println(err)
-		os.Exit(1)
+		return 1
+	}
+
+	if len(doctorFile) != 0 {
+		if pcopylib.IsFileExist(doctorFile) != pcopylib.FileExistStatus_File {
+			fmt.Println(shortUsage(fmt.Sprintf("pclassify: error: %s: No such file", doctorFile)))
+			return 1
+		}
+
+		runDoctor(doctorFile)
+		return 0
 	}
 
-	if pcopylib.IsFileExist(source) != pcopylib.FileExistStatus_Directory {
+	archiveSource := isArchive(source) && pcopylib.IsFileExist(source) == pcopylib.FileExistStatus_File
+	if archiveSource {
+		if err := checkArchiveSource(); err != nil {
+			fmt.Println(shortUsage(err.Error()))
+			return 1
+		}
+
+		// entries are copied out of the archive, which is left as it is
+		copyMode = true
+	} else if pcopylib.IsFileExist(source) != pcopylib.FileExistStatus_Directory {
 		fmt.Println(shortUsage(fmt.Sprintf("pclassify: error: %s: No such directory", source)))
-		os.Exit(1)
+		return 1
+	} else {
+		source = pcopylib.ResolveDirLink(source)
+	}
+
+	if extStatsMode {
+		runExtStats(source)
+		return 0
 	}
 
 	if pcopylib.IsFileExist(target) != pcopylib.FileExistStatus_Directory {
 		fmt.Println(shortUsage(fmt.Sprintf("pclassify: error: %s: No such directory", target)))
-		os.Exit(1)
+		return 1
+	}
+
+	if !copyMode && !planMode && !countOnly && !dupScanMode && pcopylib.IsReadOnlyDir(source) {
+		fmt.Printf("pclassify: warning: %s: read-only, copying instead of moving\n", source)
+		copyMode = true
+	}
+
+	if !copyMode && !planMode && !countOnly && !dupScanMode {
+		if err := pcopylib.LockDir(source); err != nil {
+			fmt.Println(shortUsage(fmt.Sprintf("pclassify: error: %s: %s", source, err)))
+			return 1
+		}
+		defer pcopylib.UnlockDir(source)
+	}
+
+	if len(clashLog) != 0 {
+		if err := pcopylib.OpenClashLog(clashLog); err != nil {
+			fmt.Println(shortUsage(fmt.Sprintf("pclassify: error: %s: Can not create rename clashes log", clashLog)))
+			return 1
+		}
+		defer pcopylib.CloseClashLog()
+	}
+
+	if len(eventsFile) != 0 {
+		if err := pcopylib.OpenEventLog(eventsFile); err != nil {
+			fmt.Println(shortUsage(fmt.Sprintf("pclassify: error: %s: Can not create events file", eventsFile)))
+			return 1
+		}
+		defer pcopylib.CloseEventLog()
+	}
+
+	if len(stateFile) != 0 {
+		if err := pcopylib.OpenRunState(stateFile); err != nil {
+			fmt.Println(shortUsage(fmt.Sprintf("pclassify: error: %s: Can not open state file", stateFile)))
+			return 1
+		}
+		defer pcopylib.CloseRunState()
+	}
+
+	if len(hashCache) != 0 {
+		if err := pcopylib.OpenHashCache(hashCache); err != nil {
+			fmt.Println(shortUsage(fmt.Sprintf("pclassify: error: %s: read hash cache failed, %s", hashCache, err)))
+			return 1
+		}
+		defer func() {
+			if err := pcopylib.CloseHashCache(); err != nil {
+				fmt.Printf("pclassify: error: %s: write hash cache failed\n", hashCache)
+			}
+		}()
+	}
+
+	if dupScanMode {
+		if sourceInfo, err := os.Stat(source); err == nil {
+			if targetInfo, err := os.Stat(target); err == nil && os.SameFile(sourceInfo, targetInfo) {
+				fmt.Println(shortUsage("pclassify: error: argument -dup-scan: destPath expected, other than sourcePath"))
+				return 1
+			}
+		}
+
+		runDupScan(source, target)
+		return 0
+	}
+
+	pcopylib.CollisionRoot = target
+	startTime := time.Now()
+	notifyOnInterrupt(startTime)
+
+	sourceDups := map[string]string{}
+	if dedupSource {
+		sourceDups = findSourceDups(source, target)
+	}
+
+	if maxPerFolder > 0 {
+		overfullFolders = findOverfullFolders(source, target)
 	}
 
 	jobsNum := 1
@@ -304,41 +1597,384 @@ func main() {
 		jobsNum = 20
 	}
 
-	classifyJob := make(chan string, jobsNum)
-	classifyDone := make(chan struct{}, jobsNum)
+	plan := newFolderPlan()
+	counts := newFolderCounts()
+
+	// Plans and counts handle files too fast for completions to tell anything.
+	var tracker *pcopylib.DirTracker
+	if pcopylib.DirProgress && recursiveMode && !planMode && !countOnly && !archiveSource {
+		tracker = pcopylib.NewDirTracker(source)
+	}
+
+	// classifyFile returns the first failure among the file and whatever was
+	// unpacked from it.
+	classifyFile := func(file string) error {
+		if planMode {
+			folderName, _, err := resolveTarget(file, classifyMode)
+			if err != nil {
+				pcopylib.RunStats.AddFailed()
+			} else {
+				plan.add(folderName)
+			}
+			pcopylib.OutputDone(file)
+			return nil
+		}
+
+		if countOnly {
+			counts.add(file)
+			pcopylib.OutputDone(file)
+			return nil
+		}
+
+		// archive entries are only written out once their turn comes
+		if archiveSource {
+			if err := stageArchiveFile(file); err != nil {
+				pcopylib.Outputf(file, "%s: %s\n", file, err)
+				pcopylib.RunStats.AddFailed()
+				pcopylib.LogFailure(file, err)
+				pcopylib.OutputDone(file)
+				return stopFailure(file, err)
+			}
+		}
+
+		if unpackLivp && pclassifylib.IsLivp(file) {
+			parts, err := unpackLivpFile(file)
+			if err != nil {
+				pcopylib.Outputf(file, "%s\n", err)
+			}
+
+			if len(parts) != 0 {
+				var failure error
+				for _, part := range parts {
+					pcopylib.OutputAlias(part, file)
+					pcopylib.RunStats.AddScanned()
+					if err := classify(part, target, copyMode, fullHashMode, classifyMode); err != nil {
+						if !pcopylib.IsReported(err) {
+							pcopylib.Outputf(file, "%s: %s\n", part, err)
+							pcopylib.RunStats.AddFailed()
+							pcopylib.LogFailure(part, err)
+						}
+						if failure == nil {
+							failure = stopFailure(part, err)
+						}
+					}
+				}
+				os.RemoveAll(filepath.Dir(parts[0]))
+
+				// the package goes once all it held has been moved
+				if !copyMode && failure == nil {
+					os.Remove(file)
+				}
+
+				if tracker != nil {
+					tracker.Done(file)
+				}
+				pcopylib.OutputDone(file)
+				return failure
+			}
+		}
+
+		var failure error
+		if extractMotion {
+			video, err := extractMotionVideo(file)
+			if err != nil {
+				pcopylib.Outputf(file, "%s\n", err)
+			}
+
+			if len(video) != 0 {
+				pcopylib.OutputAlias(video, file)
+				pcopylib.RunStats.AddScanned()
+				if err := classify(video, target, copyMode, fullHashMode, classifyMode); err != nil {
+					if !pcopylib.IsReported(err) {
+						pcopylib.Outputf(file, "%s: %s\n", video, err)
+						pcopylib.RunStats.AddFailed()
+						pcopylib.LogFailure(video, err)
+					}
+					failure = stopFailure(video, err)
+				}
+				os.RemoveAll(filepath.Dir(video))
+			}
+		}
+
+		if err := classify(file, target, copyMode, fullHashMode, classifyMode); err != nil {
+			if !pcopylib.IsReported(err) {
+				pcopylib.Outputf(file, "%s: %s\n", file, err)
+				pcopylib.RunStats.AddFailed()
+				pcopylib.LogFailure(file, err)
+			}
+			if failure == nil {
+				failure = stopFailure(file, err)
+			}
+		}
+
+		// staged archive entries go once classified
+		if archiveSource {
+			os.Remove(file)
+		}
+
+		if tracker != nil {
+			tracker.Done(file)
+		}
+		pcopylib.OutputDone(file)
+		return failure
+	}
+
+	group, ctx := errgroup.WithContext(context.Background())
+	group.SetLimit(jobsNum)
+	queueFile := func(file string) {
+		group.Go(func() error {
+			if ctx.Err() != nil {
+				if tracker != nil {
+					tracker.Done(file)
+				}
+				pcopylib.OutputDone(file)
+				return nil
+			}
+
+			// stat before a move takes the file away
+			info, _ := os.Lstat(file)
+			err := classifyFile(file)
+			if err == nil && !planMode && !countOnly {
+				pcopylib.RecordDone(file, info)
+			}
 
-	for i := 0; i < jobsNum; i++ {
-		go func(classifyDone chan<- struct{}, classifyJob <-chan string) {
-			for file := range classifyJob {
-				classify(file, target, copyMode, fullHashMode, classifyMode)
+			if err != nil && pcopylib.OnError == pcopylib.ErrorPolicy_Stop {
+				return err
 			}
+			return nil
+		})
+	}
 
-			classifyDone <- struct{}{}
-		}(classifyDone, classifyJob)
+	dirList := make([]string, 0, 100)
+	renameFiles := make([]string, 0, 100)
+
+	targetInfo, _ := os.Stat(target)
+	var thumbInfo os.FileInfo
+	if len(extractThumb) != 0 && !planMode && !countOnly {
+		os.MkdirAll(extractThumb, 0755)
+		thumbInfo, _ = os.Stat(extractThumb)
 	}
+	var walkMutex sync.Mutex
+	walkFn := func(path string, info os.FileInfo, err error) error {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		if err != nil {
+			pcopylib.OutputNote("pclassify: warning: %s: read failed, skipped\n", path)
+			return nil
+		}
+
+		// The parallel walk is in no particular order, its directories are
+		// only sealed once it is over.
+		if tracker != nil && !parallelMode {
+			tracker.Enter(path, info.IsDir())
+		}
 
-	filepath.Walk(source, func(path string, info os.FileInfo, err error) error {
 		if source == path {
 			return nil
 		}
 
 		if info.IsDir() {
-			return filepath.SkipDir
+			if !recursiveMode {
+				return filepath.SkipDir
+			}
+
+			if targetInfo != nil && os.SameFile(info, targetInfo) {
+				pcopylib.OutputNote("pclassify: warning: %s: destination path inside source path, skipped\n", path)
+				return filepath.SkipDir
+			}
+
+			// thumbnails of -gallery and -extract-thumb are not photos of their
+			// own
+			if info.Name() == thumbnailsDir || (thumbInfo != nil && os.SameFile(info, thumbInfo)) {
+				return filepath.SkipDir
+			}
+
+			if skipSorted && (isClassifiedFolder(info.Name(), classifyMode) || strings.EqualFold(info.Name(), otherDir) || strings.EqualFold(info.Name(), screenshotsDir)) {
+				pcopylib.OutputNote("pclassify: warning: %s: already classified, skipped\n", path)
+				return filepath.SkipDir
+			}
+
+			walkMutex.Lock()
+			dirList = append(dirList, path)
+			walkMutex.Unlock()
+			return nil
 		}
 
-		extName := strings.ToLower(filepath.Ext(path))
-		if extName != ".jpg" && extName != ".cr2" && extName != ".mp4" && extName != ".mov" && extName != ".3gp" {
+		if info.Name() == pcopylib.LockFileName {
 			return nil
 		}
 
-		classifyJob <- path
+		// camera companions go along with the file they belong to
+		if isSidecarFile(path) {
+			return nil
+		}
+
+		if !isMediaFile(path) && !isScreenshotFile(path) {
+			if len(otherDir) == 0 || !info.Mode().IsRegular() || isHiddenFile(path) || isGalleryFile(path) {
+				return nil
+			}
+		} else if minRating > 0 && !isRatedEnough(path) {
+			atomic.AddInt64(&belowRatingCount, 1)
+			return nil
+		}
+
+		if pcopylib.IsDone(path, info) {
+			return nil
+		}
+
+		if !pcopylib.TakeLimit() {
+			return pcopylib.ErrLimitReached
+		}
+
+		pcopylib.RunStats.AddScanned()
+		if original, ok := sourceDups[path]; ok {
+			pcopylib.OutputQueue(path)
+			pcopylib.SkipRepeated(path, original)
+			pcopylib.OutputDone(path)
+			return nil
+		}
+
+		if tracker != nil {
+			tracker.Add(path)
+		}
+		if renameMode {
+			walkMutex.Lock()
+			renameFiles = append(renameFiles, path)
+			walkMutex.Unlock()
+		} else {
+			pcopylib.OutputQueue(path)
+			queueFile(path)
+		}
 
 		return nil
-	})
+	}
+
+	if archiveSource {
+		cleanup := walkArchiveSource(source, walkFn)
+		defer cleanup()
+	} else if parallelMode {
+		parallelWalk(source, parallelWalkers, walkFn)
+	} else {
+		filepath.Walk(source, walkFn)
+	}
 
-	close(classifyJob)
+	if tracker != nil {
+		tracker.Finish()
+	}
 
-	for i := 0; i < jobsNum; i++ {
-		<-classifyDone
+	renameAborted := false
+	if renameMode {
+		if collisions := previewRenames(renameFiles, target); collisions > 0 && !forceMode {
+			renameAborted = true
+		} else {
+			for _, file := range renameFiles {
+				pcopylib.OutputQueue(file)
+				queueFile(file)
+			}
+		}
+	}
+
+	stopErr := group.Wait()
+
+	if renameAborted {
+		fmt.Println("pclassify: error: planned names collide, nothing done, use -force to proceed anyway")
+		notifyWebhook("aborted", time.Since(startTime))
+		return 1
+	}
+
+	if stopErr != nil {
+		fmt.Printf("pclassify: error: stopped at the first failure, %s\n", stopErr)
+	}
+
+	if planMode {
+		plan.print(target)
+	}
+
+	if countOnly {
+		counts.print(target)
+	}
+
+	if pruneMode && !copyMode && !planMode && !countOnly {
+		pcopylib.RemoveEmptyDirs(dirList)
+	}
+
+	if galleryMode && !planMode && !countOnly {
+		for _, folder := range galleryFolders.list() {
+			if err := writeGallery(folder); err != nil {
+				fmt.Printf("pclassify: warning: %s: write gallery failed, %s\n", folder, err)
+			}
+		}
 	}
+
+	hookFailed := int64(0)
+	if !planMode && !countOnly {
+		hookFailed = pcopylib.FinishHooks(source, target)
+	}
+
+	fmt.Printf("pclassify: %s\n", pcopylib.Summary())
+	if failures := pcopylib.MetadataFailures(); len(failures) != 0 {
+		fmt.Printf("pclassify: %d file(s) whose mtime or mode could not be preserved:\n", len(failures))
+		for _, failure := range failures {
+			fmt.Printf("  %s\n", failure)
+		}
+	}
+	if changed := pcopylib.ChangedFilesFound(); len(changed) != 0 {
+		fmt.Printf("pclassify: %d file(s) modified during copy:\n", len(changed))
+		for _, file := range changed {
+			fmt.Printf("  %s\n", file)
+		}
+	}
+	if empties := pcopylib.EmptyFilesFound(); len(empties) != 0 {
+		fmt.Printf("pclassify: %d empty file(s) found:\n", len(empties))
+		for _, empty := range empties {
+			fmt.Printf("  %s\n", empty)
+		}
+	}
+	if pcopylib.LimitReached() {
+		fmt.Printf("pclassify: stopped after %d file(s), the limit, others left out\n", pcopylib.FileLimit)
+	}
+	if hookFailed > 0 {
+		fmt.Printf("pclassify: %d hook(s) failed\n", hookFailed)
+	}
+	if skipped := pcopylib.StateSkipped(); skipped > 0 {
+		fmt.Printf("pclassify: %d file(s) handled by an earlier run, skipped\n", skipped)
+	}
+	if beforeBirthCount > 0 {
+		fmt.Printf("pclassify: %d photo(s) taken before the birthday, classified into %s\n", beforeBirthCount, applyPathCase(beforeBirthFolder))
+	}
+
+	if belowRatingCount > 0 {
+		fmt.Printf("pclassify: %d file(s) rated below %d, left out\n", belowRatingCount, minRating)
+	}
+
+	if extractedThumbCount > 0 {
+		fmt.Printf("pclassify: %d embedded thumbnail(s) extracted to %s\n", extractedThumbCount, extractThumb)
+	}
+
+	if scanned := pclassifylib.ExifScanned(); scanned > 0 {
+		fmt.Printf("pclassify: %d file(s) whose exif was only found searching further into them\n", scanned)
+	}
+
+	if len(statsJSON) != 0 {
+		if err := pcopylib.WriteStatsJSON(statsJSON, time.Since(startTime)); err != nil {
+			fmt.Printf("pclassify: error: %s: write stats failed\n", statsJSON)
+		}
+	}
+
+	if stopErr != nil || (hookFailed > 0 && pcopylib.HookStrict) {
+		notifyWebhook("aborted", time.Since(startTime))
+		return 1
+	}
+
+	notifyWebhook("finished", time.Since(startTime))
+
+	return 0
+}
+
+func main() {
+	runtime.GOMAXPROCS(runtime.NumCPU())
+	pcopylib.Program = "pclassify"
+	os.Exit(run())
 }
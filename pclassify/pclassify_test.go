@@ -0,0 +1,31 @@
+package main
+
+import (
+	"os"
+	"testing"
+)
+
+func TestParseArgsTrailingSlash(t *testing.T) {
+	defer func(args []string) { os.Args = args }(os.Args)
+
+	tests := []struct {
+		args           []string
+		source, target string
+	}{
+		{[]string{"photos/", "sorted/"}, "photos", "sorted"},
+		{[]string{"photos//", "sorted"}, "photos", "sorted"},
+		{[]string{"./photos/", "sorted/."}, "photos", "sorted"},
+		{[]string{"/photos/", "/sorted//"}, "/photos", "/sorted"},
+	}
+
+	for _, test := range tests {
+		os.Args = append([]string{"pclassify"}, test.args...)
+		if err := parseArgs(); err != nil {
+			t.Errorf("parseArgs(%q): %s", test.args, err)
+			continue
+		}
+		if source != test.source || target != test.target {
+			t.Errorf("parseArgs(%q): source %s, target %s, want %s, %s", test.args, source, target, test.source, test.target)
+		}
+	}
+}
@@ -0,0 +1,235 @@
+package pclassifylib
+
+import (
+	"errors"
+	"fmt"
+	"github.com/rwcarlsen/goexif/exif"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Source is where the capture time of a file was read from.
+type Source int
+
+const (
+	Source_DateTimeOriginal Source = iota
+	Source_DateTimeDigitized
+	Source_DateTime
+	Source_Video
+	Source_Filename
+	Source_ModTime
+)
+
+func (s Source) String() string {
+	switch s {
+	case Source_DateTimeOriginal:
+		return "EXIF DateTimeOriginal"
+	case Source_DateTimeDigitized:
+		return "EXIF DateTimeDigitized"
+	case Source_DateTime:
+		return "EXIF DateTime"
+	case Source_Video:
+		return "video metadata"
+	case Source_Filename:
+		return "file name"
+	case Source_ModTime:
+		return "modification time"
+	}
+
+	return "unknown"
+}
+
+// Location is the time zone capture times are resolved in. EXIF dates carry
+// no zone and are taken as wall clock time in it.
+var Location *time.Location = time.Local
+
+type exifDateTag struct {
+	tag    exif.FieldName
+	source Source
+}
+
+// knownExifDateTags are the EXIF tags a date a photo was taken can be read
+// from, in the order they are tried by default.
+var knownExifDateTags = []exifDateTag{
+	{exif.DateTimeOriginal, Source_DateTimeOriginal},
+	{exif.DateTimeDigitized, Source_DateTimeDigitized},
+	{exif.DateTime, Source_DateTime},
+}
+
+// exifDateTags are the EXIF tags tried in turn for the date a photo was taken.
+var exifDateTags = knownExifDateTags
+
+// DateTagNames returns the names of the EXIF tags SetDateTags accepts.
+func DateTagNames() []string {
+	names := make([]string, 0, len(knownExifDateTags))
+	for _, dateTag := range knownExifDateTags {
+		names = append(names, string(dateTag.tag))
+	}
+
+	return names
+}
+
+// SetDateTags makes the EXIF tags named in a comma separated list, like
+// "DateTimeOriginal,DateTime", the ones tried in turn for the date a photo was
+// taken, in place of all of them in the default order.
+func SetDateTags(list string) error {
+	dateTags := []exifDateTag{}
+
+	for _, name := range strings.Split(list, ",") {
+		name = strings.TrimSpace(name)
+
+		found := false
+		for _, dateTag := range knownExifDateTags {
+			if string(dateTag.tag) == name {
+				dateTags = append(dateTags, dateTag)
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			return errors.New(fmt.Sprintf("unknown date tag %s", name))
+		}
+	}
+
+	exifDateTags = dateTags
+	return nil
+}
+
+// videoExtensions are the extensions of files whose metadata is read as an
+// ISO base media (MP4 or QuickTime) container.
+var videoExtensions = map[string]bool{".mp4": true, ".mov": true, ".3gp": true, ".m4v": true}
+
+func getExifDate(file string) (time.Time, Source, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return time.Time{}, 0, err
+	}
+	defer f.Close()
+
+	x, err := decodeExif(f)
+	if err != nil {
+		return time.Time{}, 0, err
+	}
+
+	return getExifDateOf(x)
+}
+
+func getModTime(file string) (time.Time, Source, error) {
+	fi, err := os.Stat(file)
+	if err != nil {
+		return time.Time{}, 0, err
+	}
+
+	return fi.ModTime().In(Location), Source_ModTime, nil
+}
+
+// getEmbeddedExifDate reads the EXIF date tags of path, of the still for heic
+// files and live photo packages.
+func getEmbeddedExifDate(path string) (time.Time, Source, error) {
+	if t, source, err := getExifDate(path); err == nil {
+		return t, source, nil
+	}
+
+	if isHeic(path) {
+		return getHeicDate(path)
+	}
+
+	if IsLivp(path) {
+		return getLivpDate(path)
+	}
+
+	return time.Time{}, 0, errors.New("no EXIF date")
+}
+
+// getContainerDate reads the creation time of video containers.
+func getContainerDate(path string) (time.Time, Source, error) {
+	if !videoExtensions[strings.ToLower(filepath.Ext(path))] {
+		return time.Time{}, 0, errors.New("not a video")
+	}
+
+	return getVideoDate(path)
+}
+
+type dateSource struct {
+	name    string
+	resolve func(path string) (time.Time, Source, error)
+}
+
+// knownDateSources are the sources a capture time can be read from, in the
+// order they are tried by default.
+var knownDateSources = []dateSource{
+	{"exif", getEmbeddedExifDate},
+	{"video", getContainerDate},
+	{"filename", getFilenameDate},
+	{"mtime", getModTime},
+}
+
+// dateSources are the sources tried in turn for the capture time of a file.
+var dateSources = knownDateSources
+
+// DateSourceNames returns the names of the date sources SetDatePriority
+// accepts.
+func DateSourceNames() []string {
+	names := make([]string, 0, len(knownDateSources))
+	for _, dateSource := range knownDateSources {
+		names = append(names, dateSource.name)
+	}
+
+	return names
+}
+
+// SetDatePriority makes the date sources named in a comma separated list, like
+// "filename,exif,mtime", the ones tried in turn for the capture time of a
+// file, in place of all of them in the default order. Files none of them
+// dates fail to resolve.
+func SetDatePriority(list string) error {
+	sources := []dateSource{}
+
+	for _, name := range strings.Split(list, ",") {
+		name = strings.TrimSpace(name)
+
+		found := false
+		for _, dateSource := range knownDateSources {
+			if dateSource.name == name {
+				for _, added := range sources {
+					if added.name == name {
+						return errors.New(fmt.Sprintf("date source %s given twice", name))
+					}
+				}
+				sources = append(sources, dateSource)
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			return errors.New(fmt.Sprintf("unknown date source %s", name))
+		}
+	}
+
+	dateSources = sources
+	return nil
+}
+
+// ResolveCaptureTime returns when the photo or video at path was taken, and
+// which source that was read from, trying the date sources in turn: by
+// default the EXIF date tags, of the still for live photo packages, then the
+// creation time of video containers, then a date in the file name, then the
+// modification time.
+func ResolveCaptureTime(path string) (time.Time, Source, error) {
+	for _, dateSource := range dateSources {
+		if t, source, err := dateSource.resolve(path); err == nil {
+			return t, source, nil
+		}
+	}
+
+	return time.Now(), Source_ModTime, errors.New(fmt.Sprintf("pclassify: warning: %s: resolve capture time failed", path))
+}
+
+// IsExifSource reports whether source is one of the EXIF date tags.
+func IsExifSource(source Source) bool {
+	return source == Source_DateTimeOriginal || source == Source_DateTimeDigitized || source == Source_DateTime
+}
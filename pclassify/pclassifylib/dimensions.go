@@ -0,0 +1,153 @@
+package pclassifylib
+
+import (
+	"encoding/binary"
+	"errors"
+	"github.com/rwcarlsen/goexif/exif"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// getImageDimensions reads the size of a photo from its header, or from its
+// EXIF for formats image can not decode, like raw files. Photos the EXIF
+// orientation turns a quarter have their width and height swapped.
+func getImageDimensions(file string) (int, int, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer f.Close()
+
+	width, height := 0, 0
+	if config, _, err := image.DecodeConfig(f); err == nil {
+		width, height = config.Width, config.Height
+	}
+
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return 0, 0, err
+	}
+
+	x, err := decodeExif(f)
+	if err == nil {
+		if width == 0 || height == 0 {
+			xTag, xErr := x.Get(exif.PixelXDimension)
+			yTag, yErr := x.Get(exif.PixelYDimension)
+			if xErr == nil && yErr == nil {
+				xValue, xErr := xTag.Int(0)
+				yValue, yErr := yTag.Int(0)
+				if xErr == nil && yErr == nil {
+					width, height = xValue, yValue
+				}
+			}
+		}
+
+		// Orientations 5 to 8 are turned a quarter, mirrored or not.
+		if tag, err := x.Get(exif.Orientation); err == nil {
+			if orientation, err := tag.Int(0); err == nil && orientation >= 5 && orientation <= 8 {
+				width, height = height, width
+			}
+		}
+	}
+
+	if width <= 0 || height <= 0 {
+		return 0, 0, errors.New("no dimensions")
+	}
+
+	return width, height, nil
+}
+
+// getVideoDimensions reads the size of the first visual track of an MP4 or
+// QuickTime file from its track header, swapping width and height when its
+// matrix turns it a quarter, as phones do for portrait videos.
+func getVideoDimensions(file string) (int, int, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	moovSize, err := findBox(f, "moov", fi.Size())
+	if err != nil {
+		return 0, 0, err
+	}
+	moovStart, _ := f.Seek(0, io.SeekCurrent)
+	moovEnd := moovStart + moovSize
+
+	for {
+		trakSize, err := findBox(f, "trak", moovEnd)
+		if err != nil {
+			return 0, 0, err
+		}
+		trakStart, _ := f.Seek(0, io.SeekCurrent)
+		trakEnd := trakStart + trakSize
+
+		tkhdSize, err := findBox(f, "tkhd", trakEnd)
+		if err == nil && tkhdSize >= 84 {
+			tkhd := make([]byte, tkhdSize)
+			if _, err := io.ReadFull(f, tkhd); err != nil {
+				return 0, 0, err
+			}
+
+			// Version 1 headers have 64 bit times and duration, moving the
+			// matrix and size 12 bytes on.
+			offset := 0
+			if tkhd[0] == 1 {
+				offset = 12
+			}
+
+			if len(tkhd) >= offset+84 {
+				matrix := tkhd[offset+40 : offset+76]
+				width := int(binary.BigEndian.Uint32(tkhd[offset+76:]) >> 16)
+				height := int(binary.BigEndian.Uint32(tkhd[offset+80:]) >> 16)
+
+				if width > 0 && height > 0 {
+					if binary.BigEndian.Uint32(matrix[0:4]) == 0 && binary.BigEndian.Uint32(matrix[16:20]) == 0 {
+						width, height = height, width
+					}
+					return width, height, nil
+				}
+			}
+		}
+
+		if _, err := f.Seek(trakEnd, io.SeekStart); err != nil {
+			return 0, 0, err
+		}
+	}
+}
+
+// GetMegapixels returns the millions of pixels of a photo, its size read from
+// its header as getImageDimensions does, or false for videos and files whose
+// size can not be read.
+func GetMegapixels(path string) (float64, bool) {
+	if videoExtensions[strings.ToLower(filepath.Ext(path))] {
+		return 0, false
+	}
+
+	width, height, err := getImageDimensions(path)
+	if err != nil {
+		return 0, false
+	}
+
+	return float64(width) * float64(height) / 1e6, true
+}
+
+// GetDimensions returns the width and height the photo or video at path is
+// shown at.
+func GetDimensions(path string) (int, int, error) {
+	if videoExtensions[strings.ToLower(filepath.Ext(path))] {
+		return getVideoDimensions(path)
+	}
+
+	return getImageDimensions(path)
+}
@@ -0,0 +1,35 @@
+package pclassifylib
+
+import (
+	"github.com/rwcarlsen/goexif/exif"
+	"os"
+	"strings"
+)
+
+// GetExifField returns the EXIF field called name of a photo as text, like
+// Model for the camera it was taken with.
+func GetExifField(path string, name string) (string, bool) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", false
+	}
+	defer f.Close()
+
+	x, err := decodeExif(f)
+	if err != nil {
+		return "", false
+	}
+
+	tag, err := x.Get(exif.FieldName(name))
+	if err != nil || tag == nil {
+		return "", false
+	}
+
+	value, err := tag.StringVal()
+	if err != nil {
+		return "", false
+	}
+
+	value = strings.TrimSpace(strings.TrimRight(value, "\x00"))
+	return value, len(value) != 0
+}
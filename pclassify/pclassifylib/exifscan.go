@@ -0,0 +1,134 @@
+package pclassifylib
+
+import (
+	"bytes"
+	"errors"
+	"github.com/rwcarlsen/goexif/exif"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ExifScanSize is how much of the start of a photo is searched for its EXIF
+// block when decoding it the usual way fails, like when other segments make
+// it start late, 0 not to search.
+var ExifScanSize int64 = 4 << 20
+
+// exifScanExtensions are the extensions of the photos searched for their
+// EXIF block, those holding it after an Exif header. Others, like PNG or
+// videos, are not read further for nothing.
+var exifScanExtensions = map[string]bool{".jpg": true, ".jpeg": true, ".heic": true, ".heif": true, ".cr2": true, ".dng": true, ".nef": true, ".arw": true}
+
+var exifScanned int64
+
+// ExifScanned returns how many photos had their EXIF found only by searching
+// ExifScanSize of them.
+func ExifScanned() int64 {
+	return atomic.LoadInt64(&exifScanned)
+}
+
+// exifCacheSize is how many files the EXIF decoded of is kept for, enough
+// for all the workers reading the date, size and other fields of their file
+// one after the other.
+const exifCacheSize = 64
+
+// decodedExif is the EXIF decoded of a file as it was when decoded.
+type decodedExif struct {
+	once    sync.Once
+	size    int64
+	modTime time.Time
+	x       *exif.Exif
+	err     error
+}
+
+var (
+	exifCacheMutex sync.Mutex
+	exifCache      = map[string]*decodedExif{}
+	exifCacheOrder []string
+)
+
+// cachedExif returns the entry of the EXIF cache for the file named name
+// described by fi, a new one if the file is not in or has changed since.
+func cachedExif(name string, fi os.FileInfo) *decodedExif {
+	exifCacheMutex.Lock()
+	defer exifCacheMutex.Unlock()
+
+	if decoded, ok := exifCache[name]; ok && decoded.size == fi.Size() && decoded.modTime.Equal(fi.ModTime()) {
+		return decoded
+	}
+
+	if _, ok := exifCache[name]; !ok {
+		if len(exifCacheOrder) >= exifCacheSize {
+			delete(exifCache, exifCacheOrder[0])
+			exifCacheOrder = exifCacheOrder[1:]
+		}
+		exifCacheOrder = append(exifCacheOrder, name)
+	}
+
+	decoded := &decodedExif{size: fi.Size(), modTime: fi.ModTime()}
+	exifCache[name] = decoded
+	return decoded
+}
+
+// decodeExif decodes the EXIF of the photo open in f, once for all the fields
+// read from it.
+func decodeExif(f *os.File) (*exif.Exif, error) {
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	decoded := cachedExif(f.Name(), fi)
+	decoded.once.Do(func() {
+		decoded.x, decoded.err = decodeExifFile(f)
+	})
+	return decoded.x, decoded.err
+}
+
+// decodeExifFile decodes the EXIF of the photo open in f, searching the start
+// of it for the EXIF block when decoding fails and its format may hold one.
+func decodeExifFile(f *os.File) (*exif.Exif, error) {
+	x, err := exif.Decode(f)
+	if err == nil || ExifScanSize == 0 || !exifScanExtensions[strings.ToLower(filepath.Ext(f.Name()))] {
+		return x, err
+	}
+
+	if _, seekErr := f.Seek(0, io.SeekStart); seekErr != nil {
+		return nil, err
+	}
+
+	data, readErr := ioutil.ReadAll(io.LimitReader(f, ExifScanSize))
+	if readErr != nil {
+		return nil, err
+	}
+
+	if scanned, scanErr := scanExif(data); scanErr == nil {
+		atomic.AddInt64(&exifScanned, 1)
+		return scanned, nil
+	}
+
+	return nil, err
+}
+
+// scanExif decodes the first EXIF block of data that decodes, found by the
+// Exif header preceding its TIFF data.
+func scanExif(data []byte) (*exif.Exif, error) {
+	marker := []byte("Exif\x00\x00")
+	for offset := 0; ; {
+		idx := bytes.Index(data[offset:], marker)
+		if idx < 0 {
+			return nil, errors.New("no exif")
+		}
+
+		start := offset + idx + len(marker)
+		if x, err := exif.Decode(bytes.NewReader(data[start:])); err == nil {
+			return x, nil
+		}
+		offset = start
+	}
+}
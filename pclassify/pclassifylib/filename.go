@@ -0,0 +1,83 @@
+package pclassifylib
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+type filenameDatePattern struct {
+	pattern *regexp.Regexp
+	layout  string
+}
+
+// filenameDatePatterns are the dates apps write into the names of files
+// they save without EXIF. The submatches of a pattern, joined, are parsed
+// with its layout.
+var filenameDatePatterns = []filenameDatePattern{
+	// IMG_20230516_131230.jpg, Screenshot_20230516-131230.png, PXL_20230516_131230123.jpg
+	{regexp.MustCompile(`(?:^|\D)(\d{8})[-_ ](\d{6})`), "20060102150405"},
+	// Screenshot 2023-05-16 at 13.12.30.png, signal-2023-05-16-131230.jpg
+	{regexp.MustCompile(`(?:^|\D)(\d{4}-\d{2}-\d{2})[-_ ](?:at )?(\d{2})[-.:]?(\d{2})[-.:]?(\d{2})`), "2006-01-02150405"},
+	// IMG-20230516-WA0001.jpg
+	{regexp.MustCompile(`(?:^|\D)(\d{8})-WA\d+`), "20060102"},
+	// 2023-05-16.jpg
+	{regexp.MustCompile(`(?:^|\D)(\d{4}-\d{2}-\d{2})(?:\D|$)`), "2006-01-02"},
+}
+
+// filenameDateFormats are the Go time layouts of -filename-date-format, tried
+// anywhere in file names before filenameDatePatterns.
+var filenameDateFormats = []string{}
+
+// SetFilenameDateFormats makes the Go time layouts in a comma separated list,
+// like "2006.01.02_15.04.05", tried anywhere in file names before the known
+// patterns. The layouts have to be of fixed width, with zero padded numbers.
+func SetFilenameDateFormats(list string) error {
+	formats := []string{}
+	for _, layout := range strings.Split(list, ",") {
+		layout = strings.TrimSpace(layout)
+
+		sample := time.Date(2023, 5, 16, 13, 12, 30, 0, time.UTC)
+		if !strings.Contains(layout, "2006") || len(sample.Format(layout)) != len(layout) {
+			return errors.New(fmt.Sprintf("invalid layout %s, expected fixed width like 20060102_150405", layout))
+		}
+		formats = append(formats, layout)
+	}
+
+	filenameDateFormats = formats
+	return nil
+}
+
+// isPlausibleDate rules out numbers in names that only look like dates.
+func isPlausibleDate(t time.Time) bool {
+	return t.Year() >= 1990 && !t.After(time.Now().AddDate(0, 0, 1))
+}
+
+// getFilenameDate reads the date a file was taken from its name.
+func getFilenameDate(file string) (time.Time, Source, error) {
+	name := filepath.Base(file)
+	name = name[:len(name)-len(filepath.Ext(name))]
+
+	for _, layout := range filenameDateFormats {
+		for start := 0; start+len(layout) <= len(name); start++ {
+			t, err := time.ParseInLocation(layout, name[start:start+len(layout)], Location)
+			if err == nil && isPlausibleDate(t) {
+				return t, Source_Filename, nil
+			}
+		}
+	}
+
+	for _, datePattern := range filenameDatePatterns {
+		for _, match := range datePattern.pattern.FindAllStringSubmatch(name, -1) {
+			t, err := time.ParseInLocation(datePattern.layout, strings.Join(match[1:], ""), Location)
+			if err == nil && isPlausibleDate(t) {
+				return t, Source_Filename, nil
+			}
+		}
+	}
+
+	return time.Time{}, 0, errors.New("no date in file name")
+}
@@ -0,0 +1,39 @@
+package pclassifylib
+
+import (
+	"github.com/rwcarlsen/goexif/exif"
+	"os"
+)
+
+// GetFocalLength returns the focal length a photo was taken at in mm, its 35mm
+// equivalent when the camera records one, so that lenses on different
+// sensors compare.
+func GetFocalLength(path string) (float64, bool) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, false
+	}
+	defer f.Close()
+
+	x, err := decodeExif(f)
+	if err != nil {
+		return 0, false
+	}
+
+	if tag, err := x.Get(exif.FocalLengthIn35mmFilm); err == nil && tag != nil {
+		if focal, err := tag.Int(0); err == nil && focal > 0 {
+			return float64(focal), true
+		}
+	}
+
+	tag, err := x.Get(exif.FocalLength)
+	if err != nil || tag == nil {
+		return 0, false
+	}
+
+	num, den, err := tag.Rat2(0)
+	if err != nil || num <= 0 || den <= 0 {
+		return 0, false
+	}
+	return float64(num) / float64(den), true
+}
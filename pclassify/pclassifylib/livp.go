@@ -0,0 +1,182 @@
+package pclassifylib
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"github.com/rwcarlsen/goexif/exif"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// livpImageExtensions are the extensions of the still of a live photo package.
+var livpImageExtensions = map[string]bool{".heic": true, ".heif": true, ".jpg": true, ".jpeg": true}
+
+// IsLivp reports whether file is an Apple live photo package, a zip archive
+// holding the still and the clip of a live photo.
+func IsLivp(file string) bool {
+	return strings.ToLower(filepath.Ext(file)) == ".livp"
+}
+
+// isHeic reports whether file is a HEIF image, whose EXIF is not found the
+// way it is in JPEG and TIFF files.
+func isHeic(file string) bool {
+	extName := strings.ToLower(filepath.Ext(file))
+	return extName == ".heic" || extName == ".heif"
+}
+
+// decodeHeicExif decodes the EXIF item of a HEIF image, found by the Exif
+// header preceding its TIFF data.
+func decodeHeicExif(data []byte) (*exif.Exif, error) {
+	idx := bytes.Index(data, []byte("Exif\x00\x00"))
+	if idx < 0 {
+		return nil, errors.New("no exif")
+	}
+
+	return exif.Decode(bytes.NewReader(data[idx+6:]))
+}
+
+// getExifDateOf reads the date a photo was taken from x.
+func getExifDateOf(x *exif.Exif) (time.Time, Source, error) {
+	const layout = "2006:01:02 15:04:05"
+	for _, dateTag := range exifDateTags {
+		ts, err := x.Get(dateTag.tag)
+		if err != nil || ts == nil {
+			continue
+		}
+
+		value, err := ts.StringVal()
+		if err != nil {
+			continue
+		}
+
+		t, err := time.ParseInLocation(layout, strings.TrimRight(value, "\x00 "), Location)
+		if err != nil {
+			continue
+		}
+
+		return t, dateTag.source, nil
+	}
+
+	return time.Time{}, 0, errors.New("no exif date")
+}
+
+func getHeicDate(file string) (time.Time, Source, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return time.Time{}, 0, err
+	}
+
+	x, err := decodeHeicExif(data)
+	if err != nil {
+		return time.Time{}, 0, err
+	}
+
+	return getExifDateOf(x)
+}
+
+// getLivpDate reads the date a live photo package was taken from the EXIF of
+// the still it holds.
+func getLivpDate(file string) (time.Time, Source, error) {
+	archive, err := zip.OpenReader(file)
+	if err != nil {
+		return time.Time{}, 0, err
+	}
+	defer archive.Close()
+
+	for _, entry := range archive.File {
+		extName := strings.ToLower(filepath.Ext(entry.Name))
+		if !livpImageExtensions[extName] {
+			continue
+		}
+
+		r, err := entry.Open()
+		if err != nil {
+			return time.Time{}, 0, err
+		}
+		data, err := ioutil.ReadAll(io.LimitReader(r, 64<<20))
+		r.Close()
+		if err != nil {
+			return time.Time{}, 0, err
+		}
+
+		var x *exif.Exif
+		if extName == ".heic" || extName == ".heif" {
+			x, err = decodeHeicExif(data)
+		} else {
+			x, err = exif.Decode(bytes.NewReader(data))
+		}
+		if err != nil {
+			return time.Time{}, 0, err
+		}
+
+		return getExifDateOf(x)
+	}
+
+	return time.Time{}, 0, errors.New("no still in live photo")
+}
+
+// UnpackLivp writes each file held by the live photo package at file into
+// dir, named after the package with the extension of the part, and returns
+// their paths. An existing file is never overwritten.
+func UnpackLivp(file, dir string) ([]string, error) {
+	archive, err := zip.OpenReader(file)
+	if err != nil {
+		return nil, err
+	}
+	defer archive.Close()
+
+	name := filepath.Base(file)
+	base := filepath.Join(dir, name[:len(name)-len(filepath.Ext(name))])
+	parts := []string{}
+	for _, entry := range archive.File {
+		if !entry.FileInfo().Mode().IsRegular() {
+			continue
+		}
+
+		part := base + strings.ToLower(filepath.Ext(entry.Name))
+		if err := unpackEntry(entry, part); err != nil {
+			for _, written := range parts {
+				os.Remove(written)
+			}
+			return nil, err
+		}
+		parts = append(parts, part)
+	}
+
+	if len(parts) == 0 {
+		return nil, errors.New("empty live photo")
+	}
+
+	return parts, nil
+}
+
+func unpackEntry(entry *zip.File, part string) error {
+	r, err := entry.Open()
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	w, err := os.OpenFile(part, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(w, r); err != nil {
+		w.Close()
+		os.Remove(part)
+		return err
+	}
+
+	if err := w.Close(); err != nil {
+		os.Remove(part)
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,141 @@
+package pclassifylib
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// xmpRatingPattern matches the xmp:Rating property written by Lightroom and
+// most cameras, both as an attribute and as an element.
+var xmpRatingPattern = regexp.MustCompile(`xmp:Rating\s*(?:=\s*["']|>)\s*(-?\d+)`)
+
+// xmpScanLimit is how far into a file an embedded XMP packet is looked for.
+const xmpScanLimit = 1 << 20
+
+// exifRatingTag is the IFD0 tag Windows and most cameras store the star
+// rating in, which goexif does not load, and exifRatingScan how far into a
+// file its EXIF block is looked for.
+const (
+	exifRatingTag  = 0x4746
+	exifRatingScan = 256 << 10
+)
+
+// getExifRating reads the Rating tag from the IFD0 of the EXIF of a photo, or
+// of the file itself for the TIFF based raw formats, out of its first bytes.
+func getExifRating(data []byte) (int, bool) {
+	if len(data) > exifRatingScan {
+		data = data[:exifRatingScan]
+	}
+
+	tiff := data
+	if !bytes.HasPrefix(data, []byte("II*\x00")) && !bytes.HasPrefix(data, []byte("MM\x00*")) {
+		idx := bytes.Index(data, []byte("Exif\x00\x00"))
+		if idx < 0 {
+			return 0, false
+		}
+		tiff = data[idx+6:]
+	}
+
+	return readIFD0Short(tiff, exifRatingTag)
+}
+
+// readIFD0Short returns the value of the SHORT tag of the IFD0 of the TIFF
+// data.
+func readIFD0Short(tiff []byte, tag uint16) (int, bool) {
+	if len(tiff) < 8 {
+		return 0, false
+	}
+
+	var order binary.ByteOrder = binary.BigEndian
+	if tiff[0] == 'I' {
+		order = binary.LittleEndian
+	}
+
+	offset := int64(order.Uint32(tiff[4:]))
+	if offset+2 > int64(len(tiff)) {
+		return 0, false
+	}
+
+	count := int64(order.Uint16(tiff[offset:]))
+	for i := int64(0); i < count; i++ {
+		entry := offset + 2 + i*12
+		if entry+12 > int64(len(tiff)) {
+			return 0, false
+		}
+
+		// a SHORT value is held in the entry itself
+		if order.Uint16(tiff[entry:]) == tag && order.Uint16(tiff[entry+2:]) == 3 {
+			return int(order.Uint16(tiff[entry+8:])), true
+		}
+	}
+
+	return 0, false
+}
+
+// getXmpRating reads the rating of an XMP packet within data.
+func getXmpRating(data []byte) (int, bool) {
+	match := xmpRatingPattern.FindSubmatch(data)
+	if match == nil {
+		return 0, false
+	}
+
+	rating, err := strconv.Atoi(string(match[1]))
+	if err != nil {
+		return 0, false
+	}
+
+	return rating, true
+}
+
+// GetRatingFrom returns the star rating of the photo read from r, from its
+// EXIF Rating tag then an XMP packet embedded in it, without reading further
+// than either is looked for.
+func GetRatingFrom(r io.Reader) (int, bool) {
+	data, err := ioutil.ReadAll(io.LimitReader(r, xmpScanLimit))
+	if err != nil {
+		return 0, false
+	}
+
+	if rating, ok := getExifRating(data); ok {
+		return rating, true
+	}
+
+	return getXmpRating(data)
+}
+
+func getFileRating(file string) (int, bool) {
+	f, err := os.Open(file)
+	if err != nil {
+		return 0, false
+	}
+	defer f.Close()
+
+	return GetRatingFrom(f)
+}
+
+// XmpSidecars returns the names an XMP sidecar of the photo at path may have,
+// like IMG_0001.xmp or IMG_0001.jpg.xmp.
+func XmpSidecars(path string) []string {
+	base := strings.TrimSuffix(path, filepath.Ext(path))
+	return []string{base + ".xmp", base + ".XMP", path + ".xmp", path + ".XMP"}
+}
+
+// GetRating returns the star rating of the photo at path, read from its EXIF
+// Rating tag, then an XMP packet embedded in it, then an XMP sidecar named
+// like IMG_0001.xmp or IMG_0001.jpg.xmp. It reports false if none has one.
+func GetRating(path string) (int, bool) {
+	for _, file := range append([]string{path}, XmpSidecars(path)...) {
+		if rating, ok := getFileRating(file); ok {
+			return rating, true
+		}
+	}
+
+	return 0, false
+}
@@ -0,0 +1,36 @@
+package pclassifylib
+
+import (
+	"github.com/rwcarlsen/goexif/exif"
+	"os"
+	"strings"
+)
+
+// GetSoftware returns the EXIF Software tag of a photo, naming the camera
+// firmware or the editor that last saved it.
+func GetSoftware(path string) (string, bool) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", false
+	}
+	defer f.Close()
+
+	x, err := decodeExif(f)
+	if err != nil {
+		return "", false
+	}
+
+	tag, err := x.Get(exif.Software)
+	if err != nil || tag == nil {
+		return "", false
+	}
+
+	// a tag that is not a string is as good as none
+	value, err := tag.StringVal()
+	if err != nil {
+		return "", false
+	}
+
+	software := strings.TrimSpace(strings.TrimRight(value, "\x00"))
+	return software, len(software) != 0
+}
@@ -0,0 +1,27 @@
+package pclassifylib
+
+import (
+	"os"
+)
+
+// GetExifThumbnail returns the JPEG thumbnail embedded in the EXIF of a
+// photo, false when it has none.
+func GetExifThumbnail(path string) ([]byte, bool) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, false
+	}
+	defer f.Close()
+
+	x, err := decodeExif(f)
+	if err != nil {
+		return nil, false
+	}
+
+	thumb, err := x.JpegThumbnail()
+	if err != nil || len(thumb) == 0 {
+		return nil, false
+	}
+
+	return thumb, true
+}
@@ -0,0 +1,148 @@
+package pclassifylib
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+	"time"
+)
+
+// quickTimeEpoch is where MP4 and QuickTime timestamps count seconds from.
+var quickTimeEpoch = time.Date(1904, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// findBox seeks r to the payload of the first box of boxType between the
+// current offset and end, returning the payload size.
+func findBox(r io.ReadSeeker, boxType string, end int64) (int64, error) {
+	header := make([]byte, 16)
+	for {
+		offset, err := r.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return 0, err
+		}
+		if offset+8 > end {
+			return 0, errors.New("box not found")
+		}
+
+		if _, err := io.ReadFull(r, header[:8]); err != nil {
+			return 0, err
+		}
+
+		size := int64(binary.BigEndian.Uint32(header[:4]))
+		headerSize := int64(8)
+		switch size {
+		case 1:
+			if _, err := io.ReadFull(r, header[8:16]); err != nil {
+				return 0, err
+			}
+			size = int64(binary.BigEndian.Uint64(header[8:16]))
+			headerSize = 16
+		case 0:
+			size = end - offset
+		}
+
+		if size < headerSize {
+			return 0, errors.New("malformed box")
+		}
+
+		if string(header[4:8]) == boxType {
+			return size - headerSize, nil
+		}
+
+		if _, err := r.Seek(offset+size, io.SeekStart); err != nil {
+			return 0, err
+		}
+	}
+}
+
+// readCreationTime reads the creation time of the mvhd or mdhd box whose
+// payload r is at, 0 when unset.
+func readCreationTime(r io.Reader) (uint64, error) {
+	version := make([]byte, 4)
+	if _, err := io.ReadFull(r, version); err != nil {
+		return 0, err
+	}
+
+	if version[0] == 1 {
+		buf := make([]byte, 8)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return 0, err
+		}
+		return binary.BigEndian.Uint64(buf), nil
+	}
+
+	buf := make([]byte, 4)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return 0, err
+	}
+	return uint64(binary.BigEndian.Uint32(buf)), nil
+}
+
+// getVideoDate reads the creation time of the movie header of an MP4 or
+// QuickTime file, or of the media header of its first track when remuxing
+// left the movie header unset. Videos have no EXIF, and copies made by other
+// tools reset their modification time, so this is what keeps them in the
+// folder of their first classification.
+func getVideoDate(file string) (time.Time, Source, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return time.Time{}, 0, err
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return time.Time{}, 0, err
+	}
+
+	moovSize, err := findBox(f, "moov", fi.Size())
+	if err != nil {
+		return time.Time{}, 0, err
+	}
+
+	moovStart, _ := f.Seek(0, io.SeekCurrent)
+	moovEnd := moovStart + moovSize
+	if _, err := findBox(f, "mvhd", moovEnd); err != nil {
+		return time.Time{}, 0, err
+	}
+
+	seconds, err := readCreationTime(f)
+	if err != nil {
+		return time.Time{}, 0, err
+	}
+
+	if seconds == 0 {
+		seconds = getTrackCreationTime(f, moovStart, moovEnd)
+	}
+
+	if seconds == 0 {
+		return time.Time{}, 0, errors.New("no creation time")
+	}
+
+	return quickTimeEpoch.Add(time.Duration(seconds) * time.Second).In(Location), Source_Video, nil
+}
+
+// getTrackCreationTime reads the creation time of the media header of the
+// first track of the moov box between moovStart and moovEnd, 0 when there is
+// none.
+func getTrackCreationTime(f io.ReadSeeker, moovStart, moovEnd int64) uint64 {
+	if _, err := f.Seek(moovStart, io.SeekStart); err != nil {
+		return 0
+	}
+
+	end := moovEnd
+	for _, boxType := range []string{"trak", "mdia", "mdhd"} {
+		size, err := findBox(f, boxType, end)
+		if err != nil {
+			return 0
+		}
+		start, _ := f.Seek(0, io.SeekCurrent)
+		end = start + size
+	}
+
+	seconds, err := readCreationTime(f)
+	if err != nil {
+		return 0
+	}
+	return seconds
+}
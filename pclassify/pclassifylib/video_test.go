@@ -0,0 +1,98 @@
+package pclassifylib
+
+import (
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func box(boxType string, payloads ...[]byte) []byte {
+	data := make([]byte, 8)
+	copy(data[4:], boxType)
+	for _, payload := range payloads {
+		data = append(data, payload...)
+	}
+	binary.BigEndian.PutUint32(data, uint32(len(data)))
+	return data
+}
+
+// headerBox returns an mvhd or mdhd box of version 0 created at t, or unset
+// for a zero t.
+func headerBox(boxType string, t time.Time) []byte {
+	payload := make([]byte, 24)
+	if !t.IsZero() {
+		binary.BigEndian.PutUint32(payload[4:], uint32(t.Sub(quickTimeEpoch)/time.Second))
+	}
+	return box(boxType, payload)
+}
+
+func writeVideo(t *testing.T, file string, movie, track time.Time) {
+	data := append(box("ftyp", []byte("isom")), box("moov", headerBox("mvhd", movie), box("trak", box("mdia", headerBox("mdhd", track))))...)
+	if err := ioutil.WriteFile(file, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestGetVideoDate(t *testing.T) {
+	defer func(location *time.Location) { Location = location }(Location)
+	Location = time.UTC
+
+	movie := time.Date(2023, 5, 16, 14, 25, 1, 0, time.UTC)
+	track := time.Date(2022, 1, 2, 3, 4, 5, 0, time.UTC)
+	tests := []struct {
+		movie, track time.Time
+		date         time.Time
+	}{
+		{movie, track, movie},
+		{time.Time{}, track, track},
+	}
+
+	dir := t.TempDir()
+	for _, test := range tests {
+		file := filepath.Join(dir, "VID_0001.mp4")
+		writeVideo(t, file, test.movie, test.track)
+
+		date, source, err := getVideoDate(file)
+		if err != nil || source != Source_Video || !date.Equal(test.date) {
+			t.Errorf("getVideoDate(movie %s, track %s) = %s, %v, %v, want %s", test.movie, test.track, date, source, err, test.date)
+		}
+	}
+
+	writeVideo(t, filepath.Join(dir, "VID_0002.mp4"), time.Time{}, time.Time{})
+	if _, _, err := getVideoDate(filepath.Join(dir, "VID_0002.mp4")); err == nil {
+		t.Errorf("getVideoDate of a video without creation time succeeded")
+	}
+}
+
+// A video copied by a tool resetting its modification time resolves to the
+// same capture time as before, so it is classified into the same folder.
+func TestCopiedVideoCaptureTime(t *testing.T) {
+	dir := t.TempDir()
+	original := filepath.Join(dir, "VID_0001.mp4")
+	writeVideo(t, original, time.Date(2023, 5, 16, 14, 25, 1, 0, time.UTC), time.Time{})
+	modTime := time.Date(2020, 1, 1, 0, 0, 0, 0, time.Local)
+	os.Chtimes(original, modTime, modTime)
+
+	before, source, err := ResolveCaptureTime(original)
+	if err != nil || source != Source_Video {
+		t.Fatalf("ResolveCaptureTime(%s) = %s, %v, %v, want a video date", original, before, source, err)
+	}
+
+	data, err := ioutil.ReadFile(original)
+	if err != nil {
+		t.Fatal(err)
+	}
+	copied := filepath.Join(dir, "copy", "VID_0001.mp4")
+	os.MkdirAll(filepath.Dir(copied), 0755)
+	if err := ioutil.WriteFile(copied, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	after, source, err := ResolveCaptureTime(copied)
+	if err != nil || source != Source_Video || !after.Equal(before) {
+		t.Errorf("ResolveCaptureTime of the copy = %s, %v, %v, want %s", after, source, err, before)
+	}
+}
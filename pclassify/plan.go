@@ -0,0 +1,149 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// folderPlan collects how many files each folder would receive, it is safe
+// for concurrent use by the workers.
+type folderPlan struct {
+	mutex   sync.Mutex
+	folders map[string]int
+}
+
+func newFolderPlan() *folderPlan {
+	return &folderPlan{folders: map[string]int{}}
+}
+
+func (p *folderPlan) add(folderName string) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	p.folders[filepath.Clean(folderName)]++
+}
+
+// print writes the planned folders under target as a tree, with the number
+// of files each would receive.
+func (p *folderPlan) print(target string) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	names := make([]string, 0, len(p.folders))
+	total := 0
+	for name, count := range p.folders {
+		names = append(names, name)
+		total += count
+	}
+	sort.Strings(names)
+
+	fmt.Printf("%s (%d files in %d folders)\n", target, total, len(names))
+
+	printed := []string{}
+	for _, name := range names {
+		if name == "." {
+			fmt.Printf("  . (%d files)\n", p.folders[name])
+			continue
+		}
+
+		parts := strings.Split(name, string(filepath.Separator))
+		common := 0
+		for common < len(parts)-1 && common < len(printed) && printed[common] == parts[common] {
+			common++
+		}
+
+		for depth := common; depth < len(parts)-1; depth++ {
+			fmt.Printf("%s%s/\n", strings.Repeat("  ", depth+1), parts[depth])
+		}
+
+		last := len(parts) - 1
+		fmt.Printf("%s%s/ (%d files)\n", strings.Repeat("  ", last+1), parts[last], p.folders[name])
+		printed = parts
+	}
+}
+
+// folderCounts collects how many files of what total size would be classified,
+// and the distinct folders they would go to in every classify mode. Files
+// whose date can not be resolved go to none and are counted apart. It is safe
+// for concurrent use by the workers.
+type folderCounts struct {
+	mutex      sync.Mutex
+	files      int
+	bytes      int64
+	unresolved int
+	folders    map[typeClassifyMode]map[string]bool
+}
+
+func newFolderCounts() *folderCounts {
+	folders := map[typeClassifyMode]map[string]bool{}
+	for _, option := range classifyModeOptions {
+		folders[option.mode] = map[string]bool{}
+	}
+
+	return &folderCounts{folders: folders}
+}
+
+func (c *folderCounts) add(file string) {
+	size := int64(0)
+	if fi, err := os.Stat(file); err == nil {
+		size = fi.Size()
+	}
+
+	folderNames := map[typeClassifyMode]string{}
+	unresolved := false
+	if !isMediaFile(file) {
+		for _, option := range classifyModeOptions {
+			folderNames[option.mode] = otherDir
+		}
+	} else if date, err := resolveCaptureTime(file); err != nil {
+		unresolved = true
+	} else {
+		for _, option := range classifyModeOptions {
+			folderName, err := getFolderName(file, date, option.mode)
+			if err != nil {
+				continue
+			}
+
+			if albumPrefix && len(folderName) != 0 {
+				folderName = getAlbumPrefix(file) + folderName
+			}
+			folderNames[option.mode] = folderName
+		}
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.files++
+	c.bytes += size
+	if unresolved {
+		c.unresolved++
+	}
+	for mode, folderName := range folderNames {
+		c.folders[mode][filepath.Clean(folderName)] = true
+	}
+}
+
+// print writes the number and size of the files, and the number of folders
+// under target each classify mode would put them in.
+func (c *folderCounts) print(target string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	fmt.Printf("%s (%d files, %d bytes)\n", target, c.files, c.bytes)
+	for _, option := range classifyModeOptions {
+		selected := ""
+		if option.mode == classifyMode {
+			selected = ", selected"
+		}
+
+		fmt.Printf("  %-14s%d folders%s\n", option.opt, len(c.folders[option.mode]), selected)
+	}
+	if c.unresolved > 0 {
+		fmt.Printf("  %d file(s) whose date could not be resolved, in no folder\n", c.unresolved)
+	}
+}
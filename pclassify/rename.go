@@ -0,0 +1,64 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"photoutils/pcopy/pcopylib"
+	"sort"
+	"time"
+)
+
+// getCaptureTimeName names a file after the time it was taken, keeping its
+// extension.
+func getCaptureTimeName(file string, date time.Time) string {
+	return date.Format("20060102_150405") + filepath.Ext(file)
+}
+
+// previewRenames prints the name each file would be classified to, flagging
+// names planned for more than one file and names already taken in target.
+// It returns the number of names planned for more than one file.
+func previewRenames(files []string, target string) int {
+	planned := map[string][]string{}
+	targets := map[string]string{}
+
+	for _, file := range files {
+		folderName, fileName, err := resolveTarget(file, classifyMode)
+		if err != nil {
+			fmt.Printf("%s: %s\n", file, err)
+			continue
+		}
+
+		relative := filepath.Join(folderName, fileName)
+		planned[relative] = append(planned[relative], file)
+		targets[file] = relative
+	}
+
+	sorted := make([]string, 0, len(targets))
+	for file := range targets {
+		sorted = append(sorted, file)
+	}
+	sort.Strings(sorted)
+
+	for _, file := range sorted {
+		relative := targets[file]
+		flag := ""
+		switch {
+		case len(planned[relative]) > 1:
+			flag = " [collision]"
+		case pcopylib.IsTargetExist(filepath.Join(target, relative)) != pcopylib.FileExistStatus_NotExist:
+			flag = " [exists]"
+		}
+
+		fmt.Printf("%s -> %s%s\n", file, relative, flag)
+	}
+
+	collisions := 0
+	for relative, sources := range planned {
+		if len(sources) > 1 {
+			collisions++
+			fmt.Printf("pclassify: warning: %s: planned for %d files\n", relative, len(sources))
+		}
+	}
+
+	return collisions
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"path/filepath"
+	"photoutils/pclassify/pclassifylib"
+	"regexp"
+	"strings"
+)
+
+// defaultScreenshotName matches the names phones and desktops give
+// screenshots, like "Screenshot 2023-05-14 at 10.00.00.png",
+// "Screen Shot 2019-01-01.png" or "SCR_20230514.jpg".
+const defaultScreenshotName = `(?i)(screen[ _-]?shot|screen[ _-]?capture|^scr_)`
+
+var (
+	screenshotsDir string         = ""
+	screenshotName *regexp.Regexp = regexp.MustCompile(defaultScreenshotName)
+	screenshotsPng bool           = true
+)
+
+// isScreenshot reports whether file looks like a screenshot: named like one,
+// or a PNG no camera make is recorded for, when screenshotsPng is set.
+func isScreenshot(file string) bool {
+	if screenshotName != nil && screenshotName.MatchString(filepath.Base(file)) {
+		return true
+	}
+
+	if screenshotsPng && strings.ToLower(filepath.Ext(file)) == ".png" {
+		_, ok := pclassifylib.GetExifField(file, "Make")
+		return !ok
+	}
+
+	return false
+}
+
+// isScreenshotFile reports whether file goes to screenshotsDir: a photo, or a
+// PNG image even when they are not classified like photos, that looks like a
+// screenshot.
+func isScreenshotFile(file string) bool {
+	if len(screenshotsDir) == 0 {
+		return false
+	}
+	if !isMediaFile(file) && strings.ToLower(filepath.Ext(file)) != ".png" {
+		return false
+	}
+
+	return isScreenshot(file)
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"photoutils/pcopy/pcopylib"
+	"strings"
+)
+
+// sidecarExtensions are the companions cameras write next to a photo or
+// video under the same name, like the .THM thumbnail of IMG_0001.MP4 or the
+// .LRV low resolution proxy of GOPR0001.MP4. They follow their primary
+// rather than being classified by themselves.
+var sidecarExtensions = []string{".thm", ".lrv"}
+
+func isHiddenFile(file string) bool {
+	return strings.HasPrefix(filepath.Base(file), ".")
+}
+
+// isSidecarFile reports whether file is a camera companion of a media file
+// next to it. Hidden files, like ._IMG_0001.THM left by macOS, never are.
+func isSidecarFile(file string) bool {
+	if isHiddenFile(file) {
+		return false
+	}
+
+	extName := strings.ToLower(filepath.Ext(file))
+	known := false
+	for _, sidecarExt := range sidecarExtensions {
+		known = known || extName == sidecarExt
+	}
+	if !known {
+		return false
+	}
+
+	base := file[:len(file)-len(filepath.Ext(file))]
+	for extName := range imageExtensions {
+		if hasSibling(base, extName) {
+			return true
+		}
+	}
+	for extName := range videoExtensions {
+		if hasSibling(base, extName) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// hasSibling reports whether base with extName, in lower or upper case, is a
+// regular file or an archive entry.
+func hasSibling(base, extName string) bool {
+	for _, name := range []string{base + extName, base + strings.ToUpper(extName)} {
+		if isArchiveEntry(name) {
+			return true
+		}
+		if fi, err := os.Stat(name); err == nil && fi.Mode().IsRegular() {
+			return true
+		}
+	}
+
+	return false
+}
+
+// findSidecars returns the camera companions of file.
+func findSidecars(file string) []string {
+	if isHiddenFile(file) {
+		return nil
+	}
+
+	base := file[:len(file)-len(filepath.Ext(file))]
+	sidecars := []string{}
+	for _, sidecarExt := range sidecarExtensions {
+		for _, name := range []string{base + sidecarExt, base + strings.ToUpper(sidecarExt)} {
+			if fi, err := os.Lstat(name); isArchiveEntry(name) || (err == nil && fi.Mode().IsRegular()) {
+				sidecars = append(sidecars, name)
+				break
+			}
+		}
+	}
+
+	return sidecars
+}
+
+// classifySidecars copies or moves the camera companions of file next to
+// targetFile, named after it, so a renamed primary keeps its companions.
+func classifySidecars(file, targetFile string, copyMode, fullHashMode bool) {
+	targetBase := targetFile[:len(targetFile)-len(filepath.Ext(targetFile))]
+	for _, sidecar := range findSidecars(file) {
+		sidecarTarget := targetBase + filepath.Ext(sidecar)
+		if err := pcopylib.CopyFile(sidecar, sidecarTarget, !copyMode, fullHashMode); err != nil && !pcopylib.IsReported(err) {
+			pcopylib.Outputf(file, "pclassify: warning: %s: %s\n", sidecar, err)
+			pcopylib.LogFailure(sidecar, err)
+		}
+	}
+}
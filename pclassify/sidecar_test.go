@@ -0,0 +1,64 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestClassifySidecarsFollowCollision(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pclassify-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	target := filepath.Join(dir, "sorted")
+	date := time.Date(2019, 6, 1, 12, 0, 0, 0, time.Local)
+	// the first has no sidecar, so only following the video tells the
+	// second one's apart from a name of its own
+	for _, camera := range []string{"first", "second"} {
+		source := filepath.Join(dir, camera)
+		if err := os.Mkdir(source, 0755); err != nil {
+			t.Fatal(err)
+		}
+
+		video := filepath.Join(source, "IMG_0001.MP4")
+		names := []string{video}
+		if camera == "second" {
+			names = append(names, filepath.Join(source, "IMG_0001.THM"))
+		}
+		for _, name := range names {
+			if err := ioutil.WriteFile(name, []byte(camera+" "+filepath.Ext(name)), 0644); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.Chtimes(name, date, date); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		if err := classify(video, target, true, false, monthMode); err != nil {
+			t.Fatalf("classify %s: %s", video, err)
+		}
+	}
+
+	videos, _ := filepath.Glob(filepath.Join(target, "*", "IMG_0001(1).MP4"))
+	if len(videos) != 1 {
+		t.Fatalf("second IMG_0001.MP4 written as %q, want IMG_0001(1).MP4", videos)
+	}
+
+	sidecar := filepath.Join(filepath.Dir(videos[0]), "IMG_0001(1).THM")
+	content, err := ioutil.ReadFile(sidecar)
+	if err != nil {
+		t.Fatalf("sidecar did not follow %s: %s", videos[0], err)
+	}
+	if string(content) != "second .THM" {
+		t.Errorf("%s is %q, want the second camera's sidecar", sidecar, content)
+	}
+
+	if stray, _ := filepath.Glob(filepath.Join(target, "*", "IMG_0001.THM")); len(stray) != 0 {
+		t.Errorf("sidecar also written as %q", stray)
+	}
+}
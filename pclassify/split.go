@@ -0,0 +1,156 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"photoutils/pclassify/pclassifylib"
+	"strings"
+	"time"
+)
+
+// maxPerFolder, when not zero, splits the folders a run would put more files
+// than it into by sub-period.
+var maxPerFolder int = 0
+
+// twoPass keeps the capture times the count of maxPerFolder resolves, so
+// that classifying does not resolve them again, at the cost of holding them
+// all.
+var twoPass bool = false
+
+// overfullFolders are the folders of the run over maxPerFolder, found before
+// classifying anything and only read after.
+var overfullFolders = map[string]bool{}
+
+// captureTimes are the capture times the count of twoPass resolved, only
+// read after it.
+var captureTimes = map[string]time.Time{}
+
+// resolveCaptureTime returns the capture time of file the count of twoPass
+// resolved, or resolves it.
+func resolveCaptureTime(file string) (time.Time, error) {
+	if date, ok := captureTimes[file]; ok {
+		return date, nil
+	}
+
+	date, _, err := pclassifylib.ResolveCaptureTime(file)
+	return date, err
+}
+
+// getSubPeriodFolder returns the subfolder of a split folder a file taken at
+// date goes to: the hour of a date, like 14h, the date of a month and the
+// month of a year.
+func getSubPeriodFolder(date time.Time, classifyMode typeClassifyMode) string {
+	switch classifyMode {
+	case yearMode:
+		return folderNameByMonth(date)
+	case monthMode:
+		return folderNameByDate(date)
+	case dateMode:
+		return fmt.Sprintf("%02dh", date.Hour())
+	}
+
+	return ""
+}
+
+// findOverfullFolders walks source as classifying does, counting the files
+// each folder would receive, and returns those over maxPerFolder. With
+// twoPass, the capture times resolved are kept.
+func findOverfullFolders(source, target string) map[string]bool {
+	targetInfo, _ := os.Stat(target)
+	counts := map[string]int{}
+
+	filepath.Walk(source, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return nil
+		}
+
+		if info.IsDir() {
+			if path == source {
+				return nil
+			}
+			if !recursiveMode || (targetInfo != nil && os.SameFile(info, targetInfo)) || info.Name() == thumbnailsDir {
+				return filepath.SkipDir
+			}
+			if skipSorted && (isClassifiedFolder(info.Name(), classifyMode) || strings.EqualFold(info.Name(), otherDir) || strings.EqualFold(info.Name(), screenshotsDir)) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		// only photos and videos go to folders by date
+		if !info.Mode().IsRegular() || !isMediaFile(path) || isScreenshotFile(path) {
+			return nil
+		}
+		if minRating > 0 && !isRatedEnough(path) {
+			return nil
+		}
+
+		date, _, err := pclassifylib.ResolveCaptureTime(path)
+		if err != nil {
+			return nil
+		}
+		if twoPass {
+			captureTimes[path] = date
+		}
+
+		folderName, err := getFolderName(path, date, classifyMode)
+		if err != nil {
+			return nil
+		}
+		if albumPrefix && len(folderName) != 0 {
+			folderName = getAlbumPrefix(path) + folderName
+		}
+
+		counts[folderName]++
+		return nil
+	})
+
+	overfull := map[string]bool{}
+	for folderName, count := range counts {
+		if count > maxPerFolder {
+			overfull[folderName] = true
+		}
+	}
+
+	if len(overfull) != 0 {
+		fmt.Printf("pclassify: %d folder(s) over %d files, split by %s\n", len(overfull), maxPerFolder, subPeriodNames[classifyMode])
+	}
+	return overfull
+}
+
+// subPeriodNames name the sub-periods of the classify modes folders can be
+// split in.
+var subPeriodNames = map[typeClassifyMode]string{
+	yearMode:  "month",
+	monthMode: "date",
+	dateMode:  "hour",
+}
+
+// checkMaxPerFolder returns an error when folders of the classify mode can
+// not be split.
+func checkMaxPerFolder() error {
+	if maxPerFolder < 0 {
+		return errors.New(fmt.Sprintf("pclassify: error: argument -max-per-folder: invalid number %d (choose 0 or above)", maxPerFolder))
+	}
+	if maxPerFolder == 0 {
+		if twoPass {
+			return errors.New("pclassify: error: argument -two-pass: not allowed without argument -max-per-folder")
+		}
+		return nil
+	}
+
+	if len(outTemplate) != 0 {
+		return errors.New("pclassify: error: argument -max-per-folder: not allowed with argument -out")
+	}
+	if _, ok := subPeriodNames[classifyMode]; !ok {
+		for _, option := range classifyModeOptions {
+			if option.mode == classifyMode {
+				return errors.New(fmt.Sprintf("pclassify: error: argument -max-per-folder: not allowed with argument %s", option.opt))
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// parallelWalkers is the number of directories read at once by parallelWalk.
+const parallelWalkers = 8
+
+// dirQueue holds the directories parallelWalk has yet to read. It is done
+// once none is left and none is being read, or once stopped.
+type dirQueue struct {
+	mutex   sync.Mutex
+	cond    *sync.Cond
+	dirs    []string
+	reading int
+	err     error
+}
+
+// next returns the next directory to read, waiting for one while others are
+// read, false once the walk is done.
+func (q *dirQueue) next() (string, bool) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	for len(q.dirs) == 0 && q.reading > 0 && q.err == nil {
+		q.cond.Wait()
+	}
+	if len(q.dirs) == 0 || q.err != nil {
+		return "", false
+	}
+
+	dir := q.dirs[len(q.dirs)-1]
+	q.dirs = q.dirs[:len(q.dirs)-1]
+	q.reading++
+	return dir, true
+}
+
+// done adds the subdirectories found reading a directory, and stops the walk
+// when err is not nil.
+func (q *dirQueue) done(subdirs []string, err error) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	q.reading--
+	q.dirs = append(q.dirs, subdirs...)
+	if err != nil && q.err == nil {
+		q.err = err
+	}
+	q.cond.Broadcast()
+}
+
+// parallelWalk walks the file tree rooted at root like filepath.Walk, but
+// reads up to walkers directories at once, which pays off on network shares.
+// walkFn is called from several goroutines and in no particular order,
+// returning filepath.SkipDir for a directory skips its contents, and any
+// other error stops the walk and is returned.
+func parallelWalk(root string, walkers int, walkFn filepath.WalkFunc) error {
+	info, err := os.Lstat(root)
+	if err != nil {
+		return walkFn(root, nil, err)
+	}
+
+	if err := walkFn(root, info, nil); err != nil || !info.IsDir() {
+		if err == filepath.SkipDir {
+			return nil
+		}
+		return err
+	}
+
+	queue := &dirQueue{dirs: []string{root}}
+	queue.cond = sync.NewCond(&queue.mutex)
+
+	// readDir returns the subdirectories of dir to walk, after calling walkFn
+	// on all its entries.
+	readDir := func(dir string) ([]string, error) {
+		entries, err := ioutil.ReadDir(dir)
+		if err != nil {
+			if err := walkFn(dir, nil, err); err != nil && err != filepath.SkipDir {
+				return nil, err
+			}
+			return nil, nil
+		}
+
+		subdirs := []string{}
+		for _, entry := range entries {
+			path := filepath.Join(dir, entry.Name())
+			err := walkFn(path, entry, nil)
+			if err == filepath.SkipDir {
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+			if entry.IsDir() {
+				subdirs = append(subdirs, path)
+			}
+		}
+		return subdirs, nil
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < walkers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for dir, ok := queue.next(); ok; dir, ok = queue.next() {
+				queue.done(readDir(dir))
+			}
+		}()
+	}
+	wg.Wait()
+
+	return queue.err
+}
@@ -2,109 +2,773 @@ package main
 
 import (
 	"errors"
+	"flag"
 	"fmt"
+	"io/ioutil"
 	"os"
+	"os/signal"
+	"path/filepath"
 	"photoutils/pcopy/pcopylib"
 	"runtime"
+	"strconv"
 	"strings"
+	"syscall"
+	"time"
 )
 
 func shortUsage(errInfo string) error {
-	str := fmt.Sprintln("usage: pcopy [-h] [-m] [-f] [-r] source target")
+	str := fmt.Sprintln("usage: pcopy [-h] [-m] [-safe-move] [-f] [-quick] [-mtime-tolerance duration] [-hash-cache path] [-full-hash-below size] [-sample-tier size] [-warn-skip-over size] [-r] [-dir-progress] [-preserve-parent-times] [-dereference] [-copy-empty-dirs[=false]] [-no-clobber] [-overwrite-if-larger] [-rename-always] [-empty policy] [-gzip] [-file-timeout duration] [-on-change policy] [-on-error policy] [-max-open n] [-limit n] [-near-dup-threshold n] [-collision strategy] [-collision-scope scope] [-name-encoding encoding] [-rename-clashes-log path] [-events-file path] [-state path] [-hook command] [-hook-once] [-hook-strict] [-ordered-output] [-log-format format] [-progress] [-preserve-btime] [-fsync policy] [-stats-json path] [-webhook url] [-chmod mode] [-dir-chmod mode] [-targets dir1,dir2,...] [-targets-manifest path] [-compare-trees] [-verify-only] [-skip-synced] source [target]")
 	str += fmt.Sprint(errInfo)
 	err := errors.New(str)
 	return err
 }
 
 func longUsage() {
-	fmt.Println("usage: pcopy [-h] [-m] [-f] [-R] source target")
+	fmt.Println("usage: pcopy [-h] [-m] [-safe-move] [-f] [-quick] [-mtime-tolerance duration] [-hash-cache path] [-full-hash-below size] [-sample-tier size] [-warn-skip-over size] [-r] [-dir-progress] [-preserve-parent-times] [-dereference] [-copy-empty-dirs[=false]] [-no-clobber] [-overwrite-if-larger] [-rename-always] [-empty policy] [-gzip] [-file-timeout duration] [-on-change policy] [-on-error policy] [-max-open n] [-limit n] [-near-dup-threshold n] [-collision strategy] [-collision-scope scope] [-name-encoding encoding] [-rename-clashes-log path] [-events-file path] [-state path] [-hook command] [-hook-once] [-hook-strict] [-ordered-output] [-log-format format] [-progress] [-preserve-btime] [-fsync policy] [-stats-json path] [-webhook url] [-chmod mode] [-dir-chmod mode] [-targets dir1,dir2,...] [-targets-manifest path] [-compare-trees] [-verify-only] [-skip-synced] source [target]")
 	fmt.Println("")
 	fmt.Println("positional arguments:")
 	fmt.Println("  source      source path for photos to be classified")
-	fmt.Println("  target      target path for photos classified")
+	fmt.Println("  target      target path for photos classified, left out with -targets")
 	fmt.Println("")
 	fmt.Println("optional arguments:")
 	fmt.Println("  -h, --help  show this help message and exit")
 	fmt.Println("  -m          move file(s) from source to target(copy file(s) by default)")
+	fmt.Println("  -safe-move  remove a moved source only once the full hash of its target")
+	fmt.Println("              matches, when it had to be copied across file systems or")
+	fmt.Println("              was found identical")
 	fmt.Println("  -f          use fullhash mode (more slower than default)")
+	fmt.Println("  -quick      take files of the same size and mtime as identical without")
+	fmt.Println("              hashing them")
+	fmt.Println("  -mtime-tolerance duration")
+	fmt.Println("              with -quick, take mtimes up to duration apart, like 2s, as the")
+	fmt.Println("              same, for copies to FAT or over the network that shift them(0 by")
+	fmt.Println("              default)")
+	fmt.Println("  -hash-cache path")
+	fmt.Println("              reuse the hashes recorded at path for files whose size and mtime")
+	fmt.Println("              are unchanged, and record those computed for the next run")
+	fmt.Println("  -full-hash-below size")
+	fmt.Println("              compare files under size, like 500K, by their full hash, and larger")
+	fmt.Println("              ones by sampled blocks(500K by default)")
+	fmt.Println("  -sample-tier size")
+	fmt.Println("              sample 4 blocks of files for every whole size, like 256M, up to 64,")
+	fmt.Println("              and 4 of smaller files(256M by default)")
+	fmt.Println("  -warn-skip-over size")
+	fmt.Println("              warn of every file larger than size, like 1G, skipped as identical")
+	fmt.Println("              without comparing full hashes, to double check it with -f")
 	fmt.Println("  -r          recursive mode")
+	fmt.Println("  -dir-progress")
+	fmt.Println("              report every source directory as soon as all of its files are")
+	fmt.Println("              handled, in recursive mode")
+	fmt.Println("  -preserve-parent-times")
+	fmt.Println("              keep the modification times of the parents of source")
+	fmt.Println("              directories removed after moving in recursive mode")
+	fmt.Println("  -dereference")
+	fmt.Println("              copy the files symbolic links point to, instead of recreating")
+	fmt.Println("              the links")
+	fmt.Println("  -copy-empty-dirs[=false]")
+	fmt.Println("              recreate empty source directories at target in recursive")
+	fmt.Println("              mode(on by default)")
+	fmt.Println("  -no-clobber")
+	fmt.Println("              never rename or overwrite, skip any source whose target exists")
+	fmt.Println("              and leave it in place")
+	fmt.Println("  -overwrite-if-larger")
+	fmt.Println("              overwrite a same-name target smaller than its source instead")
+	fmt.Println("              of renaming(repairs interrupted copies)")
+	fmt.Println("  -rename-always")
+	fmt.Println("              rename around any existing target without comparing contents,")
+	fmt.Println("              identical files are then copied again under a new name")
+	fmt.Println("  -empty policy")
+	fmt.Println("              what to do with empty files: copy them, skip them, or report to")
+	fmt.Println("              handle them like others and list them at the end(copy by default)")
+	fmt.Println("  -gzip        write copies gzip compressed as file.ext.gz and compare")
+	fmt.Println("              existing ones by their decompressed content, uncompressed")
+	fmt.Println("              targets are not taken as duplicates of compressed ones")
+	fmt.Println("  -file-timeout duration")
+	fmt.Println("              abort and report a file whose copy makes no progress for")
+	fmt.Println("              longer than duration, like 5m(no limit by default)")
+	fmt.Println("  -on-change policy")
+	fmt.Println("              what to do about a file whose size or mtime changed while it was")
+	fmt.Println("              copied, as one an app is still writing: off, not checking, flag,")
+	fmt.Println("              listing it at the end, retry, copying it again up to 3 times, or")
+	fmt.Println("              skip, leaving it out, moves always keeping such a file(off by")
+	fmt.Println("              default)")
+	fmt.Println("  -on-error policy")
+	fmt.Println("              what to do once a file fails: continue with the others, or stop,")
+	fmt.Println("              leaving files not started yet and exiting with 1(continue by")
+	fmt.Println("              default)")
+	fmt.Println("  -max-open n")
+	fmt.Println("              open at most n files at once across copies and hashes(half the")
+	fmt.Println("              process open files limit by default)")
+	fmt.Println("  -limit n    handle only the first n files found and leave the others out,")
+	fmt.Println("              to try options on a subset(no limit by default)")
+	fmt.Println("  -near-dup-threshold n")
+	fmt.Println("              skip images whose perceptual hash differs from an existing target")
+	fmt.Println("              by at most n bits of 64, like re-encoded copies(off by default)")
+	fmt.Println("  -collision strategy")
+	fmt.Println("              how to rename a target colliding with a different file: numeric")
+	fmt.Println("              appends (1), timestamp the source mtime, hash a short content")
+	fmt.Println("              hash(numeric by default)")
+	fmt.Println("  -collision-scope scope")
+	fmt.Println("              where a target name has to be unique: folder its destination")
+	fmt.Println("              folder, tree the whole target tree, renaming a file whose name")
+	fmt.Println("              exists in any folder(folder by default)")
+	fmt.Println("  -name-encoding encoding")
+	fmt.Println("              how to write bytes of names that are not valid UTF-8: raw keeps")
+	fmt.Println("              them, escape percent-escapes them, transliterate reads them as")
+	fmt.Println("              Latin-1(raw by default)")
+	fmt.Println("  -rename-clashes-log path")
+	fmt.Println("              record every target collision to path as tab separated source,")
+	fmt.Println("              intended target, final target and whether it was identical")
+	fmt.Println("  -events-file path")
+	fmt.Println("              stream a JSON line to path for every file copied, moved, found")
+	fmt.Println("              identical, skipped or failed, like /dev/fd/3 for a pipe")
+	fmt.Println("  -state path")
+	fmt.Println("              record every source file handled to path as soon as it is, and")
+	fmt.Println("              skip those recorded unchanged, to resume an interrupted run")
+	fmt.Println("  -hook command")
+	fmt.Println("              run command for every file copied or moved, like \"thumbnail {dst}\",")
+	fmt.Println("              where {src} and {dst} are its source and target, reporting failures")
+	fmt.Println("  -hook-once  run the hook once at the end instead, with {src} and {dst} the")
+	fmt.Println("              source and target paths given")
+	fmt.Println("  -hook-strict")
+	fmt.Println("              stop handling files once a hook fails")
+	fmt.Println("  -ordered-output")
+	fmt.Println("              print what is done to every file in the order files are found,")
+	fmt.Println("              the same from one run to the next, while still handling them at once")
+	fmt.Println("  -log-format format")
+	fmt.Println("              how what is done to every file is printed: plain, like")
+	fmt.Println("              src -----> dst, tsv, tab separated action, src and dst, or")
+	fmt.Println("              quoted, plain with the paths quoted(plain by default)")
+	fmt.Println("  -progress   show percentage and time left while copying files of 100MB")
+	fmt.Println("              or more")
+	fmt.Println("  -preserve-btime")
+	fmt.Println("              give copied files the creation time of the source too, on macOS")
+	fmt.Println("              and Windows")
+	fmt.Println("  -fsync policy")
+	fmt.Println("              flush files to disk before reporting them done: file their")
+	fmt.Println("              content, dir their directory entry too, for drives unplugged")
+	fmt.Println("              right after(off by default)")
+	fmt.Println("  -stats-json path")
+	fmt.Println("              write a JSON summary of the run to path")
+	fmt.Println("  -webhook url")
+	fmt.Println("              post the -stats-json summary, with a status of finished,")
+	fmt.Println("              aborted or interrupted, to url when the run ends")
+	fmt.Println("  -chmod mode give copied files the octal permissions mode, like 0644,")
+	fmt.Println("              instead of those of the source")
+	fmt.Println("  -dir-chmod mode")
+	fmt.Println("              give created directories the octal permissions mode, like 0755")
+	fmt.Println("  -targets dir1,dir2,...")
+	fmt.Println("              fill several targets in turn, like external disks: each file")
+	fmt.Println("              goes to the first one with enough free space left, or to the")
+	fmt.Println("              one having it already")
+	fmt.Println("  -targets-manifest path")
+	fmt.Println("              record the target every file went to with -targets to path as")
+	fmt.Println("              tab separated source, target directory and final target")
+	fmt.Println("  -compare-trees")
+	fmt.Println("              compare the trees source and target instead of copying: list")
+	fmt.Println("              files only in either and those in both with different content,")
+	fmt.Println("              exiting with 1 when any")
+	fmt.Println("  -verify-only")
+	fmt.Println("              check an earlier copy instead of copying: list source files")
+	fmt.Println("              missing at their target path or with different content there,")
+	fmt.Println("              exiting with 1 when any")
+	fmt.Println("  -skip-synced")
+	fmt.Println("              do nothing when neither source nor target changed since a run")
+	fmt.Println("              left them in sync, telling by names, sizes and modification")
+	fmt.Println("              times only, and record it after such runs")
+	fmt.Println("")
+	fmt.Println("paths may use environment variables like $HOME and a leading ~, write $$ for")
+	fmt.Println("a literal $")
 }
 
 var (
-	moveMode      bool   = false
-	fullHashMode  bool   = false
-	recursiveMode bool   = false
-	source        string = ""
-	target        string = ""
+	moveMode        bool   = false
+	fullHashMode    bool   = false
+	recursiveMode   bool   = false
+	clashLog        string = ""
+	eventsFile      string = ""
+	stateFile       string = ""
+	hashCache       string = ""
+	statsJSON       string = ""
+	webhook         string = ""
+	targetsManifest string = ""
+	compareTrees    bool   = false
+	verifyOnly      bool   = false
+	skipSynced      bool   = false
+	source          string = ""
+	target          string = ""
 )
 
 func parseArgs() error {
-	remainder := []string{}
-	invalidArg := []string{}
+	fullHashBelow := ""
+	sampleTier := ""
+	warnSkipOver := ""
+	collision := ""
+	collisionScope := ""
+	nameEncoding := ""
+	fsync := ""
+	empty := ""
+	onError := ""
+	onChange := ""
+	logFormat := ""
+	fileMode := ""
+	dirMode := ""
+	targets := ""
+
+	flags := flag.NewFlagSet("pcopy", flag.ContinueOnError)
+	flags.SetOutput(ioutil.Discard)
+	flags.BoolVar(&moveMode, "m", false, "")
+	flags.BoolVar(&pcopylib.SafeMove, "safe-move", false, "")
+	flags.BoolVar(&fullHashMode, "f", false, "")
+	flags.BoolVar(&pcopylib.QuickMode, "quick", false, "")
+	flags.DurationVar(&pcopylib.MtimeTolerance, "mtime-tolerance", 0, "")
+	flags.StringVar(&hashCache, "hash-cache", "", "")
+	flags.StringVar(&fullHashBelow, "full-hash-below", "500K", "")
+	flags.StringVar(&sampleTier, "sample-tier", "256M", "")
+	flags.StringVar(&warnSkipOver, "warn-skip-over", "", "")
+	flags.BoolVar(&recursiveMode, "r", false, "")
+	flags.BoolVar(&pcopylib.DirProgress, "dir-progress", false, "")
+	flags.BoolVar(&pcopylib.NoClobber, "no-clobber", false, "")
+	flags.BoolVar(&pcopylib.OverwriteIfLarger, "overwrite-if-larger", false, "")
+	flags.BoolVar(&pcopylib.RenameAlways, "rename-always", false, "")
+	flags.StringVar(&empty, "empty", "copy", "")
+	flags.BoolVar(&pcopylib.Gzip, "gzip", false, "")
+	flags.DurationVar(&pcopylib.FileTimeout, "file-timeout", 0, "")
+	flags.StringVar(&onChange, "on-change", "off", "")
+	flags.StringVar(&onError, "on-error", "continue", "")
+	flags.IntVar(&pcopylib.MaxOpenFiles, "max-open", 0, "")
+	flags.Int64Var(&pcopylib.FileLimit, "limit", 0, "")
+	flags.IntVar(&pcopylib.NearDupThreshold, "near-dup-threshold", -1, "")
+	flags.StringVar(&collision, "collision", "numeric", "")
+	flags.StringVar(&collisionScope, "collision-scope", "folder", "")
+	flags.StringVar(&nameEncoding, "name-encoding", "raw", "")
+	flags.StringVar(&clashLog, "rename-clashes-log", "", "")
+	flags.StringVar(&eventsFile, "events-file", "", "")
+	flags.StringVar(&stateFile, "state", "", "")
+	flags.StringVar(&pcopylib.Hook, "hook", "", "")
+	flags.BoolVar(&pcopylib.HookOnce, "hook-once", false, "")
+	flags.BoolVar(&pcopylib.HookStrict, "hook-strict", false, "")
+	flags.BoolVar(&pcopylib.OrderedOutput, "ordered-output", false, "")
+	flags.StringVar(&logFormat, "log-format", "plain", "")
+	flags.BoolVar(&pcopylib.Progress, "progress", false, "")
+	flags.BoolVar(&pcopylib.PreserveBirthTime, "preserve-btime", false, "")
+	flags.StringVar(&fsync, "fsync", "off", "")
+	flags.StringVar(&statsJSON, "stats-json", "", "")
+	flags.StringVar(&webhook, "webhook", "", "")
+	flags.StringVar(&fileMode, "chmod", "", "")
+	flags.StringVar(&dirMode, "dir-chmod", "", "")
+	flags.StringVar(&targets, "targets", "", "")
+	flags.StringVar(&targetsManifest, "targets-manifest", "", "")
+	flags.BoolVar(&pcopylib.PreserveParentTimes, "preserve-parent-times", false, "")
+	flags.BoolVar(&pcopylib.Dereference, "dereference", false, "")
+	flags.BoolVar(&pcopylib.CopyEmptyDirs, "copy-empty-dirs", true, "")
+	flags.BoolVar(&compareTrees, "compare-trees", false, "")
+	flags.BoolVar(&verifyOnly, "verify-only", false, "")
+	flags.BoolVar(&skipSynced, "skip-synced", false, "")
+
+	remainder, err := pcopylib.ParseFlags(flags, os.Args[1:])
+	switch {
+	case err == flag.ErrHelp:
+		longUsage()
+		os.Exit(0)
+	case err != nil && strings.HasPrefix(err.Error(), "flag provided but not defined: "):
+		return shortUsage(fmt.Sprintf("pcopy: error: unrecognized arguments: %s", strings.TrimPrefix(err.Error(), "flag provided but not defined: ")))
+	case err != nil:
+		return shortUsage(fmt.Sprintf("pcopy: error: %s", err))
+	}
+
+	collisionMap := map[string]pcopylib.CollisionStrategy{"numeric": pcopylib.CollisionStrategy_Numeric, "timestamp": pcopylib.CollisionStrategy_Timestamp, "hash": pcopylib.CollisionStrategy_Hash}
+	if strategy, ok := collisionMap[collision]; ok {
+		pcopylib.Collision = strategy
+	} else {
+		return shortUsage(fmt.Sprintf("pcopy: error: argument -collision: invalid choice: %s (choose from numeric, timestamp, hash)", collision))
+	}
+
+	collisionScopeMap := map[string]pcopylib.CollisionScope{"folder": pcopylib.CollisionScope_Folder, "tree": pcopylib.CollisionScope_Tree}
+	if scope, ok := collisionScopeMap[collisionScope]; ok {
+		pcopylib.TargetCollisionScope = scope
+	} else {
+		return shortUsage(fmt.Sprintf("pcopy: error: argument -collision-scope: invalid choice: %s (choose from folder, tree)", collisionScope))
+	}
+
+	nameEncodingMap := map[string]pcopylib.NameEncoding{"raw": pcopylib.NameEncoding_Raw, "escape": pcopylib.NameEncoding_Escape, "transliterate": pcopylib.NameEncoding_Transliterate}
+	if encoding, ok := nameEncodingMap[nameEncoding]; ok {
+		pcopylib.TargetNameEncoding = encoding
+	} else {
+		return shortUsage(fmt.Sprintf("pcopy: error: argument -name-encoding: invalid choice: %s (choose from raw, escape, transliterate)", nameEncoding))
+	}
+
+	logFormatMap := map[string]pcopylib.LogFormat{"plain": pcopylib.LogFormat_Plain, "tsv": pcopylib.LogFormat_TSV, "quoted": pcopylib.LogFormat_Quoted}
+	if format, ok := logFormatMap[logFormat]; ok {
+		pcopylib.ActionLogFormat = format
+	} else {
+		return shortUsage(fmt.Sprintf("pcopy: error: argument -log-format: invalid choice: %s (choose from plain, tsv, quoted)", logFormat))
+	}
+
+	onChangeMap := map[string]pcopylib.ChangePolicy{"off": pcopylib.ChangePolicy_Off, "flag": pcopylib.ChangePolicy_Flag, "retry": pcopylib.ChangePolicy_Retry, "skip": pcopylib.ChangePolicy_Skip}
+	if policy, ok := onChangeMap[onChange]; ok {
+		pcopylib.OnChange = policy
+	} else {
+		return shortUsage(fmt.Sprintf("pcopy: error: argument -on-change: invalid choice: %s (choose from off, flag, retry, skip)", onChange))
+	}
+
+	onErrorMap := map[string]pcopylib.ErrorPolicy{"continue": pcopylib.ErrorPolicy_Continue, "stop": pcopylib.ErrorPolicy_Stop}
+	if policy, ok := onErrorMap[onError]; ok {
+		pcopylib.OnError = policy
+	} else {
+		return shortUsage(fmt.Sprintf("pcopy: error: argument -on-error: invalid choice: %s (choose from continue, stop)", onError))
+	}
 
-	for idx, arg := range os.Args {
-		if idx == 0 {
-			continue
+	emptyMap := map[string]pcopylib.EmptyPolicy{"copy": pcopylib.EmptyPolicy_Copy, "skip": pcopylib.EmptyPolicy_Skip, "report": pcopylib.EmptyPolicy_Report}
+	if policy, ok := emptyMap[empty]; ok {
+		pcopylib.EmptyFiles = policy
+	} else {
+		return shortUsage(fmt.Sprintf("pcopy: error: argument -empty: invalid choice: %s (choose from copy, skip, report)", empty))
+	}
+
+	fsyncMap := map[string]pcopylib.FsyncPolicy{"off": pcopylib.FsyncPolicy_Off, "file": pcopylib.FsyncPolicy_File, "dir": pcopylib.FsyncPolicy_Dir}
+	if policy, ok := fsyncMap[fsync]; ok {
+		pcopylib.Fsync = policy
+	} else {
+		return shortUsage(fmt.Sprintf("pcopy: error: argument -fsync: invalid choice: %s (choose from off, file, dir)", fsync))
+	}
+
+	if size, err := pcopylib.ParseSize(fullHashBelow); err == nil {
+		pcopylib.FullHashBelow = size
+	} else {
+		return shortUsage(fmt.Sprintf("pcopy: error: argument -full-hash-below: invalid size %s", fullHashBelow))
+	}
+
+	if size, err := pcopylib.ParseSize(sampleTier); err == nil && size > 0 {
+		pcopylib.SampleTier = size
+	} else {
+		return shortUsage(fmt.Sprintf("pcopy: error: argument -sample-tier: invalid size %s", sampleTier))
+	}
+
+	if len(warnSkipOver) != 0 {
+		size, err := pcopylib.ParseSize(warnSkipOver)
+		if err != nil {
+			return shortUsage(fmt.Sprintf("pcopy: error: argument -warn-skip-over: invalid size %s", warnSkipOver))
 		}
+		pcopylib.WarnSkipOver = size
+	}
+
+	if pcopylib.MaxOpenFiles < 0 || pcopylib.MaxOpenFiles == 1 {
+		return shortUsage(fmt.Sprintf("pcopy: error: argument -max-open: invalid count %d (choose at least 2)", pcopylib.MaxOpenFiles))
+	}
+
+	if pcopylib.FileLimit < 0 {
+		return shortUsage(fmt.Sprintf("pcopy: error: argument -limit: invalid count %d", pcopylib.FileLimit))
+	}
 
-		switch {
-		case arg == "-h" || arg == "--help":
-			longUsage()
-			os.Exit(0)
-		case arg == "-m":
-			moveMode = true
-		case arg == "-f":
-			fullHashMode = true
-		case arg == "-r":
-			recursiveMode = true
-		case arg[:1] == "-":
-			invalidArg = append(invalidArg, arg)
-		default:
-			remainder = append(remainder, arg)
+	if pcopylib.RenameAlways && pcopylib.NoClobber {
+		return shortUsage(fmt.Sprint("pcopy: error: argument -rename-always: not allowed with argument -no-clobber"))
+	}
+
+	if pcopylib.RenameAlways && pcopylib.Collision != pcopylib.CollisionStrategy_Numeric {
+		return shortUsage(fmt.Sprintf("pcopy: error: argument -rename-always: not allowed with argument -collision %s", collision))
+	}
+
+	if len(webhook) != 0 {
+		if err := pcopylib.CheckWebhookURL(webhook); err != nil {
+			return shortUsage(fmt.Sprintf("pcopy: error: argument -webhook: invalid url %s, %s", webhook, err))
 		}
 	}
 
-	if len(remainder) > 2 {
-		invalidArg = append(invalidArg, remainder[:len(remainder)-2]...)
+	if pcopylib.Gzip && pcopylib.OverwriteIfLarger {
+		return shortUsage(fmt.Sprint("pcopy: error: argument -overwrite-if-larger: not allowed with argument -gzip"))
 	}
 
-	if len(remainder) < 2 {
+	if pcopylib.MtimeTolerance < 0 {
+		return shortUsage(fmt.Sprintf("pcopy: error: argument -mtime-tolerance: invalid tolerance %s (choose 0 or above)", pcopylib.MtimeTolerance))
+	}
+
+	if pcopylib.MtimeTolerance != 0 && !pcopylib.QuickMode {
+		return shortUsage(fmt.Sprint("pcopy: error: argument -mtime-tolerance: not allowed without argument -quick"))
+	}
+
+	if len(pcopylib.Hook) == 0 && pcopylib.HookOnce {
+		return shortUsage(fmt.Sprint("pcopy: error: argument -hook-once: not allowed without argument -hook"))
+	}
+
+	if len(pcopylib.Hook) == 0 && pcopylib.HookStrict {
+		return shortUsage(fmt.Sprint("pcopy: error: argument -hook-strict: not allowed without argument -hook"))
+	}
+
+	if len(fileMode) != 0 {
+		perm, err := strconv.ParseUint(fileMode, 8, 32)
+		if err != nil || perm == 0 || perm > 0777 {
+			return shortUsage(fmt.Sprintf("pcopy: error: argument -chmod: invalid mode %s", fileMode))
+		}
+		pcopylib.FileMode = os.FileMode(perm)
+	}
+
+	if len(dirMode) != 0 {
+		perm, err := strconv.ParseUint(dirMode, 8, 32)
+		if err != nil || perm == 0 || perm > 0777 {
+			return shortUsage(fmt.Sprintf("pcopy: error: argument -dir-chmod: invalid mode %s", dirMode))
+		}
+		pcopylib.DirMode = os.FileMode(perm)
+	}
+
+	if skipSynced {
+		conflicts := []struct {
+			set  bool
+			name string
+		}{
+			{moveMode, "-m"},
+			{len(targets) != 0, "-targets"},
+			{compareTrees, "-compare-trees"},
+			{verifyOnly, "-verify-only"},
+		}
+		for _, c := range conflicts {
+			if c.set {
+				return shortUsage(fmt.Sprintf("pcopy: error: argument %s: not allowed with argument -skip-synced", c.name))
+			}
+		}
+	}
+
+	if verifyOnly {
+		conflicts := []struct {
+			set  bool
+			name string
+		}{
+			{moveMode, "-m"},
+			{pcopylib.SafeMove, "-safe-move"},
+			{compareTrees, "-compare-trees"},
+			{len(targets) != 0, "-targets"},
+		}
+		for _, c := range conflicts {
+			if c.set {
+				return shortUsage(fmt.Sprintf("pcopy: error: argument %s: not allowed with argument -verify-only", c.name))
+			}
+		}
+	}
+
+	if compareTrees {
+		conflicts := []struct {
+			set  bool
+			name string
+		}{
+			{moveMode, "-m"},
+			{pcopylib.SafeMove, "-safe-move"},
+			{pcopylib.Gzip, "-gzip"},
+			{len(targets) != 0, "-targets"},
+		}
+		for _, c := range conflicts {
+			if c.set {
+				return shortUsage(fmt.Sprintf("pcopy: error: argument %s: not allowed with argument -compare-trees", c.name))
+			}
+		}
+	}
+
+	positionals := 2
+	if len(targets) != 0 {
+		pcopylib.SpillTargets = strings.Split(targets, ",")
+		positionals = 1
+	} else if len(targetsManifest) != 0 {
+		return shortUsage(fmt.Sprint("pcopy: error: argument -targets-manifest: not allowed without argument -targets"))
+	}
+
+	if len(remainder) > positionals {
+		return shortUsage(fmt.Sprintf("pcopy: error: unrecognized arguments: %s", strings.Join(remainder[:len(remainder)-positionals], " ")))
+	}
+
+	if len(remainder) < positionals {
 		return shortUsage(fmt.Sprint("pcopy: error: too few arguments"))
 	}
 
-	if len(invalidArg) > 0 {
-		return shortUsage(fmt.Sprintf("pcopy: error: unrecognized arguments: %s", strings.Join(invalidArg, " ")))
+	for idx, dir := range pcopylib.SpillTargets {
+		pcopylib.SpillTargets[idx] = pcopylib.ExpandPath(dir)
+		if len(pcopylib.SpillTargets[idx]) == 0 {
+			return shortUsage(fmt.Sprint("pcopy: error: argument -targets: empty path"))
+		}
 	}
 
-	source = remainder[0]
-	target = remainder[1]
+	for idx, arg := range remainder {
+		remainder[idx] = pcopylib.ExpandPath(arg)
+	}
+
+	for _, arg := range remainder {
+		if len(arg) == 0 {
+			return shortUsage(fmt.Sprint("pcopy: error: empty path argument"))
+		}
+	}
+
+	// names under source are cut from the clean paths of the walk
+	source = filepath.Clean(remainder[0])
+	if len(pcopylib.SpillTargets) != 0 {
+		target = pcopylib.SpillTargets[0]
+	} else {
+		target = remainder[1]
+	}
 
 	return nil
 }
 
-func main() {
-	runtime.GOMAXPROCS(runtime.NumCPU())
+// notifyWebhook posts the summary of the run to -webhook, only warning when
+// it fails.
+func notifyWebhook(status string, elapsed time.Duration) {
+	if len(webhook) == 0 {
+		return
+	}
+
+	if err := pcopylib.PostWebhook(webhook, status, elapsed); err != nil {
+		fmt.Printf("pcopy: warning: %s: webhook failed, %s\n", webhook, err)
+	}
+}
 
+// notifyOnInterrupt posts an interrupted run to -webhook before exiting.
+func notifyOnInterrupt(startTime time.Time) {
+	if len(webhook) == 0 {
+		return
+	}
+
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-interrupt
+		notifyWebhook("interrupted", time.Since(startTime))
+		os.Exit(130)
+	}()
+}
+
+// runCompareTrees prints how the trees a and b differ, diff style, and exits
+// with 1 when they do.
+func runCompareTrees(a, b string) {
+	diff, err := pcopylib.CompareTrees(a, b, fullHashMode, recursiveMode)
+	if err != nil {
+		fmt.Println(shortUsage(fmt.Sprint(err)))
+		os.Exit(1)
+	}
+
+	for _, rel := range diff.OnlyInA {
+		fmt.Printf("only in %s: %s\n", a, rel)
+	}
+	for _, rel := range diff.OnlyInB {
+		fmt.Printf("only in %s: %s\n", b, rel)
+	}
+	for _, rel := range diff.Differing {
+		fmt.Printf("differ: %s and %s\n", filepath.Join(a, rel), filepath.Join(b, rel))
+	}
+
+	fmt.Printf("pcopy: %d only in %s, %d only in %s, %d differing\n", len(diff.OnlyInA), a, len(diff.OnlyInB), b, len(diff.Differing))
+	if !diff.Empty() {
+		os.Exit(1)
+	}
+}
+
+// runVerifyOnly prints the source files whose copy under target is missing
+// or differs, and exits with 1 when any.
+func runVerifyOnly(source, target string) {
+	report, err := pcopylib.VerifyCopy(source, target, fullHashMode, recursiveMode)
+	if err != nil {
+		fmt.Println(shortUsage(fmt.Sprint(err)))
+		os.Exit(1)
+	}
+
+	for _, file := range report.Missing {
+		fmt.Printf("missing: %s\n", file)
+	}
+	for _, file := range report.Mismatched {
+		fmt.Printf("mismatched: %s\n", file)
+	}
+
+	fmt.Printf("pcopy: %d verified, %d missing, %d mismatched\n", report.Verified, len(report.Missing), len(report.Mismatched))
+	if !report.Intact() {
+		os.Exit(1)
+	}
+}
+
+// run copies source to target and returns the exit status, so that what it
+// defers, like unlocking the source, is done before main exits.
+func run() int {
 	if err := parseArgs(); err != nil {
 		fmt.Println(err)
-		os.Exit(1)
+		return 1
+	}
+
+	if compareTrees {
+		runCompareTrees(source, target)
+		return 0
+	}
+
+	if verifyOnly {
+		runVerifyOnly(source, target)
+		return 0
 	}
 
 	sourceStatus := pcopylib.IsFileExist(source)
+	if sourceStatus == pcopylib.FileExistStatus_NotExist && !pcopylib.Dereference && pcopylib.IsSymlink(source) {
+		// A dangling link is still copied as a link.
+		sourceStatus = pcopylib.FileExistStatus_File
+	}
 	if sourceStatus == pcopylib.FileExistStatus_NotExist {
 		fmt.Println(shortUsage(fmt.Sprintf("pcopy: error: %s: No such file or directory", source)))
-		os.Exit(1)
+		return 1
+	}
+
+	if moveMode {
+		sourceDir := source
+		if sourceStatus != pcopylib.FileExistStatus_Directory {
+			sourceDir = filepath.Dir(source)
+		}
+		if pcopylib.IsReadOnlyDir(sourceDir) {
+			fmt.Printf("pcopy: warning: %s: read-only, copying instead of moving\n", sourceDir)
+			moveMode = false
+		}
+	}
+
+	if moveMode && sourceStatus == pcopylib.FileExistStatus_Directory {
+		if err := pcopylib.LockDir(source); err != nil {
+			fmt.Println(shortUsage(fmt.Sprintf("pcopy: error: %s: %s", source, err)))
+			return 1
+		}
+		defer pcopylib.UnlockDir(source)
 	}
 
+	for _, dir := range pcopylib.SpillTargets {
+		if pcopylib.IsTargetExist(dir) != pcopylib.FileExistStatus_Directory {
+			fmt.Println(shortUsage(fmt.Sprintf("pcopy: error: %s: Invalid target, a directory expected", dir)))
+			return 1
+		}
+	}
+
+	if len(clashLog) != 0 {
+		if err := pcopylib.OpenClashLog(clashLog); err != nil {
+			fmt.Println(shortUsage(fmt.Sprintf("pcopy: error: %s: Can not create rename clashes log", clashLog)))
+			return 1
+		}
+		defer pcopylib.CloseClashLog()
+	}
+
+	if len(eventsFile) != 0 {
+		if err := pcopylib.OpenEventLog(eventsFile); err != nil {
+			fmt.Println(shortUsage(fmt.Sprintf("pcopy: error: %s: Can not create events file", eventsFile)))
+			return 1
+		}
+		defer pcopylib.CloseEventLog()
+	}
+
+	if len(stateFile) != 0 {
+		if err := pcopylib.OpenRunState(stateFile); err != nil {
+			fmt.Println(shortUsage(fmt.Sprintf("pcopy: error: %s: Can not open state file", stateFile)))
+			return 1
+		}
+		defer pcopylib.CloseRunState()
+	}
+
+	if len(targetsManifest) != 0 {
+		if err := pcopylib.OpenTargetsManifest(targetsManifest); err != nil {
+			fmt.Println(shortUsage(fmt.Sprintf("pcopy: error: %s: Can not create targets manifest", targetsManifest)))
+			return 1
+		}
+		defer pcopylib.CloseTargetsManifest()
+	}
+
+	if len(hashCache) != 0 {
+		if err := pcopylib.OpenHashCache(hashCache); err != nil {
+			fmt.Println(shortUsage(fmt.Sprintf("pcopy: error: %s: read hash cache failed, %s", hashCache, err)))
+			return 1
+		}
+		defer func() {
+			if err := pcopylib.CloseHashCache(); err != nil {
+				fmt.Printf("pcopy: error: %s: write hash cache failed\n", hashCache)
+			}
+		}()
+	}
+
+	pcopylib.CollisionRoot = target
+	if pcopylib.IsTargetExist(target) != pcopylib.FileExistStatus_Directory {
+		pcopylib.CollisionRoot = filepath.Dir(target)
+	}
+
+	startTime := time.Now()
+	notifyOnInterrupt(startTime)
+
+	syncTree := skipSynced && sourceStatus == pcopylib.FileExistStatus_Directory && pcopylib.IsTargetExist(target) == pcopylib.FileExistStatus_Directory
+	if syncTree && pcopylib.IsSynced(source, target, recursiveMode) {
+		fmt.Println("pcopy: nothing to do, source and target unchanged since they were in sync")
+		notifyWebhook("finished", time.Since(startTime))
+		return 0
+	}
+
+	stopped := false
 	if sourceStatus == pcopylib.FileExistStatus_File {
-		if err := pcopylib.CopyFile(source, target, moveMode, fullHashMode); err != nil {
+		pcopylib.RunStats.AddScanned()
+		if err := pcopylib.CopyFile(source, target, moveMode, fullHashMode); err != nil && !pcopylib.IsReported(err) {
 			fmt.Println(shortUsage(fmt.Sprint(err)))
-			os.Exit(1)
+			notifyWebhook("aborted", time.Since(startTime))
+			return 1
+		} else if err != nil {
+			stopped = pcopylib.OnError == pcopylib.ErrorPolicy_Stop
 		}
 	} else {
-		if err := pcopylib.CopyDirectory(source, target, moveMode, fullHashMode, recursiveMode); err != nil {
+		if err := pcopylib.CopyDirectory(source, target, moveMode, fullHashMode, recursiveMode); pcopylib.IsStopped(err) {
+			fmt.Println(err)
+			stopped = true
+		} else if err != nil {
 			fmt.Println(shortUsage(fmt.Sprint(err)))
-			os.Exit(1)
+			notifyWebhook("aborted", time.Since(startTime))
+			return 1
+		}
+	}
+
+	hookFailed := pcopylib.FinishHooks(source, target)
+
+	// only a run that copied everything leaves the trees in sync
+	if syncTree && pcopylib.RunStats.Snapshot().Failed == 0 && hookFailed == 0 && !pcopylib.LimitReached() {
+		if err := pcopylib.RecordSynced(source, target, recursiveMode); err != nil {
+			fmt.Printf("pcopy: warning: %s: record sync failed, %s\n", target, err)
 		}
 	}
+
+	fmt.Printf("pcopy: %s\n", pcopylib.Summary())
+	if failures := pcopylib.MetadataFailures(); len(failures) != 0 {
+		fmt.Printf("pcopy: %d file(s) whose mtime or mode could not be preserved:\n", len(failures))
+		for _, failure := range failures {
+			fmt.Printf("  %s\n", failure)
+		}
+	}
+	if changed := pcopylib.ChangedFilesFound(); len(changed) != 0 {
+		fmt.Printf("pcopy: %d file(s) modified during copy:\n", len(changed))
+		for _, file := range changed {
+			fmt.Printf("  %s\n", file)
+		}
+	}
+	if empties := pcopylib.EmptyFilesFound(); len(empties) != 0 {
+		fmt.Printf("pcopy: %d empty file(s) found:\n", len(empties))
+		for _, empty := range empties {
+			fmt.Printf("  %s\n", empty)
+		}
+	}
+	if pcopylib.LimitReached() {
+		fmt.Printf("pcopy: stopped after %d file(s), the limit, others left out\n", pcopylib.FileLimit)
+	}
+	if hookFailed > 0 {
+		fmt.Printf("pcopy: %d hook(s) failed\n", hookFailed)
+	}
+	if skipped := pcopylib.StateSkipped(); skipped > 0 {
+		fmt.Printf("pcopy: %d file(s) handled by an earlier run, skipped\n", skipped)
+	}
+
+	if len(statsJSON) != 0 {
+		if err := pcopylib.WriteStatsJSON(statsJSON, time.Since(startTime)); err != nil {
+			fmt.Printf("pcopy: error: %s: write stats failed\n", statsJSON)
+		}
+	}
+
+	if stopped || (hookFailed > 0 && pcopylib.HookStrict) {
+		notifyWebhook("aborted", time.Since(startTime))
+		return 1
+	}
+
+	notifyWebhook("finished", time.Since(startTime))
+
+	return 0
+}
+
+func main() {
+	runtime.GOMAXPROCS(runtime.NumCPU())
+	os.Exit(run())
 }
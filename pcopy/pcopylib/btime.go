@@ -0,0 +1,29 @@
+package pcopylib
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// PreserveBirthTime makes copies keep the creation time of their source too,
+// where the platform records one and lets it be set.
+var PreserveBirthTime bool = false
+
+var errBirthTimeUnsupported = errors.New("creation time can not be set on this platform")
+
+var birthTimeWarning sync.Once
+
+// preserveBirthTime gives target the creation time of source, warning once
+// when the platform does not support it.
+func preserveBirthTime(source, target string) {
+	err := copyBirthTime(source, target)
+	switch {
+	case err == errBirthTimeUnsupported:
+		birthTimeWarning.Do(func() {
+			fmt.Printf("pcopy: warning: %s, creation times not preserved\n", err)
+		})
+	case err != nil:
+		Outputf(source, "pcopy: warning: %s: Set creation time failed, %s\n", target, err)
+	}
+}
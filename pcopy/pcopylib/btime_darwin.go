@@ -0,0 +1,43 @@
+package pcopylib
+
+import (
+	"syscall"
+	"unsafe"
+)
+
+const (
+	attrBitMapCount = 5
+	attrCmnCrtime   = 0x00000200
+)
+
+// attrList is the struct attrlist of setattrlist(2).
+type attrList struct {
+	bitmapCount uint16
+	reserved    uint16
+	commonAttr  uint32
+	volAttr     uint32
+	dirAttr     uint32
+	fileAttr    uint32
+	forkAttr    uint32
+}
+
+func copyBirthTime(source, target string) error {
+	var st syscall.Stat_t
+	if err := syscall.Stat(source, &st); err != nil {
+		return err
+	}
+
+	path, err := syscall.BytePtrFromString(target)
+	if err != nil {
+		return err
+	}
+
+	attrs := attrList{bitmapCount: attrBitMapCount, commonAttr: attrCmnCrtime}
+	birthTime := st.Birthtimespec
+	_, _, errno := syscall.Syscall6(syscall.SYS_SETATTRLIST, uintptr(unsafe.Pointer(path)), uintptr(unsafe.Pointer(&attrs)), uintptr(unsafe.Pointer(&birthTime)), unsafe.Sizeof(birthTime), 0, 0)
+	if errno != 0 {
+		return errno
+	}
+
+	return nil
+}
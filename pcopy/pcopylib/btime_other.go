@@ -0,0 +1,8 @@
+//go:build !darwin && !windows
+// +build !darwin,!windows
+
+package pcopylib
+
+func copyBirthTime(source, target string) error {
+	return errBirthTimeUnsupported
+}
@@ -0,0 +1,31 @@
+package pcopylib
+
+import (
+	"os"
+	"syscall"
+)
+
+func copyBirthTime(source, target string) error {
+	fi, err := os.Stat(source)
+	if err != nil {
+		return err
+	}
+
+	data, ok := fi.Sys().(*syscall.Win32FileAttributeData)
+	if !ok {
+		return errBirthTimeUnsupported
+	}
+
+	path, err := syscall.UTF16PtrFromString(target)
+	if err != nil {
+		return err
+	}
+
+	handle, err := syscall.CreateFile(path, syscall.FILE_WRITE_ATTRIBUTES, syscall.FILE_SHARE_WRITE, nil, syscall.OPEN_EXISTING, syscall.FILE_FLAG_BACKUP_SEMANTICS, 0)
+	if err != nil {
+		return err
+	}
+	defer syscall.CloseHandle(handle)
+
+	return syscall.SetFileTime(handle, &data.CreationTime, nil, nil)
+}
@@ -0,0 +1,87 @@
+package pcopylib
+
+import (
+	"errors"
+	"os"
+	"sync"
+)
+
+type ChangePolicy int
+
+const (
+	ChangePolicy_Off ChangePolicy = iota
+	ChangePolicy_Flag
+	ChangePolicy_Retry
+	ChangePolicy_Skip
+)
+
+// OnChange selects what is done about a source whose size or mtime changed
+// while it was copied, as when an app is still writing it: nothing, listing
+// it at the end of the run, copying it again, or leaving it out. A move
+// never removes such a source.
+var OnChange ChangePolicy = ChangePolicy_Off
+
+// changeRetries is how many more times ChangePolicy_Retry copies a source
+// that keeps changing before leaving it out.
+const changeRetries = 3
+
+// errChangeSkipped is what copyStable returns for a source it left out for
+// changing during the copy, a skip rather than a failure.
+var errChangeSkipped = errors.New("modified during copy, skipped")
+
+var (
+	changedFiles      []string
+	changedFilesMutex sync.Mutex
+)
+
+// isUnchanged reports whether source still has the size and mtime before had.
+func isUnchanged(source string, before os.FileInfo) bool {
+	after, err := os.Stat(source)
+	return err == nil && after.Size() == before.Size() && after.ModTime().Equal(before.ModTime())
+}
+
+// copyStable copies source to target, checking under OnChange that source
+// did not change meanwhile. A changed source only counts as copied under
+// ChangePolicy_Flag and when not moving, otherwise its target is removed and
+// errChangeSkipped returned.
+func copyStable(source, target string, moving bool) error {
+	for attempt := 0; ; attempt++ {
+		before, err := os.Stat(source)
+		if err != nil || OnChange == ChangePolicy_Off {
+			return doCopy(source, target)
+		}
+
+		if err := doCopy(source, target); err != nil {
+			return err
+		}
+		if isUnchanged(source, before) {
+			return nil
+		}
+
+		if OnChange == ChangePolicy_Retry && attempt < changeRetries {
+			Outputf(source, "pcopy: warning: %s: modified during copy, copying again\n", source)
+			continue
+		}
+
+		changedFilesMutex.Lock()
+		changedFiles = append(changedFiles, source)
+		changedFilesMutex.Unlock()
+
+		if OnChange == ChangePolicy_Flag && !moving {
+			Outputf(source, "pcopy: warning: %s: modified during copy\n", source)
+			return nil
+		}
+
+		TargetStorage.Remove(target)
+		return errChangeSkipped
+	}
+}
+
+// ChangedFilesFound returns the sources found modified while they were
+// copied.
+func ChangedFilesFound() []string {
+	changedFilesMutex.Lock()
+	defer changedFilesMutex.Unlock()
+
+	return append([]string(nil), changedFiles...)
+}
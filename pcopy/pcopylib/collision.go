@@ -0,0 +1,87 @@
+package pcopylib
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+type CollisionScope int
+
+const (
+	CollisionScope_Folder CollisionScope = iota
+	CollisionScope_Tree
+)
+
+// TargetCollisionScope is how far a target name has to be unique. Folder
+// scope only takes the target path itself as taken, tree scope any file of
+// the same name anywhere under CollisionRoot, so that the tree can later be
+// flattened.
+var TargetCollisionScope CollisionScope = CollisionScope_Folder
+
+// CollisionRoot is the top of the target tree in tree scope.
+var CollisionRoot string = ""
+
+var (
+	treeNames      map[string][]string
+	treeNamesMutex sync.Mutex
+)
+
+// loadTreeNames indexes the files under CollisionRoot by name, once. Only a
+// local target can be listed, others only know the names written by the run.
+func loadTreeNames() {
+	if treeNames != nil {
+		return
+	}
+
+	treeNames = map[string][]string{}
+	if _, local := TargetStorage.(LocalStorage); !local || len(CollisionRoot) == 0 {
+		return
+	}
+
+	filepath.Walk(CollisionRoot, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() || info.Name() == LockFileName || info.Name() == SyncedFileName {
+			return nil
+		}
+
+		treeNames[info.Name()] = append(treeNames[info.Name()], path)
+		return nil
+	})
+}
+
+// addTreeName records target as written, in tree scope.
+func addTreeName(target string) {
+	if TargetCollisionScope != CollisionScope_Tree {
+		return
+	}
+
+	treeNamesMutex.Lock()
+	defer treeNamesMutex.Unlock()
+
+	loadTreeNames()
+	name := filepath.Base(target)
+	treeNames[name] = append(treeNames[name], target)
+}
+
+// takenBy returns the path whose name target can not take, target itself
+// when it exists, in tree scope another file of its name, "" when it is free.
+func takenBy(target string) string {
+	if isTargetTaken(target) {
+		return target
+	}
+
+	if TargetCollisionScope != CollisionScope_Tree {
+		return ""
+	}
+
+	treeNamesMutex.Lock()
+	defer treeNamesMutex.Unlock()
+
+	loadTreeNames()
+	for _, path := range treeNames[filepath.Base(target)] {
+		if isTargetTaken(path) {
+			return path
+		}
+	}
+	return ""
+}
@@ -0,0 +1,70 @@
+package pcopylib
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRenameFile(t *testing.T) {
+	tests := []struct {
+		tag    string
+		idx    int
+		result string
+	}{
+		{"", 1, "a(1).jpg"},
+		{"", 2, "a(2).jpg"},
+		{"20230516-142501", 1, "a_20230516-142501.jpg"},
+		{"20230516-142501", 2, "a_20230516-142501(1).jpg"},
+		{"20230516-142501", 3, "a_20230516-142501(2).jpg"},
+	}
+
+	for _, test := range tests {
+		if result := renameFile(test.tag, "a.jpg", test.idx); result != test.result {
+			t.Errorf("renameFile(%q, a.jpg, %d) = %s, want %s", test.tag, test.idx, result, test.result)
+		}
+	}
+}
+
+func TestTimestampCollisionBurst(t *testing.T) {
+	defer func(collision CollisionStrategy) { Collision = collision }(Collision)
+	Collision = CollisionStrategy_Timestamp
+
+	source, target := t.TempDir(), t.TempDir()
+	mtime := time.Date(2023, 5, 16, 14, 25, 1, 0, time.Local)
+
+	// a burst of shots sharing their name and timestamp, all different
+	const burst = 4
+	for i := 0; i < burst; i++ {
+		dir := filepath.Join(source, fmt.Sprint(i))
+		os.MkdirAll(dir, 0755)
+		file := filepath.Join(dir, "IMG_0001.jpg")
+		if err := ioutil.WriteFile(file, []byte(fmt.Sprint("shot ", i)), 0644); err != nil {
+			t.Fatal(err)
+		}
+		os.Chtimes(file, mtime, mtime)
+
+		if err := CopyFile(file, target, false, true); err != nil {
+			t.Fatalf("CopyFile(%s): %s", file, err)
+		}
+	}
+
+	names := []string{"IMG_0001.jpg", "IMG_0001_20230516-142501.jpg", "IMG_0001_20230516-142501(1).jpg", "IMG_0001_20230516-142501(2).jpg"}
+	for i, name := range names {
+		data, err := ioutil.ReadFile(filepath.Join(target, name))
+		if err != nil {
+			t.Errorf("shot %d: %s", i, err)
+			continue
+		}
+		if string(data) != fmt.Sprint("shot ", i) {
+			t.Errorf("%s holds %q, want shot %d", name, data, i)
+		}
+	}
+
+	if entries, _ := ioutil.ReadDir(target); len(entries) != burst {
+		t.Errorf("%d files in target, want %d", len(entries), burst)
+	}
+}
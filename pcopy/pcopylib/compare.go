@@ -0,0 +1,100 @@
+package pcopylib
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// TreeDiff lists the files of two trees that differ, by their paths relative
+// to the roots, sorted.
+type TreeDiff struct {
+	OnlyInA   []string
+	OnlyInB   []string
+	Differing []string
+}
+
+// Empty reports whether both trees hold the same files.
+func (d TreeDiff) Empty() bool {
+	return len(d.OnlyInA) == 0 && len(d.OnlyInB) == 0 && len(d.Differing) == 0
+}
+
+// listTree returns the regular files under root by their paths relative to
+// it, only those directly in it unless recursiveMode.
+func listTree(root string, recursiveMode bool) (map[string]bool, error) {
+	files := map[string]bool{}
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			if path == root {
+				return err
+			}
+			fmt.Printf("pcopy: warning: %s: read failed, skipped\n", path)
+			return nil
+		}
+
+		if info.IsDir() {
+			if path != root && !recursiveMode {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		if !info.Mode().IsRegular() || info.Name() == LockFileName || info.Name() == SyncedFileName {
+			return nil
+		}
+
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		files[rel] = true
+		return nil
+	})
+	return files, err
+}
+
+// CompareTrees compares the files of the local trees a and b by relative
+// path, telling contents apart as copies do, without changing either tree.
+func CompareTrees(a, b string, fullHashMode, recursiveMode bool) (TreeDiff, error) {
+	diff := TreeDiff{}
+
+	if IsFileExist(a) != FileExistStatus_Directory {
+		return diff, errors.New(fmt.Sprint("pcopy: error: ", a, ": No such directory"))
+	}
+	if IsFileExist(b) != FileExistStatus_Directory {
+		return diff, errors.New(fmt.Sprint("pcopy: error: ", b, ": No such directory"))
+	}
+
+	filesA, err := listTree(a, recursiveMode)
+	if err != nil {
+		return diff, errors.New(fmt.Sprintf("pcopy: error: %s: %s", a, err))
+	}
+	filesB, err := listTree(b, recursiveMode)
+	if err != nil {
+		return diff, errors.New(fmt.Sprintf("pcopy: error: %s: %s", b, err))
+	}
+
+	for rel := range filesA {
+		if !filesB[rel] {
+			diff.OnlyInA = append(diff.OnlyInA, rel)
+			continue
+		}
+
+		if !hasSameContent(filepath.Join(a, rel), filepath.Join(b, rel), fullHashMode) {
+			diff.Differing = append(diff.Differing, rel)
+		}
+	}
+
+	for rel := range filesB {
+		if !filesA[rel] {
+			diff.OnlyInB = append(diff.OnlyInB, rel)
+		}
+	}
+
+	sort.Strings(diff.OnlyInA)
+	sort.Strings(diff.OnlyInB)
+	sort.Strings(diff.Differing)
+	return diff, nil
+}
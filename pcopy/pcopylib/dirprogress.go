@@ -0,0 +1,129 @@
+package pcopylib
+
+import (
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// DirProgress reports every source directory of a recursive run as soon as
+// all of its files have been handled.
+var DirProgress bool = false
+
+type dirCount struct {
+	files  int
+	left   int
+	sealed bool
+}
+
+// DirTracker counts the files of every source directory left to be handled
+// by the workers. A directory is reported complete once sealed, when no more
+// of its files will be queued, and its last file is done.
+type DirTracker struct {
+	mutex sync.Mutex
+	root  string
+	dirs  map[string]*dirCount
+	stack []string
+}
+
+// NewDirTracker returns a tracker of the directories under root.
+func NewDirTracker(root string) *DirTracker {
+	return &DirTracker{root: root, dirs: map[string]*dirCount{}}
+}
+
+func isInDir(path, dir string) bool {
+	return path == dir || strings.HasPrefix(path, strings.TrimSuffix(dir, string(filepath.Separator))+string(filepath.Separator))
+}
+
+// Enter tells the tracker a walk in lexical order, like filepath.Walk, has
+// reached path, which seals the directories it has left.
+func (t *DirTracker) Enter(path string, isDir bool) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	parent := filepath.Dir(path)
+	for len(t.stack) != 0 && !isInDir(parent, t.stack[len(t.stack)-1]) {
+		t.seal(t.stack[len(t.stack)-1])
+		t.stack = t.stack[:len(t.stack)-1]
+	}
+
+	if isDir {
+		t.stack = append(t.stack, path)
+	}
+}
+
+// Add counts file as queued.
+func (t *DirTracker) Add(file string) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	dir := filepath.Dir(file)
+	count, ok := t.dirs[dir]
+	if !ok {
+		count = &dirCount{}
+		t.dirs[dir] = count
+	}
+	count.files++
+	count.left++
+}
+
+// Done counts file as handled.
+func (t *DirTracker) Done(file string) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	dir := filepath.Dir(file)
+	count, ok := t.dirs[dir]
+	if !ok {
+		return
+	}
+
+	count.left--
+	if count.sealed && count.left == 0 {
+		t.report(dir, count)
+	}
+}
+
+// Finish seals every directory once the walk is over, for walks not in
+// lexical order.
+func (t *DirTracker) Finish() {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	dirs := make([]string, 0, len(t.dirs))
+	for dir := range t.dirs {
+		dirs = append(dirs, dir)
+	}
+	sort.Strings(dirs)
+
+	for _, dir := range dirs {
+		t.seal(dir)
+	}
+	t.stack = nil
+}
+
+func (t *DirTracker) seal(dir string) {
+	count, ok := t.dirs[dir]
+	if !ok || count.sealed {
+		return
+	}
+
+	// Held in the output where it is sealed, wherever its last file is.
+	count.sealed = true
+	OutputQueue(dir + string(filepath.Separator))
+	if count.left == 0 {
+		t.report(dir, count)
+	}
+}
+
+func (t *DirTracker) report(dir string, count *dirCount) {
+	name, err := filepath.Rel(t.root, dir)
+	if err != nil || name == "." {
+		name = filepath.Base(t.root)
+	}
+
+	Outputf(dir+string(filepath.Separator), "Completed %s%c (%d file(s))\n", name, filepath.Separator, count.files)
+	OutputDone(dir + string(filepath.Separator))
+	delete(t.dirs, dir)
+}
@@ -0,0 +1,56 @@
+package pcopylib
+
+import (
+	"os"
+	"sync"
+)
+
+type EmptyPolicy int
+
+const (
+	EmptyPolicy_Copy EmptyPolicy = iota
+	EmptyPolicy_Skip
+	EmptyPolicy_Report
+)
+
+// EmptyFiles selects what happens to empty source files, often left by
+// interrupted transfers: copied like any other, skipped, or copied and listed
+// at the end of the run.
+var EmptyFiles EmptyPolicy = EmptyPolicy_Copy
+
+var (
+	emptyFiles      []string
+	emptyFilesMutex sync.Mutex
+)
+
+func isEmptyFile(source string) bool {
+	fi, err := os.Stat(source)
+	return err == nil && fi.Mode().IsRegular() && fi.Size() == 0
+}
+
+// skipEmpty applies EmptyFiles to source, reporting whether it was skipped.
+func skipEmpty(source, target string) bool {
+	if EmptyFiles == EmptyPolicy_Copy || !isEmptyFile(source) {
+		return false
+	}
+
+	if EmptyFiles == EmptyPolicy_Report {
+		emptyFilesMutex.Lock()
+		emptyFiles = append(emptyFiles, source)
+		emptyFilesMutex.Unlock()
+		return false
+	}
+
+	OutputAction(source, "empty", "xxxxxx", target, "empty, skipped")
+	RunStats.addSkipped()
+	logEvent(event{Event: "skip", Src: source, Dst: target, Reason: "empty"})
+	return true
+}
+
+// EmptyFilesFound returns the empty source files met under EmptyPolicy_Report.
+func EmptyFilesFound() []string {
+	emptyFilesMutex.Lock()
+	defer emptyFilesMutex.Unlock()
+
+	return append([]string(nil), emptyFiles...)
+}
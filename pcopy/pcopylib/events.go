@@ -0,0 +1,65 @@
+package pcopylib
+
+import (
+	"encoding/json"
+	"os"
+)
+
+// event is a line of the event log.
+type event struct {
+	Event  string `json:"event"`
+	Src    string `json:"src"`
+	Dst    string `json:"dst,omitempty"`
+	Bytes  int64  `json:"bytes,omitempty"`
+	Reason string `json:"reason,omitempty"`
+}
+
+// eventLog streams what happens to every file of the run, nil when disabled.
+var (
+	eventLog     *syncWriter
+	eventLogFile *os.File
+)
+
+// OpenEventLog starts streaming an event for every file handled to path, as
+// one JSON object per line: copy, move, identical, skip or fail, with the
+// source, the target and the bytes transferred or the reason. A path like
+// /dev/fd/3 streams to an inherited file descriptor.
+func OpenEventLog(path string) error {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+
+	eventLogFile = file
+	eventLog = &syncWriter{writer: file}
+	return nil
+}
+
+// CloseEventLog stops streaming events.
+func CloseEventLog() error {
+	if eventLogFile == nil {
+		return nil
+	}
+
+	eventLog = nil
+	return eventLogFile.Close()
+}
+
+func logEvent(e event) {
+	if eventLog == nil {
+		return
+	}
+
+	line, err := json.Marshal(e)
+	if err != nil {
+		return
+	}
+
+	eventLog.Write(append(line, '\n'))
+}
+
+// LogFailure streams a fail event for a source that could not be handled
+// before reaching pcopylib, like one whose target could not be resolved.
+func LogFailure(source string, err error) {
+	logEvent(event{Event: "fail", Src: source, Reason: err.Error()})
+}
@@ -0,0 +1,25 @@
+package pcopylib
+
+import "flag"
+
+// ParseFlags parses args with flags, allowing options and positional arguments
+// to be interleaved, and returns the positional ones. Everything after "--" is
+// taken as positional.
+func ParseFlags(flags *flag.FlagSet, args []string) ([]string, error) {
+	remainder := []string{}
+
+	for {
+		if err := flags.Parse(args); err != nil {
+			return nil, err
+		}
+
+		rest := flags.Args()
+		consumed := len(args) - len(rest)
+		if len(rest) == 0 || (consumed > 0 && args[consumed-1] == "--") {
+			return append(remainder, rest...), nil
+		}
+
+		remainder = append(remainder, rest[0])
+		args = rest[1:]
+	}
+}
@@ -0,0 +1,56 @@
+package pcopylib
+
+import (
+	"flag"
+	"io/ioutil"
+	"reflect"
+	"testing"
+)
+
+func newTestFlags() (*flag.FlagSet, *bool, *string) {
+	flags := flag.NewFlagSet("test", flag.ContinueOnError)
+	flags.SetOutput(ioutil.Discard)
+	move := flags.Bool("m", false, "")
+	limit := flags.String("limit", "", "")
+	return flags, move, limit
+}
+
+func TestParseFlags(t *testing.T) {
+	tests := []struct {
+		args      []string
+		remainder []string
+		move      bool
+		limit     string
+	}{
+		{[]string{}, []string{}, false, ""},
+		{[]string{"src", "dst"}, []string{"src", "dst"}, false, ""},
+		{[]string{"src", "-m", "dst"}, []string{"src", "dst"}, true, ""},
+		{[]string{"-m", "src", "--limit=10", "dst"}, []string{"src", "dst"}, true, "10"},
+		{[]string{"--m", "src", "--limit", "5", "dst"}, []string{"src", "dst"}, true, "5"},
+		{[]string{"", "dst"}, []string{"", "dst"}, false, ""},
+		{[]string{"-m", "--", "-src", "--limit=1"}, []string{"-src", "--limit=1"}, true, ""},
+		{[]string{"src", "--", "-m"}, []string{"src", "-m"}, false, ""},
+		{[]string{"--"}, []string{}, false, ""},
+	}
+
+	for _, test := range tests {
+		flags, move, limit := newTestFlags()
+		remainder, err := ParseFlags(flags, test.args)
+		if err != nil {
+			t.Errorf("ParseFlags(%q): %s", test.args, err)
+			continue
+		}
+		if !reflect.DeepEqual(remainder, test.remainder) || *move != test.move || *limit != test.limit {
+			t.Errorf("ParseFlags(%q) = %q, -m %v, -limit %q, want %q, -m %v, -limit %q", test.args, remainder, *move, *limit, test.remainder, test.move, test.limit)
+		}
+	}
+}
+
+func TestParseFlagsErrors(t *testing.T) {
+	for _, args := range [][]string{{"src", "-x"}, {"-limit"}, {"-m=maybe"}, {"-h"}} {
+		flags, _, _ := newTestFlags()
+		if _, err := ParseFlags(flags, args); err == nil {
+			t.Errorf("ParseFlags(%q) succeeded, want an error", args)
+		}
+	}
+}
@@ -0,0 +1,8 @@
+//go:build !linux && !darwin && !freebsd && !windows
+// +build !linux,!darwin,!freebsd,!windows
+
+package pcopylib
+
+func freeSpace(path string) (int64, error) {
+	return 0, errFreeSpaceUnsupported
+}
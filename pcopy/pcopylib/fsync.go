@@ -0,0 +1,55 @@
+package pcopylib
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+)
+
+type FsyncPolicy int
+
+const (
+	FsyncPolicy_Off FsyncPolicy = iota
+	FsyncPolicy_File
+	FsyncPolicy_Dir
+)
+
+// Fsync selects how far a copied or moved file is flushed to disk before it
+// is reported done: not at all, its content, or its content and the entry of
+// its directory, so that unplugging a drive right after loses nothing.
+var Fsync FsyncPolicy = FsyncPolicy_Off
+
+// syncFile flushes file to disk under FsyncPolicy_File and up, when its
+// storage can.
+func syncFile(file File) error {
+	if Fsync == FsyncPolicy_Off {
+		return nil
+	}
+
+	if syncer, ok := file.(interface {
+		Sync() error
+	}); ok {
+		return syncer.Sync()
+	}
+	return nil
+}
+
+// syncParentDir flushes the directory entry of target under FsyncPolicy_Dir,
+// for a local target. Windows can not flush directories, their entries are
+// written through.
+func syncParentDir(target string) error {
+	if Fsync != FsyncPolicy_Dir || runtime.GOOS == "windows" {
+		return nil
+	}
+	if _, local := TargetStorage.(LocalStorage); !local {
+		return nil
+	}
+
+	dir, err := os.Open(filepath.Dir(target))
+	if err != nil {
+		return err
+	}
+	defer dir.Close()
+
+	return dir.Sync()
+}
@@ -0,0 +1,65 @@
+package pcopylib
+
+import (
+	"compress/gzip"
+	"crypto/md5"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// Gzip writes copies gzip compressed, named after their source with .gz
+// appended, and compares existing targets by their decompressed content. A
+// compressed target is never matched against an uncompressed one, nor the
+// other way around.
+var Gzip bool = false
+
+func newGzipWriter(w io.Writer, source string, fileinfo os.FileInfo) *gzip.Writer {
+	gzipWriter := gzip.NewWriter(w)
+	gzipWriter.Name = filepath.Base(source)
+	gzipWriter.ModTime = fileinfo.ModTime()
+	return gzipWriter
+}
+
+// getGunzipHash returns the MD5 of the decompressed content of a gzip file,
+// "" when it can not be read. It is not cached, the cache keeps the hashes of
+// files as they are.
+func getGunzipHash(fs Storage, filename string) string {
+	acquireFiles(1)
+	defer releaseFiles(1)
+
+	file, err := fs.Open(filename)
+	if err != nil {
+		return ""
+	}
+	defer file.Close()
+
+	gzipReader, err := gzip.NewReader(file)
+	if err != nil {
+		return ""
+	}
+	defer gzipReader.Close()
+
+	md5Hash := md5.New()
+	if _, err := io.Copy(md5Hash, gzipReader); err != nil {
+		return ""
+	}
+	return fmt.Sprintf("%x", md5Hash.Sum(nil))
+}
+
+// getTargetHash returns the MD5 of the content of a target, decompressed
+// when copies are compressed.
+func getTargetHash(target string) string {
+	if Gzip {
+		return getGunzipHash(TargetStorage, target)
+	}
+	return getFullHash(TargetStorage, target)
+}
+
+// hasSameGunzipContent compares source with a compressed target, always by
+// the full hash as sizes and sampled blocks tell nothing of compressed data.
+func hasSameGunzipContent(source, target string) bool {
+	srcMD5 := getFullHash(LocalStorage{}, source)
+	return len(srcMD5) != 0 && srcMD5 == getGunzipHash(TargetStorage, target)
+}
@@ -0,0 +1,191 @@
+package pcopylib
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// hashCacheEntry is what is known of a file as of its size and mtime. A
+// hash is "" until it has been computed, and the partial one is prefixed by
+// the number of blocks sampled, like 4/hash.
+type hashCacheEntry struct {
+	size    int64
+	modTime int64
+	full    string
+	partial string
+}
+
+// hashCache keeps the hashes of local files across runs, nil when disabled.
+var (
+	hashCache      map[string]hashCacheEntry
+	hashCachePath  string
+	hashCacheMutex sync.Mutex
+	hashCacheDirty bool
+)
+
+// OpenHashCache starts reusing the hashes recorded at path for files whose
+// size and mtime have not changed since, and recording those computed. A
+// missing path starts an empty cache.
+func OpenHashCache(path string) error {
+	cache := map[string]hashCacheEntry{}
+
+	f, err := os.Open(path)
+	switch {
+	case os.IsNotExist(err):
+	case err != nil:
+		return err
+	default:
+		defer f.Close()
+
+		scanner := bufio.NewScanner(f)
+		for line := 1; scanner.Scan(); line++ {
+			fields := strings.SplitN(scanner.Text(), "\t", 5)
+			if len(fields) != 5 {
+				return errors.New(fmt.Sprintf("line %d: malformed", line))
+			}
+
+			entry := hashCacheEntry{full: fields[2], partial: fields[3]}
+			if entry.size, err = strconv.ParseInt(fields[0], 10, 64); err != nil {
+				return errors.New(fmt.Sprintf("line %d: malformed", line))
+			}
+			if entry.modTime, err = strconv.ParseInt(fields[1], 10, 64); err != nil {
+				return errors.New(fmt.Sprintf("line %d: malformed", line))
+			}
+			cache[fields[4]] = entry
+		}
+
+		if err := scanner.Err(); err != nil {
+			return err
+		}
+	}
+
+	hashCache = cache
+	hashCachePath = path
+	return nil
+}
+
+// CloseHashCache writes the hashes computed during the run back to the
+// cache and stops using it.
+func CloseHashCache() error {
+	hashCacheMutex.Lock()
+	defer hashCacheMutex.Unlock()
+
+	cache := hashCache
+	hashCache = nil
+	if cache == nil || !hashCacheDirty {
+		return nil
+	}
+
+	paths := make([]string, 0, len(cache))
+	for path := range cache {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	// Write aside and rename, so an interrupted run never leaves a truncated
+	// cache behind.
+	tmpPath := hashCachePath + ".tmp"
+	f, err := os.Create(tmpPath)
+	if err != nil {
+		return err
+	}
+
+	w := bufio.NewWriter(f)
+	for _, path := range paths {
+		entry := cache[path]
+		fmt.Fprintf(w, "%d\t%d\t%s\t%s\t%s\n", entry.size, entry.modTime, entry.full, entry.partial, path)
+	}
+
+	if err := w.Flush(); err != nil {
+		f.Close()
+		os.Remove(tmpPath)
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+
+	return os.Rename(tmpPath, hashCachePath)
+}
+
+// hashCacheKey returns the path filename is cached under and its size and
+// mtime, ok false when fs is not local or filename can not be stat.
+func hashCacheKey(fs Storage, filename string) (string, int64, int64, bool) {
+	if _, local := fs.(LocalStorage); !local {
+		return "", 0, 0, false
+	}
+
+	fileinfo, err := os.Stat(filename)
+	if err != nil {
+		return "", 0, 0, false
+	}
+
+	path, err := filepath.Abs(filename)
+	if err != nil {
+		return "", 0, 0, false
+	}
+
+	return path, fileinfo.Size(), fileinfo.ModTime().UnixNano(), true
+}
+
+// cachedHash returns the hash of filename computed by compute, reusing the
+// cached one when the file has not changed since. An empty sample selects the
+// full hash of the entry, any other the partial hash sampled so, as the
+// number of blocks, which is recomputed when sampled differently.
+func cachedHash(fs Storage, filename string, sample string, compute func() string) string {
+	hashCacheMutex.Lock()
+	enabled := hashCache != nil
+	hashCacheMutex.Unlock()
+	if !enabled {
+		return compute()
+	}
+
+	path, size, modTime, ok := hashCacheKey(fs, filename)
+	if !ok {
+		return compute()
+	}
+
+	hashCacheMutex.Lock()
+	entry, found := hashCache[path]
+	hashCacheMutex.Unlock()
+
+	if !found || entry.size != size || entry.modTime != modTime {
+		entry = hashCacheEntry{size: size, modTime: modTime}
+	}
+
+	full := len(sample) == 0
+	switch {
+	case full && len(entry.full) != 0:
+		return entry.full
+	case !full && strings.HasPrefix(entry.partial, sample+"/"):
+		return entry.partial[len(sample)+1:]
+	}
+
+	hash := compute()
+	if len(hash) == 0 {
+		return hash
+	}
+
+	if full {
+		entry.full = hash
+	} else {
+		entry.partial = sample + "/" + hash
+	}
+
+	hashCacheMutex.Lock()
+	if hashCache != nil {
+		hashCache[path] = entry
+		hashCacheDirty = true
+	}
+	hashCacheMutex.Unlock()
+
+	return hash
+}
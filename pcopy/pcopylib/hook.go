@@ -0,0 +1,107 @@
+package pcopylib
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// Hook is a command run for every file copied or moved, like
+// "thumbnail {dst}", where {src} and {dst} are replaced by the source and the
+// final target. It is split on spaces and run without a shell. With HookOnce
+// it is run once at the end of the run instead, with the source and target
+// given on the command line. A failed hook is reported and the run goes on,
+// unless HookStrict, which stops handling files.
+var (
+	Hook       string = ""
+	HookOnce   bool   = false
+	HookStrict bool   = false
+)
+
+// hookJobs is the number of hooks run at once.
+const hookJobs = 4
+
+var (
+	hookSlots   = make(chan struct{}, hookJobs)
+	hookWait    sync.WaitGroup
+	hookFailed  int64
+	hookAborted int32
+	hookAbort   sync.Once
+)
+
+var errHookAborted = errors.New("a hook failed, run aborted")
+
+func execHook(source, target string) error {
+	fields := strings.Fields(Hook)
+	if len(fields) == 0 {
+		return nil
+	}
+
+	replacer := strings.NewReplacer("{src}", source, "{dst}", target)
+	for idx, field := range fields {
+		fields[idx] = replacer.Replace(field)
+	}
+
+	output, err := exec.Command(fields[0], fields[1:]...).CombinedOutput()
+	if err != nil && len(output) != 0 {
+		return errors.New(fmt.Sprintf("%s: %s", err, strings.TrimSpace(string(output))))
+	}
+	return err
+}
+
+func failHook(source string, err error) {
+	Outputf(source, "%s: error: %s: hook failed, %s\n", Program, source, err)
+	atomic.AddInt64(&hookFailed, 1)
+	if HookStrict {
+		atomic.StoreInt32(&hookAborted, 1)
+	}
+}
+
+// runHook runs the hook for source handled to target in the background.
+func runHook(source, target string) {
+	if len(Hook) == 0 || HookOnce {
+		return
+	}
+
+	hookWait.Add(1)
+	go func() {
+		defer hookWait.Done()
+
+		hookSlots <- struct{}{}
+		defer func() { <-hookSlots }()
+
+		if err := execHook(source, target); err != nil {
+			failHook(source, err)
+		}
+	}()
+}
+
+// isHookAborted reports whether a hook failed with HookStrict, reporting it
+// the first time.
+func isHookAborted() bool {
+	if atomic.LoadInt32(&hookAborted) == 0 {
+		return false
+	}
+
+	hookAbort.Do(func() {
+		OutputNote("%s: error: %s\n", Program, errHookAborted)
+	})
+	return true
+}
+
+// FinishHooks waits for the hooks still running, runs the hook once for the
+// run with HookOnce, and returns the number of hooks that failed.
+func FinishHooks(source, target string) int64 {
+	hookWait.Wait()
+
+	if len(Hook) != 0 && HookOnce && !isHookAborted() {
+		if err := execHook(source, target); err != nil {
+			failHook(source, err)
+		}
+	}
+
+	return atomic.LoadInt64(&hookFailed)
+}
@@ -0,0 +1,31 @@
+package pcopylib
+
+import (
+	"errors"
+	"sync/atomic"
+)
+
+// FileLimit, when not zero, stops queuing files once that many have been
+// found, to try options on a subset of a large source.
+var FileLimit int64 = 0
+
+// ErrLimitReached is returned by walk callbacks to stop walking once
+// FileLimit files are queued.
+var ErrLimitReached = errors.New("file limit reached")
+
+var limitTaken int64
+
+// TakeLimit counts a file about to be queued, reporting false once FileLimit
+// files have been.
+func TakeLimit() bool {
+	if FileLimit == 0 {
+		return true
+	}
+
+	return atomic.AddInt64(&limitTaken, 1) <= FileLimit
+}
+
+// LimitReached reports whether files were left out because of FileLimit.
+func LimitReached() bool {
+	return FileLimit != 0 && atomic.LoadInt64(&limitTaken) > FileLimit
+}
@@ -0,0 +1,174 @@
+package pcopylib
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+)
+
+// Dereference makes a source that is a symbolic link be copied as the file it
+// points to. By default the link itself is recreated at the target.
+var Dereference bool = false
+
+// IsSymlink reports whether path is a symbolic link, dangling or not.
+func IsSymlink(path string) bool {
+	fileinfo, err := os.Lstat(path)
+	return err == nil && fileinfo.Mode()&os.ModeSymlink != 0
+}
+
+// ResolveDirLink returns the directory a source directory given as a link
+// points to, and path itself otherwise, as walks do not follow links.
+func ResolveDirLink(path string) string {
+	if !IsSymlink(path) {
+		return path
+	}
+
+	resolved, err := filepath.EvalSymlinks(path)
+	if err != nil || IsFileExist(resolved) != FileExistStatus_Directory {
+		return path
+	}
+
+	return resolved
+}
+
+// isSameLink reports whether target is a link pointing where source does.
+func isSameLink(source, target string) bool {
+	sourceLink, err := os.Readlink(source)
+	if err != nil {
+		return false
+	}
+
+	fiTarget, err := TargetStorage.Lstat(target)
+	if err != nil || fiTarget.Mode()&os.ModeSymlink == 0 {
+		return false
+	}
+
+	targetLink, err := TargetStorage.Readlink(target)
+	return err == nil && targetLink == linkAt(source, target, sourceLink)
+}
+
+// linkAt returns link, read from source, rewritten for a link at target to
+// point to the same place. A relative link is resolved against the folder of
+// source and made relative to the folder of target, or absolute when it can
+// not be.
+func linkAt(source, target, link string) string {
+	if filepath.IsAbs(link) {
+		return link
+	}
+
+	resolved, err := filepath.Abs(filepath.Join(filepath.Dir(source), link))
+	if err != nil {
+		return link
+	}
+
+	targetDir, err := filepath.Abs(filepath.Dir(target))
+	if err != nil {
+		return resolved
+	}
+
+	relative, err := filepath.Rel(targetDir, resolved)
+	if err != nil {
+		return resolved
+	}
+
+	return relative
+}
+
+// isTargetTaken reports whether anything is at target, a dangling link too,
+// which creating target would otherwise write through.
+func isTargetTaken(target string) bool {
+	_, err := TargetStorage.Lstat(target)
+	return err == nil
+}
+
+// isLinkOverLink reports whether source is a link to be recreated at target
+// where there is a link already, which is then not entered even if it points
+// to a directory.
+func isLinkOverLink(source, target string) bool {
+	if Dereference || !IsSymlink(source) {
+		return false
+	}
+
+	fiTarget, err := TargetStorage.Lstat(target)
+	return err == nil && fiTarget.Mode()&os.ModeSymlink != 0
+}
+
+// copyLink recreates the link source at target, renaming around a different
+// file or link already there, and removes source in move mode.
+func copyLink(source, target string, moveMode bool) error {
+	fiSource, err := os.Lstat(source)
+	if err != nil {
+		Outputf(source, "pcopy: error: %s: Link failed, %s\n", source, err)
+		RunStats.AddFailed()
+		logEvent(event{Event: "fail", Src: source, Dst: target, Reason: err.Error()})
+		return err
+	}
+
+	if fiTarget, err := TargetStorage.Lstat(target); err == nil && os.SameFile(fiSource, fiTarget) {
+		OutputAction(source, "same-file", "======", target, "same file, skipped")
+		RunStats.addSkipped()
+		logEvent(event{Event: "skip", Src: source, Dst: target, Reason: "same file"})
+		return nil
+	}
+
+	if isTargetTaken(target) && NoClobber {
+		OutputAction(source, "not-clobbered", "xxxxxx", target, "exists, not clobbered")
+		RunStats.addSkipped()
+		logEvent(event{Event: "skip", Src: source, Dst: target, Reason: "exists"})
+		return nil
+	}
+
+	intended := target
+	for renameIdx := 1; isTargetTaken(target) && !isSameLink(source, target); renameIdx++ {
+		target = numericName(intended, renameIdx)
+	}
+
+	if isTargetTaken(target) {
+		logClash(source, intended, target, true)
+		if moveMode {
+			os.Remove(source)
+		}
+		OutputAction(source, "identical", "======", target, "skipped")
+		RunStats.addIdentical()
+		logEvent(event{Event: "identical", Src: source, Dst: target})
+		logTarget(source, target)
+		return nil
+	}
+
+	if target != intended {
+		logClash(source, intended, target, false)
+	}
+
+	link, err := os.Readlink(source)
+	if err == nil {
+		err = TargetStorage.Symlink(linkAt(source, target, link), target)
+	}
+	if err == nil && moveMode {
+		err = os.Remove(source)
+	}
+	if err != nil {
+		Outputf(source, "pcopy: error: %s: Link failed, %s\n", source, err)
+		RunStats.AddFailed()
+		logEvent(event{Event: "fail", Src: source, Dst: target, Reason: err.Error()})
+		return err
+	}
+
+	if moveMode {
+		OutputAction(source, "move", "----->", target, "")
+		logEvent(event{Event: "move", Src: source, Dst: target})
+	} else {
+		OutputAction(source, "copy", "+++++>", target, "")
+		logEvent(event{Event: "copy", Src: source, Dst: target})
+	}
+	logTarget(source, target)
+	runHook(source, target)
+	if target != intended {
+		RunStats.addRenamed()
+	}
+	RunStats.addTransferred(moveMode, 0)
+	return nil
+}
+
+// errDirLink is returned for a link to a directory met with Dereference, which
+// is not followed so that a link to a parent can not loop forever.
+var errDirLink = errors.New("link to a directory, not followed")
@@ -0,0 +1,128 @@
+//go:build linux || darwin || freebsd || openbsd || netbsd
+// +build linux darwin freebsd openbsd netbsd
+
+package pcopylib
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCopyFileLinkRecreated(t *testing.T) {
+	defer func(dereference bool) { Dereference = dereference }(Dereference)
+	Dereference = false
+
+	source, target := t.TempDir(), t.TempDir()
+	photo := filepath.Join(source, "a.jpg")
+	if err := ioutil.WriteFile(photo, []byte("a"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(photo, filepath.Join(source, "link.jpg")); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := CopyFile(filepath.Join(source, "link.jpg"), filepath.Join(target, "link.jpg"), false, false); err != nil {
+		t.Fatal(err)
+	}
+
+	link, err := os.Readlink(filepath.Join(target, "link.jpg"))
+	if err != nil {
+		t.Fatalf("link not recreated: %s", err)
+	}
+	if link != photo {
+		t.Errorf("link recreated to %s, want %s", link, photo)
+	}
+}
+
+func TestCopyFileLinkRelative(t *testing.T) {
+	defer func(dereference bool) { Dereference = dereference }(Dereference)
+	Dereference = false
+
+	root := t.TempDir()
+	source, target := filepath.Join(root, "source", "album"), filepath.Join(root, "target")
+	os.MkdirAll(source, 0755)
+	os.MkdirAll(target, 0755)
+	if err := ioutil.WriteFile(filepath.Join(root, "source", "a.jpg"), []byte("a"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(filepath.Join("..", "a.jpg"), filepath.Join(source, "link.jpg")); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := CopyFile(filepath.Join(source, "link.jpg"), filepath.Join(target, "link.jpg"), false, false); err != nil {
+		t.Fatal(err)
+	}
+
+	link, err := os.Readlink(filepath.Join(target, "link.jpg"))
+	if err != nil {
+		t.Fatalf("link not recreated: %s", err)
+	}
+	if want := filepath.Join("..", "source", "a.jpg"); link != want {
+		t.Errorf("link recreated to %s, want %s", link, want)
+	}
+	if data, err := ioutil.ReadFile(filepath.Join(target, "link.jpg")); err != nil || string(data) != "a" {
+		t.Errorf("recreated link does not reach a.jpg: %v", err)
+	}
+
+	// a rerun finds the rewritten link the same rather than renaming around it
+	if err := CopyFile(filepath.Join(source, "link.jpg"), filepath.Join(target, "link.jpg"), false, false); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Lstat(filepath.Join(target, "link(1).jpg")); err == nil {
+		t.Errorf("rerun recreated the link as link(1).jpg")
+	}
+}
+
+func TestCopyFileLinkDereference(t *testing.T) {
+	defer func(dereference bool) { Dereference = dereference }(Dereference)
+	Dereference = true
+
+	source, target := t.TempDir(), t.TempDir()
+	photo := filepath.Join(source, "a.jpg")
+	if err := ioutil.WriteFile(photo, []byte("a"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(photo, filepath.Join(source, "link.jpg")); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := CopyFile(filepath.Join(source, "link.jpg"), filepath.Join(target, "link.jpg"), false, false); err != nil {
+		t.Fatal(err)
+	}
+
+	fi, err := os.Lstat(filepath.Join(target, "link.jpg"))
+	if err != nil {
+		t.Fatalf("link not copied: %s", err)
+	}
+	if !fi.Mode().IsRegular() {
+		t.Errorf("link copied as %s, want a regular file", fi.Mode())
+	}
+	if data, err := ioutil.ReadFile(filepath.Join(target, "link.jpg")); err != nil || string(data) != "a" {
+		t.Errorf("link copied without the content of a.jpg: %v", err)
+	}
+}
+
+func TestCopyFileLinkDangling(t *testing.T) {
+	defer func(dereference bool) { Dereference = dereference }(Dereference)
+	Dereference = false
+
+	source, target := t.TempDir(), t.TempDir()
+	missing := filepath.Join(source, "missing.jpg")
+	if err := os.Symlink(missing, filepath.Join(source, "link.jpg")); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := CopyFile(filepath.Join(source, "link.jpg"), filepath.Join(target, "link.jpg"), false, false); err != nil {
+		t.Fatal(err)
+	}
+
+	link, err := os.Readlink(filepath.Join(target, "link.jpg"))
+	if err != nil {
+		t.Fatalf("dangling link not recreated: %s", err)
+	}
+	if link != missing {
+		t.Errorf("dangling link recreated to %s, want %s", link, missing)
+	}
+}
@@ -0,0 +1,126 @@
+package pcopylib
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+// LockFileName is the name of the file LockDir creates in the directory it
+// locks. Walks skip it, so it is never copied or moved.
+const LockFileName = ".photoutils.lock"
+
+// staleLockAge is how old a lock whose process can not be checked, like one
+// taken on another host, has to be to be taken as left by a crashed run.
+const staleLockAge = 24 * time.Hour
+
+type lockOwner struct {
+	pid   int
+	host  string
+	since time.Time
+}
+
+func readLockOwner(path string) (lockOwner, error) {
+	owner := lockOwner{}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return owner, err
+	}
+	defer f.Close()
+
+	lines := []string{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+
+	if len(lines) < 3 {
+		return owner, errors.New("malformed lock")
+	}
+
+	if owner.pid, err = strconv.Atoi(lines[0]); err != nil {
+		return owner, err
+	}
+	owner.host = lines[1]
+	if owner.since, err = time.Parse(time.RFC3339, lines[2]); err != nil {
+		return owner, err
+	}
+
+	return owner, nil
+}
+
+func isProcessRunning(pid int) bool {
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+
+	// FindProcess fails on windows for processes that are gone, and signals
+	// can not be sent there.
+	if runtime.GOOS == "windows" {
+		return true
+	}
+
+	err = p.Signal(syscall.Signal(0))
+	return err == nil || err == syscall.EPERM
+}
+
+// isStaleLock reports whether the lock at path was left by a run that is no
+// longer going on: its process is gone, or it can not be told and the lock
+// is older than staleLockAge.
+func isStaleLock(path string, owner lockOwner, ownerErr error) bool {
+	if ownerErr != nil {
+		fi, err := os.Stat(path)
+		return err == nil && time.Since(fi.ModTime()) > staleLockAge
+	}
+
+	if host, err := os.Hostname(); err == nil && host == owner.host {
+		return owner.pid == os.Getpid() || !isProcessRunning(owner.pid)
+	}
+
+	return time.Since(owner.since) > staleLockAge
+}
+
+// LockDir takes an advisory lock on dir, so that a second run on it fails
+// rather than racing the first. A lock left by a crashed run is taken over.
+func LockDir(dir string) error {
+	path := filepath.Join(dir, LockFileName)
+
+	for attempt := 0; attempt < 2; attempt++ {
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if err == nil {
+			host, _ := os.Hostname()
+			fmt.Fprintf(f, "%d\n%s\n%s\n", os.Getpid(), host, time.Now().Format(time.RFC3339))
+			return f.Close()
+		}
+
+		if !os.IsExist(err) {
+			return err
+		}
+
+		owner, ownerErr := readLockOwner(path)
+		if !isStaleLock(path, owner, ownerErr) {
+			if ownerErr != nil {
+				return errors.New(fmt.Sprintf("locked by another run, remove %s if none is going on", path))
+			}
+			return errors.New(fmt.Sprintf("locked by process %d on %s since %s, remove %s if it is not running", owner.pid, owner.host, owner.since.Format("2006-01-02 15:04:05"), path))
+		}
+
+		fmt.Printf("pcopy: warning: %s: stale lock taken over\n", path)
+		os.Remove(path)
+	}
+
+	return errors.New(fmt.Sprintf("locked by another run, remove %s if none is going on", path))
+}
+
+// UnlockDir releases the lock LockDir took on dir.
+func UnlockDir(dir string) {
+	os.Remove(filepath.Join(dir, LockFileName))
+}
@@ -0,0 +1,61 @@
+package pcopylib
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sync"
+)
+
+// syncWriter serializes the writes of concurrent workers to writer, so lines
+// never interleave.
+type syncWriter struct {
+	mutex  sync.Mutex
+	writer io.Writer
+}
+
+func (w *syncWriter) Write(p []byte) (int, error) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	return w.writer.Write(p)
+}
+
+// clashLog records every target collision of the run, nil when disabled.
+var (
+	clashLog     *syncWriter
+	clashLogFile *os.File
+)
+
+// OpenClashLog starts recording every target collision to path, one tab
+// separated line of source, intended target, final target and whether the
+// existing file was identical.
+func OpenClashLog(path string) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	clashLogFile = file
+	clashLog = &syncWriter{writer: file}
+	fmt.Fprintln(clashLog, "source\tintended\tfinal\tidentical")
+	return nil
+}
+
+// CloseClashLog stops recording collisions.
+func CloseClashLog() error {
+	if clashLogFile == nil {
+		return nil
+	}
+
+	clashLog = nil
+	return clashLogFile.Close()
+}
+
+func logClash(source, intended, final string, identical bool) {
+	if clashLog == nil {
+		return
+	}
+
+	fmt.Fprintf(clashLog, "%s\t%s\t%s\t%t\n", source, intended, final, identical)
+}
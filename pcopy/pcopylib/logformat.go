@@ -0,0 +1,43 @@
+package pcopylib
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+type LogFormat int
+
+const (
+	LogFormat_Plain LogFormat = iota
+	LogFormat_TSV
+	LogFormat_Quoted
+)
+
+// ActionLogFormat selects how what happens to every file is printed: plain
+// lines with arrows like "src -----> dst", tab separated action, source and
+// target, or plain lines with the paths quoted.
+var ActionLogFormat LogFormat = LogFormat_Plain
+
+// tsvEscaper escapes what would break the fields of a tab separated line.
+var tsvEscaper = strings.NewReplacer("\\", "\\\\", "\t", "\\t", "\n", "\\n", "\r", "\\r")
+
+// OutputAction prints, about source, that action happened to it and target:
+// move, copy, identical and so on. The plain formats show action as marker,
+// the arrow between source and target, followed by note when there is one.
+func OutputAction(source, action, marker, target, note string) {
+	var line string
+	switch ActionLogFormat {
+	case LogFormat_TSV:
+		line = fmt.Sprintf("%s\t%s\t%s", action, tsvEscaper.Replace(source), tsvEscaper.Replace(target))
+	case LogFormat_Quoted:
+		line = fmt.Sprintf("%s %s %s", strconv.Quote(source), marker, strconv.Quote(target))
+	default:
+		line = fmt.Sprintf("%s %s %s", source, marker, target)
+	}
+
+	if len(note) != 0 && ActionLogFormat != LogFormat_TSV {
+		line += ", " + note
+	}
+	Outputf(source, "%s\n", line)
+}
@@ -0,0 +1,47 @@
+package pcopylib
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// metadataFailures records, by target, what of its source could not be
+// preserved on copied or moved files, in the order files were handled.
+var (
+	metadataFailures      = map[string][]string{}
+	metadataFailureOrder  []string
+	metadataFailuresMutex sync.Mutex
+)
+
+// recordMetadata warns that what, like mtime or mode, could not be preserved
+// on the target of source when err is not nil, and records it for the end of
+// the run. The copy itself still succeeded.
+func recordMetadata(source, target, what string, err error) {
+	if err == nil {
+		return
+	}
+
+	Outputf(source, "pcopy: warning: %s: Set %s failed, %s\n", target, what, err)
+
+	metadataFailuresMutex.Lock()
+	defer metadataFailuresMutex.Unlock()
+
+	if _, ok := metadataFailures[target]; !ok {
+		metadataFailureOrder = append(metadataFailureOrder, target)
+	}
+	metadataFailures[target] = append(metadataFailures[target], fmt.Sprintf("%s, %s", what, err))
+}
+
+// MetadataFailures returns a line for every file whose mtime or mode could
+// not be preserved, like on a file system without permissions, telling what.
+func MetadataFailures() []string {
+	metadataFailuresMutex.Lock()
+	defer metadataFailuresMutex.Unlock()
+
+	lines := make([]string, 0, len(metadataFailureOrder))
+	for _, target := range metadataFailureOrder {
+		lines = append(lines, fmt.Sprintf("%s: %s", target, strings.Join(metadataFailures[target], "; ")))
+	}
+	return lines
+}
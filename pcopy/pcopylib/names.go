@@ -0,0 +1,53 @@
+package pcopylib
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+)
+
+type NameEncoding int
+
+const (
+	NameEncoding_Raw NameEncoding = iota
+	NameEncoding_Escape
+	NameEncoding_Transliterate
+)
+
+// TargetNameEncoding selects what happens to bytes of source names that are
+// not valid UTF-8: kept as is, percent-escaped, or read as Latin-1.
+var TargetNameEncoding NameEncoding = NameEncoding_Raw
+
+// EncodeName applies TargetNameEncoding to a name taken from the source, each
+// element of a relative path is encoded on its own.
+func EncodeName(name string) string {
+	if TargetNameEncoding == NameEncoding_Raw || utf8.ValidString(name) {
+		return name
+	}
+
+	elements := strings.Split(name, string(filepath.Separator))
+	for idx, element := range elements {
+		elements[idx] = encodeElement(element)
+	}
+
+	return strings.Join(elements, string(filepath.Separator))
+}
+
+func encodeElement(element string) string {
+	encoded := make([]byte, 0, len(element)+8)
+	for len(element) > 0 {
+		r, size := utf8.DecodeRuneInString(element)
+		switch {
+		case r != utf8.RuneError || size != 1:
+			encoded = append(encoded, element[:size]...)
+		case TargetNameEncoding == NameEncoding_Escape:
+			encoded = append(encoded, fmt.Sprintf("%%%02X", element[0])...)
+		default:
+			encoded = append(encoded, string(rune(element[0]))...)
+		}
+		element = element[size:]
+	}
+
+	return string(encoded)
+}
@@ -0,0 +1,37 @@
+package pcopylib
+
+type ErrorPolicy int
+
+const (
+	ErrorPolicy_Continue ErrorPolicy = iota
+	ErrorPolicy_Stop
+)
+
+// OnError selects what a run does once a file fails: go on with the others,
+// or stop at the first failure, letting the files being handled finish.
+var OnError ErrorPolicy = ErrorPolicy_Continue
+
+// reportedError is a failure already reported and counted where it happened,
+// which callers only have to pass on.
+type reportedError struct {
+	error
+}
+
+// IsReported reports whether err is a failure already reported and counted,
+// like those CopyFile returns for the file it failed to copy.
+func IsReported(err error) bool {
+	_, ok := err.(reportedError)
+	return ok
+}
+
+// stoppedError is what a run stopped at its first failure returns.
+type stoppedError struct {
+	error
+}
+
+// IsStopped reports whether err tells a run stopped at its first failure under
+// ErrorPolicy_Stop, rather than it could not start.
+func IsStopped(err error) bool {
+	_, ok := err.(stoppedError)
+	return ok
+}
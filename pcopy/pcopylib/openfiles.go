@@ -0,0 +1,57 @@
+package pcopylib
+
+import "sync"
+
+// MaxOpenFiles is the number of files copies and hashes keep open at once
+// across all workers, 0 for half the open files limit of the process.
+var MaxOpenFiles int = 0
+
+// defaultMaxOpenFiles is used where the open files limit can not be read.
+const defaultMaxOpenFiles = 256
+
+// minOpenFiles is what a copy holds, its source and its target.
+const minOpenFiles = 2
+
+var (
+	openSlots     chan struct{}
+	openSlotsInit sync.Once
+	openMutex     sync.Mutex
+)
+
+func getOpenSlots() chan struct{} {
+	openSlotsInit.Do(func() {
+		limit := MaxOpenFiles
+		if limit <= 0 {
+			limit = defaultMaxOpenFiles
+			if rlimit, err := openFilesLimit(); err == nil {
+				limit = int(rlimit / 2)
+			}
+		}
+		if limit < minOpenFiles {
+			limit = minOpenFiles
+		}
+		openSlots = make(chan struct{}, limit)
+	})
+
+	return openSlots
+}
+
+// acquireFiles waits until n more files may be opened. The n slots are taken
+// together, so that two copies each holding one never wait on each other.
+func acquireFiles(n int) {
+	slots := getOpenSlots()
+
+	openMutex.Lock()
+	defer openMutex.Unlock()
+	for i := 0; i < n; i++ {
+		slots <- struct{}{}
+	}
+}
+
+// releaseFiles gives back the n slots taken by acquireFiles.
+func releaseFiles(n int) {
+	slots := getOpenSlots()
+	for i := 0; i < n; i++ {
+		<-slots
+	}
+}
@@ -0,0 +1,10 @@
+//go:build !linux && !darwin && !freebsd && !openbsd
+// +build !linux,!darwin,!freebsd,!openbsd
+
+package pcopylib
+
+import "errors"
+
+func openFilesLimit() (int64, error) {
+	return 0, errors.New("open files limit unsupported")
+}
@@ -0,0 +1,15 @@
+//go:build linux || darwin || freebsd || openbsd
+// +build linux darwin freebsd openbsd
+
+package pcopylib
+
+import "syscall"
+
+func openFilesLimit() (int64, error) {
+	var rlimit syscall.Rlimit
+	if err := syscall.Getrlimit(syscall.RLIMIT_NOFILE, &rlimit); err != nil {
+		return 0, err
+	}
+
+	return int64(rlimit.Cur), nil
+}
@@ -0,0 +1,140 @@
+package pcopylib
+
+import (
+	"bytes"
+	"fmt"
+	"sync"
+)
+
+// OrderedOutput holds back what is printed about every file until the files
+// queued before it are done, so that the log of a run with several workers is
+// in walk order and the same from one run to the next.
+var OrderedOutput bool = false
+
+// Program is the name of the tool running, which messages printed from the
+// background, like a failed hook, start with.
+var Program string = "pcopy"
+
+// outputOrder is the order files were queued in, a sequence number each, and
+// what is held back for them.
+type outputOrder struct {
+	mutex   sync.Mutex
+	next    int
+	queued  int
+	seqs    map[string]int
+	keys    map[int][]string
+	buffers map[int]*bytes.Buffer
+	done    map[int]bool
+}
+
+var output = outputOrder{
+	seqs:    map[string]int{},
+	keys:    map[int][]string{},
+	buffers: map[int]*bytes.Buffer{},
+	done:    map[int]bool{},
+}
+
+// OutputQueue gives file the next place in the output, as it is queued to a
+// worker. OutputDone has to follow once it is handled.
+func OutputQueue(file string) {
+	if !OrderedOutput {
+		return
+	}
+
+	output.mutex.Lock()
+	defer output.mutex.Unlock()
+
+	seq := output.queued
+	output.queued++
+	output.seqs[file] = seq
+	output.keys[seq] = append(output.keys[seq], file)
+	output.buffers[seq] = &bytes.Buffer{}
+}
+
+// OutputAlias makes what is printed about key go with file, like a file
+// extracted from it.
+func OutputAlias(key, file string) {
+	if !OrderedOutput {
+		return
+	}
+
+	output.mutex.Lock()
+	defer output.mutex.Unlock()
+
+	if seq, ok := output.seqs[file]; ok {
+		output.seqs[key] = seq
+		output.keys[seq] = append(output.keys[seq], key)
+	}
+}
+
+// Outputf prints what is about file, held back until its turn. What is about
+// a file never queued is printed at once.
+func Outputf(file string, format string, args ...interface{}) {
+	if !OrderedOutput {
+		fmt.Printf(format, args...)
+		return
+	}
+
+	output.mutex.Lock()
+	defer output.mutex.Unlock()
+
+	seq, ok := output.seqs[file]
+	if !ok {
+		fmt.Printf(format, args...)
+		return
+	}
+
+	fmt.Fprintf(output.buffers[seq], format, args...)
+}
+
+// OutputNote prints a message of the walk in turn with the files queued
+// before it.
+func OutputNote(format string, args ...interface{}) {
+	if !OrderedOutput {
+		fmt.Printf(format, args...)
+		return
+	}
+
+	output.mutex.Lock()
+	defer output.mutex.Unlock()
+
+	seq := output.queued
+	output.queued++
+	output.buffers[seq] = &bytes.Buffer{}
+	fmt.Fprintf(output.buffers[seq], format, args...)
+	output.done[seq] = true
+	output.flush()
+}
+
+// OutputDone prints what was held back for file, and for the files done
+// after it, once all files queued before it are done.
+func OutputDone(file string) {
+	if !OrderedOutput {
+		return
+	}
+
+	output.mutex.Lock()
+	defer output.mutex.Unlock()
+
+	seq, ok := output.seqs[file]
+	if !ok {
+		return
+	}
+
+	output.done[seq] = true
+	output.flush()
+}
+
+func (o *outputOrder) flush() {
+	for o.done[o.next] {
+		fmt.Print(o.buffers[o.next].String())
+
+		for _, key := range o.keys[o.next] {
+			delete(o.seqs, key)
+		}
+		delete(o.keys, o.next)
+		delete(o.buffers, o.next)
+		delete(o.done, o.next)
+		o.next++
+	}
+}
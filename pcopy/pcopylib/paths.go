@@ -0,0 +1,27 @@
+package pcopylib
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ExpandPath expands environment variables written as $VAR or ${VAR} in a
+// path given on the command line, and a leading ~ to the home directory.
+// $$ stands for a literal $.
+func ExpandPath(path string) string {
+	path = os.Expand(path, func(name string) string {
+		if name == "$" {
+			return "$"
+		}
+		return os.Getenv(name)
+	})
+
+	if path == "~" || strings.HasPrefix(path, "~"+string(filepath.Separator)) || strings.HasPrefix(path, "~/") {
+		if home, err := os.UserHomeDir(); err == nil {
+			path = filepath.Join(home, path[1:])
+		}
+	}
+
+	return path
+}
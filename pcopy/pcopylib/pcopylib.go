@@ -1,14 +1,20 @@
 package pcopylib
 
 import (
+	"compress/gzip"
+	"context"
 	"crypto/md5"
 	"errors"
 	"fmt"
+	"golang.org/x/sync/errgroup"
 	"io"
 	"os"
 	"path/filepath"
 	"sort"
 	"strconv"
+	"strings"
+	"syscall"
+	"time"
 )
 
 type FileExistStatus int
@@ -20,16 +26,119 @@ const (
 )
 
 func IsFileExist(path string) FileExistStatus {
-	fileinfo, err := os.Stat(path)
-	switch {
-	case err != nil:
-		return FileExistStatus_NotExist
-	case fileinfo.IsDir() == true:
-		return FileExistStatus_Directory
-	default:
-		return FileExistStatus_File
+	return fileExistStatus(LocalStorage{}, path)
+}
+
+// FileMode and DirMode, when not zero, are the permissions given to copied
+// files and created directories instead of mirroring the source.
+var (
+	FileMode os.FileMode = 0
+	DirMode  os.FileMode = 0
+)
+
+// MkdirAll creates a target directory along with any missing parents, giving
+// every directory it creates DirMode when it is set.
+func MkdirAll(path string) error {
+	if IsTargetExist(path) == FileExistStatus_Directory {
+		return nil
 	}
 
+	created := []string{}
+	if DirMode != 0 {
+		for dir := filepath.Clean(path); IsTargetExist(dir) == FileExistStatus_NotExist; dir = filepath.Dir(dir) {
+			created = append(created, dir)
+			if filepath.Dir(dir) == dir {
+				break
+			}
+		}
+	}
+
+	if err := TargetStorage.MkdirAll(path, os.ModePerm|os.ModeDir); err != nil {
+		return err
+	}
+
+	// deepest first, so that a mode without search permission does not lock
+	// the others out
+	for _, dir := range created {
+		if err := TargetStorage.Chmod(dir, DirMode); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// FileTimeout aborts the copy of a single file that makes no progress for
+// longer than it, zero means no limit.
+var FileTimeout time.Duration = 0
+
+// copyContext is io.Copy giving up once no read returns for timeout, each
+// read getting its own deadline under ctx, with the error of the context that
+// ended it, like context.DeadlineExceeded. Reads happen in a goroutine which
+// a read that never returns, as on a hung network share, leaves behind
+// rather than wedging the caller. Only the caller writes to dst.
+func copyContext(ctx context.Context, dst io.Writer, src io.Reader, timeout time.Duration) (int64, error) {
+	if timeout <= 0 {
+		return io.Copy(dst, src)
+	}
+
+	type chunk struct {
+		data []byte
+		err  error
+	}
+
+	chunks := make(chan chunk)
+	free := make(chan []byte, 1)
+	stop := make(chan struct{})
+	defer close(stop)
+
+	go func() {
+		for {
+			var buf []byte
+			select {
+			case buf = <-free:
+			case <-stop:
+				return
+			}
+
+			n, err := src.Read(buf)
+			select {
+			case chunks <- chunk{buf[:n], err}:
+			case <-stop:
+				return
+			}
+		}
+	}()
+
+	free <- make([]byte, 32*1024)
+	written := int64(0)
+	for {
+		readCtx, cancel := context.WithTimeout(ctx, timeout)
+		select {
+		case c := <-chunks:
+			cancel()
+			if len(c.data) > 0 {
+				nw, ew := dst.Write(c.data)
+				written += int64(nw)
+				if ew == nil && nw != len(c.data) {
+					ew = io.ErrShortWrite
+				}
+				if ew != nil {
+					return written, ew
+				}
+			}
+
+			if c.err == io.EOF {
+				return written, nil
+			}
+			if c.err != nil {
+				return written, c.err
+			}
+			free <- c.data[:cap(c.data)]
+		case <-readCtx.Done():
+			cancel()
+			return written, readCtx.Err()
+		}
+	}
 }
 
 func doCopy(source, target string) error {
@@ -38,44 +147,201 @@ func doCopy(source, target string) error {
 		return err
 	}
 
+	acquireFiles(2)
+	defer releaseFiles(2)
+
 	sourceFile, err := os.Open(source)
 	if err != nil {
 		return err
 	}
 	defer sourceFile.Close()
 
-	targetFile, err := os.Create(target)
+	targetFile, err := TargetStorage.Create(target)
 	if err != nil {
 		return err
 	}
-	if _, err := io.Copy(targetFile, sourceFile); err != nil {
+
+	var writer io.Writer = targetFile
+	var gzipWriter *gzip.Writer
+	if Gzip {
+		gzipWriter = newGzipWriter(targetFile, source, fileinfo)
+		writer = gzipWriter
+	}
+
+	var reader io.Reader = sourceFile
+	if Progress && fileinfo.Size() >= ProgressThreshold {
+		progress := newProgressReader(sourceFile, source, fileinfo.Size())
+		defer progress.finish()
+		reader = progress
+	}
+
+	// An incomplete target is removed, so that a rerun does not take it for a
+	// different file of the same name.
+	if _, err := copyContext(context.Background(), writer, reader, FileTimeout); err != nil {
 		targetFile.Close()
+		TargetStorage.Remove(target)
+		if err == context.DeadlineExceeded {
+			return errors.New(fmt.Sprintf("stalled for more than %s, aborted", FileTimeout))
+		}
+		return err
+	}
+
+	if gzipWriter != nil {
+		if err := gzipWriter.Close(); err != nil {
+			targetFile.Close()
+			TargetStorage.Remove(target)
+			return err
+		}
+	}
+
+	if err := syncFile(targetFile); err != nil {
+		targetFile.Close()
+		TargetStorage.Remove(target)
 		return err
 	}
 
 	err = targetFile.Close()
 	if err != nil {
+		TargetStorage.Remove(target)
 		return err
 	}
 
-	os.Chmod(target, fileinfo.Mode())
-	os.Chtimes(target, fileinfo.ModTime(), fileinfo.ModTime())
-	return nil
+	if FileMode != 0 {
+		recordMetadata(source, target, "mode", TargetStorage.Chmod(target, FileMode))
+	} else {
+		recordMetadata(source, target, "mode", TargetStorage.Chmod(target, fileinfo.Mode()))
+	}
+	recordMetadata(source, target, "mtime", TargetStorage.Chtimes(target, fileinfo.ModTime(), fileinfo.ModTime()))
+	if PreserveBirthTime {
+		preserveBirthTime(source, target)
+	}
+	return syncParentDir(target)
+}
+
+// SafeMove makes a move that has to copy the source remove it only once the
+// full hash of the target is verified to match, keeping it otherwise. It also
+// applies to sources removed as identical to their target.
+var SafeMove bool = false
+
+func isCrossDevice(err error) bool {
+	linkErr, ok := err.(*os.LinkError)
+	return ok && linkErr.Err == syscall.EXDEV
+}
+
+func isVerifiedCopy(source, target string) bool {
+	sourceHash := getFullHash(LocalStorage{}, source)
+	return len(sourceHash) != 0 && sourceHash == getTargetHash(target)
+}
+
+// moveByCopy moves source to a target on another file system, which can not
+// be renamed to, by copying it and removing it.
+func moveByCopy(source, target string) error {
+	if err := copyStable(source, target, true); err != nil {
+		return err
+	}
+
+	if SafeMove && !isVerifiedCopy(source, target) {
+		return errors.New("target does not match source, source kept")
+	}
+
+	return os.Remove(source)
+}
+
+// skipChanged reports source left out for changing while copied to target,
+// and returns errChangeSkipped.
+func skipChanged(source, target string, moveMode bool) error {
+	note := "modified during copy, skipped"
+	if moveMode {
+		note = "modified during copy, source kept"
+	}
+	OutputAction(source, "changed", "xxxxxx", target, note)
+	RunStats.addSkipped()
+	logEvent(event{Event: "skip", Src: source, Dst: target, Reason: "modified during copy"})
+	return errChangeSkipped
+}
+
+// copyOrMoveTo is doCopyOrMove returning the path source went to, empty when
+// it was left out.
+func copyOrMoveTo(source, target string, moveMode bool) (string, error) {
+	err := doCopyOrMove(source, target, moveMode)
+	if err == errChangeSkipped {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return target, nil
 }
 
 func doCopyOrMove(source, target string, moveMode bool) error {
+	size := int64(0)
+	if fileinfo, err := os.Stat(source); err == nil {
+		size = fileinfo.Size()
+	}
+
 	if moveMode {
-		os.Rename(source, target)
-		fmt.Printf("%s -----> %s\n", source, target)
+		// Renaming a link would move the link rather than what it points to,
+		// and renaming a file would not compress it.
+		var err error
+		if Gzip || (Dereference && IsSymlink(source)) {
+			err = moveByCopy(source, target)
+		} else {
+			err = TargetStorage.Rename(source, target)
+			if isCrossDevice(err) {
+				err = moveByCopy(source, target)
+			} else if err == nil {
+				err = syncParentDir(target)
+			}
+		}
+		if err == errChangeSkipped {
+			return skipChanged(source, target, moveMode)
+		}
+		if err != nil {
+			Outputf(source, "pcopy: error: %s: Move failed, %s\n", source, err)
+			RunStats.AddFailed()
+			logEvent(event{Event: "fail", Src: source, Dst: target, Reason: err.Error()})
+			return err
+		}
+		if FileMode != 0 {
+			recordMetadata(source, target, "mode", TargetStorage.Chmod(target, FileMode))
+		}
+		OutputAction(source, "move", "----->", target, "")
+		logEvent(event{Event: "move", Src: source, Dst: target, Bytes: size})
+		logTarget(source, target)
+		runHook(source, target)
 	} else {
-		doCopy(source, target)
-		fmt.Printf("%s +++++> %s\n", source, target)
+		err := copyStable(source, target, false)
+		if err == errChangeSkipped {
+			return skipChanged(source, target, moveMode)
+		}
+		if err != nil {
+			Outputf(source, "pcopy: error: %s: Copy failed, %s\n", source, err)
+			RunStats.AddFailed()
+			logEvent(event{Event: "fail", Src: source, Dst: target, Reason: err.Error()})
+			return err
+		}
+		OutputAction(source, "copy", "+++++>", target, "")
+		logEvent(event{Event: "copy", Src: source, Dst: target, Bytes: size})
+		logTarget(source, target)
+		runHook(source, target)
 	}
+
+	addTreeName(target)
+	RunStats.addTransferred(moveMode, size)
 	return nil
 }
 
-func getFullHash(filename string) string {
-	file, err := os.Open(filename)
+func getFullHash(fs Storage, filename string) string {
+	return cachedHash(fs, filename, "", func() string {
+		return computeFullHash(fs, filename)
+	})
+}
+
+func computeFullHash(fs Storage, filename string) string {
+	acquireFiles(1)
+	defer releaseFiles(1)
+
+	file, err := fs.Open(filename)
 	if err != nil {
 		return ""
 	}
@@ -86,28 +352,116 @@ func getFullHash(filename string) string {
 	return fmt.Sprintf("%x", md5Hash.Sum(nil))
 }
 
-func getParticalHash(filename string, filesize int64) string {
-	blockSize := int64(50 * 1024)
-	blockOffsets := []int64{int64(0), (filesize - blockSize) / 3, 2 * (filesize - blockSize) / 3, filesize - blockSize}
+// FullHashBelow is the size under which files are compared by their full
+// hash. Larger files are compared by the hash of sampled blocks, 4 of them, or
+// 4 for every whole SampleTier of their size, up to maxSampleBlocks.
+var (
+	FullHashBelow int64 = 500 * 1024
+	SampleTier    int64 = 256 * 1024 * 1024
+)
+
+const (
+	sampleBlockSize = 50 * 1024
+	maxSampleBlocks = 64
+)
+
+// sampleBlocks returns the number of blocks sampled from a file of filesize.
+func sampleBlocks(filesize int64) int {
+	blocks := int64(4)
+	if SampleTier > 0 && filesize > SampleTier {
+		blocks = 4 * (filesize / SampleTier)
+	}
+	if blocks > maxSampleBlocks {
+		blocks = maxSampleBlocks
+	}
+
+	return int(blocks)
+}
+
+func getParticalHash(fs Storage, filename string, filesize int64) string {
+	blocks := sampleBlocks(filesize)
+	return cachedHash(fs, filename, strconv.Itoa(blocks), func() string {
+		return computeParticalHash(fs, filename, filesize, blocks)
+	})
+}
+
+// computeParticalHash hashes blocks blocks evenly spread over the file, the
+// first at its start and the last at its end.
+func computeParticalHash(fs Storage, filename string, filesize int64, blocks int) string {
+	blockSize := int64(sampleBlockSize)
+	if filesize <= int64(blocks)*blockSize {
+		// Blocks that would overlap hash the whole file anyway, and empty
+		// files have no blocks to seek to.
+		return computeFullHash(fs, filename)
+	}
 
-	file, err := os.Open(filename)
+	acquireFiles(1)
+	defer releaseFiles(1)
+
+	file, err := fs.Open(filename)
 	if err != nil {
 		return ""
 	}
 	defer file.Close()
 
 	md5Hash := md5.New()
-	for _, offset := range blockOffsets {
-		file.Seek(offset, 0)
+	for i := 0; i < blocks; i++ {
+		file.Seek(int64(i)*(filesize-blockSize)/int64(blocks-1), 0)
 		io.CopyN(md5Hash, file, blockSize)
 	}
 
 	return fmt.Sprintf("%x", md5Hash.Sum(nil))
 }
 
+// FullHash returns the MD5 of a whole local file, "" when it can not be read.
+func FullHash(filename string) string {
+	return getFullHash(LocalStorage{}, filename)
+}
+
+// PartialHash returns the hash of the blocks of a local file compared in place
+// of its full hash when it is large, "" when it can not be read.
+func PartialHash(filename string) string {
+	fileinfo, err := os.Stat(filename)
+	if err != nil {
+		return ""
+	}
+
+	return getParticalHash(LocalStorage{}, filename, fileinfo.Size())
+}
+
+// QuickMode takes files of the same size and mtime as identical without
+// hashing them, much faster on repeated runs at a tiny risk of being wrong.
+var QuickMode bool = false
+
+// MtimeTolerance is how far apart the mtimes of files QuickMode takes as
+// identical may be, for copies that shifted them, like those to FAT or over
+// the network.
+var MtimeTolerance time.Duration = 0
+
+// isSameModTime reports whether the mtimes of source and target are equal
+// within MtimeTolerance.
+func isSameModTime(fiSource, fiTarget os.FileInfo) bool {
+	delta := fiSource.ModTime().Sub(fiTarget.ModTime())
+	if delta < 0 {
+		delta = -delta
+	}
+	return delta <= MtimeTolerance
+}
+
 func hasSameContent(source, target string, fullHashMode bool) bool {
-	fiSource, _ := os.Stat(source)
-	fiTarget, _ := os.Stat(target)
+	if Gzip {
+		return hasSameGunzipContent(source, target)
+	}
+
+	fiSource, err := os.Stat(source)
+	if err != nil {
+		return false
+	}
+
+	fiTarget, err := TargetStorage.Stat(target)
+	if err != nil {
+		return false
+	}
 
 	srcSize := fiSource.Size()
 	dstSize := fiTarget.Size()
@@ -116,81 +470,333 @@ func hasSameContent(source, target string, fullHashMode bool) bool {
 		return false
 	}
 
+	if QuickMode && isSameModTime(fiSource, fiTarget) {
+		return true
+	}
+
 	srcMD5 := ""
 	dstMD5 := ""
-	if !fullHashMode && srcSize > 500*1024 {
-		srcMD5 = getParticalHash(source, srcSize)
-		dstMD5 = getParticalHash(target, dstSize)
+	if !fullHashMode && srcSize > FullHashBelow {
+		srcMD5 = getParticalHash(LocalStorage{}, source, srcSize)
+		dstMD5 = getParticalHash(TargetStorage, target, dstSize)
 	} else {
-		srcMD5 = getFullHash(source)
-		dstMD5 = getFullHash(target)
+		srcMD5 = getFullHash(LocalStorage{}, source)
+		dstMD5 = getFullHash(TargetStorage, target)
 	}
 
 	return srcMD5 == dstMD5 && len(srcMD5) != 0 && len(dstMD5) != 0
 }
 
-func renameFile(target string, idx int) string {
+// WarnSkipOver, when not zero, warns of every file larger than it skipped as
+// identical to its target without comparing their full hashes, so that it
+// can be double checked with full hash mode.
+var WarnSkipOver int64 = 0
+
+// isFullyCompared reports whether hasSameContent compares source and target
+// by their full hashes, rather than by sampled blocks or mtimes.
+func isFullyCompared(source, target string, fullHashMode bool) bool {
+	if Gzip {
+		return true
+	}
+
+	fiSource, err := os.Stat(source)
+	if err != nil {
+		return false
+	}
+
+	if QuickMode {
+		if fiTarget, err := TargetStorage.Stat(target); err == nil && isSameModTime(fiSource, fiTarget) {
+			return false
+		}
+	}
+
+	return fullHashMode || fiSource.Size() <= FullHashBelow
+}
+
+type CollisionStrategy int
+
+const (
+	CollisionStrategy_Numeric CollisionStrategy = iota
+	CollisionStrategy_Timestamp
+	CollisionStrategy_Hash
+)
+
+// Collision selects how a target colliding with a different file is renamed.
+var Collision CollisionStrategy = CollisionStrategy_Numeric
+
+func numericName(target string, idx int) string {
 	extName := filepath.Ext(target)
-	newTarget := target[:len(target)-len(extName)] + "(" + strconv.Itoa(idx) + ")" + extName
-	return newTarget
+	return target[:len(target)-len(extName)] + "(" + strconv.Itoa(idx) + ")" + extName
 }
 
-func CopyFileInternal(source, target string, moveMode, fullHashMode bool) error {
-	if IsFileExist(target) == FileExistStatus_NotExist {
-		doCopyOrMove(source, target, moveMode)
-		return nil
+func taggedName(target, tag string) string {
+	extName := filepath.Ext(target)
+	return target[:len(target)-len(extName)] + "_" + tag + extName
+}
+
+// collisionTag returns what the timestamp and hash strategies tag the name
+// of source with when its target is taken: its mtime or content hash, read
+// once for all the names tried.
+func collisionTag(source string) string {
+	switch Collision {
+	case CollisionStrategy_Timestamp:
+		if fi, err := os.Stat(source); err == nil {
+			return fi.ModTime().Format("20060102-150405")
+		}
+	case CollisionStrategy_Hash:
+		if hash := getFullHash(LocalStorage{}, source); len(hash) != 0 {
+			return hash[:8]
+		}
+	}
+
+	return ""
+}
+
+// renameFile returns the idx-th candidate name when target is taken. Names
+// tagged by collisionTag come first, then numeric suffixes are added to the
+// tagged name, so bursts sharing a timestamp never overwrite each other.
+func renameFile(tag, target string, idx int) string {
+	switch {
+	case len(tag) == 0:
+		return numericName(target, idx)
+	case idx == 1:
+		return taggedName(target, tag)
+	default:
+		return numericName(taggedName(target, tag), idx-1)
+	}
+}
+
+// OverwriteIfLarger makes a same-name target that is smaller than its source be
+// overwritten rather than renamed around, repairing an interrupted copy.
+var OverwriteIfLarger bool = false
+
+// NoClobber makes any existing target, whatever its content, skip the source
+// and leave it in place.
+var NoClobber bool = false
+
+// RenameAlways makes any existing target, whatever its content, be renamed
+// around without reading either file, trading the skipping of identical
+// files for speed.
+var RenameAlways bool = false
+
+func isTruncatedCopy(source, target string) bool {
+	fiSource, err := os.Stat(source)
+	if err != nil {
+		return false
+	}
+
+	fiTarget, err := TargetStorage.Stat(target)
+	if err != nil || !fiTarget.Mode().IsRegular() {
+		return false
+	}
+
+	return fiTarget.Size() < fiSource.Size()
+}
+
+// isSameFile reports whether target is source itself, as when a file already
+// is where it would be copied or moved to.
+func isSameFile(source, target string) bool {
+	fiSource, err := os.Stat(source)
+	if err != nil {
+		return false
+	}
+
+	fiTarget, err := TargetStorage.Stat(target)
+	if err != nil {
+		return false
+	}
+
+	return os.SameFile(fiSource, fiTarget)
+}
+
+// CopyFileInternal copies or moves source to target and returns the path it
+// is at there: target, the name it was renamed to, or the identical file found
+// in its place. It is empty when source was left out.
+func CopyFileInternal(source, target string, moveMode, fullHashMode bool) (string, error) {
+	if isHookAborted() {
+		return "", errHookAborted
+	}
+
+	if skipEmpty(source, target) {
+		return "", nil
+	}
+
+	if len(SpillTargets) != 0 {
+		routed, release, err := routeTarget(source, target)
+		if err != nil {
+			Outputf(source, "pcopy: error: %s: %s\n", source, err)
+			RunStats.AddFailed()
+			logEvent(event{Event: "fail", Src: source, Dst: target, Reason: err.Error()})
+			return "", err
+		}
+		defer release()
+		target = routed
+	}
+
+	if IsSymlink(source) {
+		if !Dereference {
+			if err := copyLink(source, target, moveMode); err != nil {
+				return "", err
+			}
+			return target, nil
+		}
+
+		if IsFileExist(source) == FileExistStatus_Directory {
+			Outputf(source, "pcopy: error: %s: %s\n", source, errDirLink)
+			RunStats.AddFailed()
+			logEvent(event{Event: "fail", Src: source, Dst: target, Reason: errDirLink.Error()})
+			return "", errDirLink
+		}
+	}
+
+	plainTarget := target
+	if Gzip {
+		target += ".gz"
+	}
+
+	if isSameFile(source, target) {
+		OutputAction(source, "same-file", "======", target, "same file, skipped")
+		RunStats.addSkipped()
+		logEvent(event{Event: "skip", Src: source, Dst: target, Reason: "same file"})
+		return target, nil
+	}
+
+	if len(takenBy(target)) == 0 {
+		return copyOrMoveTo(source, target, moveMode)
+	}
+
+	if NoClobber {
+		OutputAction(source, "not-clobbered", "xxxxxx", target, "exists, not clobbered")
+		RunStats.addSkipped()
+		logEvent(event{Event: "skip", Src: source, Dst: target, Reason: "exists"})
+		return "", nil
+	}
+
+	if OverwriteIfLarger && isTruncatedCopy(source, target) {
+		Outputf(source, "%s is smaller than %s, repairing\n", target, source)
+		return copyOrMoveTo(source, target, moveMode)
 	}
 
 	renameIdx := 1
 	newTarget := target
-	for IsFileExist(newTarget) != FileExistStatus_NotExist && !hasSameContent(source, newTarget, fullHashMode) {
-		newTarget = renameFile(target, renameIdx)
+	tag := ""
+	for taken := takenBy(newTarget); len(taken) != 0 && (RenameAlways || !hasSameContent(source, taken, fullHashMode)); taken = takenBy(newTarget) {
+		if !RenameAlways && isNearDuplicate(source, taken) {
+			OutputAction(source, "near-duplicate", "~~~~~~", taken, "near duplicate, skipped")
+			RunStats.addSkipped()
+			logEvent(event{Event: "skip", Src: source, Dst: taken, Reason: "near duplicate"})
+			return "", nil
+		}
+
+		if renameIdx == 1 {
+			tag = collisionTag(source)
+		}
+		newTarget = renameFile(tag, plainTarget, renameIdx)
+		if Gzip {
+			newTarget += ".gz"
+		}
 		renameIdx += 1
 	}
 
+	renamed := newTarget != target
+	intended := target
 	target = newTarget
-	if IsFileExist(target) == FileExistStatus_NotExist {
-		doCopyOrMove(source, target, moveMode)
+	if taken := takenBy(target); len(taken) == 0 {
+		logClash(source, intended, target, false)
+		if written, err := copyOrMoveTo(source, target, moveMode); len(written) == 0 {
+			return written, err
+		}
+		if renamed {
+			RunStats.addRenamed()
+		}
 	} else {
+		// in tree scope the identical file may be in another folder
+		target = taken
+		logClash(source, intended, target, true)
+
+		// Taken before a move removes the source. A safe move compares the
+		// full hashes itself.
+		unverifiedSize := int64(0)
+		if fi, err := os.Stat(source); err == nil && WarnSkipOver > 0 && fi.Size() > WarnSkipOver && !(moveMode && SafeMove) && !isFullyCompared(source, target, fullHashMode) {
+			unverifiedSize = fi.Size()
+		}
+
 		if moveMode {
+			if SafeMove && !isVerifiedCopy(source, target) {
+				Outputf(source, "pcopy: error: %s: %s does not match, source kept\n", source, target)
+				RunStats.AddFailed()
+				logEvent(event{Event: "fail", Src: source, Dst: target, Reason: "target does not match, source kept"})
+				return "", errors.New("target does not match, source kept")
+			}
 			os.Remove(source)
 		}
-		fmt.Printf("%s ====== %s, skipped\n", source, target)
+		OutputAction(source, "identical", "======", target, "skipped")
+		RunStats.addIdentical()
+		logEvent(event{Event: "identical", Src: source, Dst: target})
+		logTarget(source, target)
+		if unverifiedSize > 0 {
+			Outputf(source, "pcopy: warning: %s: %d bytes skipped without comparing full hashes, verify with -f\n", source, unverifiedSize)
+		}
 	}
 
-	return nil
+	return target, nil
 }
 
+// CopyFile copies or moves source to target, or into it when it is a
+// directory. A failure to handle source is reported as it happens and
+// returned as such, see IsReported.
 func CopyFile(source, target string, moveMode, fullHashMode bool) error {
-	if IsFileExist(target) == FileExistStatus_Directory {
-		CopyFileInternal(source, filepath.Join(target, filepath.Base(source)), moveMode, fullHashMode)
+	_, err := CopyFileTo(source, target, moveMode, fullHashMode)
+	return err
+}
+
+// CopyFileTo is CopyFile returning the path source is at in the target, which
+// differs from target when it was renamed around another file or found
+// there already, and is empty when source was left out.
+func CopyFileTo(source, target string, moveMode, fullHashMode bool) (string, error) {
+	var written string
+	var err error
+	if IsTargetExist(target) == FileExistStatus_Directory && !isLinkOverLink(source, target) {
+		written, err = CopyFileInternal(source, filepath.Join(target, EncodeName(filepath.Base(source))), moveMode, fullHashMode)
 	} else {
 		targetPath := filepath.Dir(target)
 		if len(targetPath) == 0 {
 			targetPath = "./"
 		}
 
-		if IsFileExist(targetPath) != FileExistStatus_Directory {
-			return errors.New(fmt.Sprintf("pcopy: error: %s/: No such file or directory", targetPath))
+		if IsTargetExist(targetPath) != FileExistStatus_Directory {
+			return "", errors.New(fmt.Sprintf("pcopy: error: %s/: No such file or directory", targetPath))
 		}
 
-		CopyFileInternal(source, target, moveMode, fullHashMode)
+		written, err = CopyFileInternal(source, target, moveMode, fullHashMode)
 	}
 
-	return nil
+	if err != nil {
+		return "", reportedError{err}
+	}
+	return written, nil
 }
 
-type fileEntry struct {
-	path string
-	info os.FileInfo
+// SkipRepeated reports source as skipped for having the content of original,
+// another source file copied in its place.
+func SkipRepeated(source, original string) {
+	OutputAction(source, "repeated", "======", original, "repeated in source, skipped")
+	RunStats.addSkipped()
+	logEvent(event{Event: "skip", Src: source, Dst: original, Reason: "repeated in source"})
 }
 
+// CopyEmptyDirs makes CopyDirectory recreate source directories at the target
+// even when no file ends up being copied into them.
+var CopyEmptyDirs bool = true
+
 func CopyDirectory(source, target string, moveMode, fullHashMode, recursiveMode bool) error {
+	source = ResolveDirLink(filepath.Clean(source))
+
 	if source == target {
-		return errors.New(fmt.Sprint("pcopy: error: %s and %s are identical (not copied).", source, target))
+		return errors.New(fmt.Sprintf("pcopy: error: %s and %s are identical (not copied).", source, target))
 	}
 
-	targetStatus := IsFileExist(target)
+	targetStatus := IsTargetExist(target)
 	if targetStatus != FileExistStatus_Directory {
 		return errors.New(fmt.Sprint("pcopy: error: ", target, ": Invalid target, a directory expected"))
 	}
@@ -200,28 +806,66 @@ func CopyDirectory(source, target string, moveMode, fullHashMode, recursiveMode
 		jobNum = 10
 	}
 
-	copyFileJobs := make(chan fileEntry, jobNum)
-	copyDone := make(chan struct{}, jobNum)
+	var tracker *DirTracker
+	if DirProgress && recursiveMode {
+		tracker = NewDirTracker(source)
+	}
+
+	// The first failure cancels the group under ErrorPolicy_Stop: files not
+	// started yet are left alone and the walk stops.
+	group, ctx := errgroup.WithContext(context.Background())
+	group.SetLimit(jobNum)
 
-	for i := 0; i < jobNum; i++ {
-		go func(copyDone chan<- struct{}, target string, copyFileJobs <-chan fileEntry) {
-			for job := range copyFileJobs {
-				sourceFilePath := job.path
-				targetFilePath := filepath.Join(target, job.path[len(source)+1:])
-				err := CopyFile(sourceFilePath, targetFilePath, moveMode, fullHashMode)
+	copyJob := func(sourceFilePath string) error {
+		defer OutputDone(sourceFilePath)
+		if tracker != nil {
+			defer tracker.Done(sourceFilePath)
+		}
 
-				if err != nil {
-					fmt.Printf("pcopy: error: %s: Copy %s failed, skiped", sourceFilePath)
-				}
-			}
+		if ctx.Err() != nil {
+			return nil
+		}
+
+		// stat before a move takes the source away
+		info, _ := os.Lstat(sourceFilePath)
+
+		targetFilePath := filepath.Join(target, EncodeName(sourceFilePath[len(source)+1:]))
+		if !CopyEmptyDirs {
+			MkdirAll(filepath.Dir(targetFilePath))
+		}
 
-			copyDone <- struct{}{}
-		}(copyDone, target, copyFileJobs)
+		err := CopyFile(sourceFilePath, targetFilePath, moveMode, fullHashMode)
+		if err != nil && !IsReported(err) {
+			Outputf(sourceFilePath, "pcopy: error: %s: Copy failed, skiped\n", sourceFilePath)
+			RunStats.AddFailed()
+			LogFailure(sourceFilePath, err)
+		}
+		if err == nil {
+			RecordDone(sourceFilePath, info)
+		}
+
+		if err != nil && OnError == ErrorPolicy_Stop {
+			return errors.New(fmt.Sprintf("%s: %s", sourceFilePath, strings.TrimPrefix(err.Error(), "pcopy: error: ")))
+		}
+		return nil
 	}
 
 	dirList := make([]string, 0, 100)
 
 	filepath.Walk(source, func(path string, info os.FileInfo, err error) error {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		if err != nil {
+			OutputNote("pcopy: error: %s: Read failed, skiped\n", path)
+			return nil
+		}
+
+		if tracker != nil {
+			tracker.Enter(path, info.IsDir())
+		}
+
 		if info.IsDir() {
 			if source == path {
 				return nil
@@ -231,37 +875,88 @@ func CopyDirectory(source, target string, moveMode, fullHashMode, recursiveMode
 				return filepath.SkipDir
 			}
 
-			relativeSourceDirectory := path[len(source)+1:]
+			dirList = append(dirList, path)
+			if !CopyEmptyDirs {
+				return nil
+			}
+
+			relativeSourceDirectory := EncodeName(path[len(source)+1:])
 			targetDirectory := filepath.Join(target, relativeSourceDirectory)
 
-			if IsFileExist(targetDirectory) == FileExistStatus_NotExist {
-				os.MkdirAll(targetDirectory, os.ModePerm|os.ModeDir)
+			if IsTargetExist(targetDirectory) == FileExistStatus_NotExist {
+				MkdirAll(targetDirectory)
 			}
 
-			if IsFileExist(targetDirectory) != FileExistStatus_Directory {
-				fmt.Printf("pcopy: error: %s: Directory can not be created, skiped", targetDirectory)
+			if IsTargetExist(targetDirectory) != FileExistStatus_Directory {
+				OutputNote("pcopy: error: %s: Directory can not be created, skiped\n", targetDirectory)
+				dirList = dirList[:len(dirList)-1]
 				return filepath.SkipDir
 			}
+		} else if info.Name() != LockFileName && info.Name() != SyncedFileName {
+			if IsDone(path, info) {
+				return nil
+			}
 
-			dirList = append(dirList, path)
-		} else {
-			copyFileJobs <- fileEntry{path, info}
+			if !TakeLimit() {
+				return ErrLimitReached
+			}
+
+			RunStats.AddScanned()
+			if tracker != nil {
+				tracker.Add(path)
+			}
+			OutputQueue(path)
+			group.Go(func() error {
+				return copyJob(path)
+			})
 		}
 		return nil
 	})
 
-	close(copyFileJobs)
-
-	for i := 0; i < jobNum; i++ {
-		<-copyDone
+	if tracker != nil {
+		tracker.Finish()
 	}
+	stopErr := group.Wait()
 
 	if moveMode {
-		sort.Sort(sort.Reverse(sort.StringSlice(dirList)))
-		for _, dirToRemove := range dirList {
-			os.Remove(dirToRemove)
-		}
+		RemoveEmptyDirs(dirList)
 	}
 
+	if stopErr != nil {
+		return stoppedError{errors.New(fmt.Sprintf("pcopy: error: stopped at the first failure, %s", stopErr))}
+	}
 	return nil
 }
+
+// PreserveParentTimes makes RemoveEmptyDirs restore the modification times the
+// parents of the directories it removes had before.
+var PreserveParentTimes bool = false
+
+// RemoveEmptyDirs removes those of dirs left empty, deepest first so that
+// directories emptied by removing their subdirectories go too.
+func RemoveEmptyDirs(dirs []string) {
+	parentTimes := map[string]time.Time{}
+	if PreserveParentTimes {
+		for _, dir := range dirs {
+			parent := filepath.Dir(dir)
+			if _, ok := parentTimes[parent]; ok {
+				continue
+			}
+
+			if fi, err := os.Stat(parent); err == nil {
+				parentTimes[parent] = fi.ModTime()
+			}
+		}
+	}
+
+	sort.Sort(sort.Reverse(sort.StringSlice(dirs)))
+	for _, dirToRemove := range dirs {
+		os.Remove(dirToRemove)
+	}
+
+	for parent, modTime := range parentTimes {
+		if IsFileExist(parent) == FileExistStatus_Directory {
+			os.Chtimes(parent, time.Now(), modTime)
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package pcopylib
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCopyDirectoryEmptyDirs(t *testing.T) {
+	defer func(copyEmptyDirs bool) { CopyEmptyDirs = copyEmptyDirs }(CopyEmptyDirs)
+
+	for _, copyEmptyDirs := range []bool{true, false} {
+		source, target := t.TempDir(), t.TempDir()
+		os.MkdirAll(filepath.Join(source, "empty", "nested"), 0755)
+		os.MkdirAll(filepath.Join(source, "full"), 0755)
+		if err := ioutil.WriteFile(filepath.Join(source, "full", "a.jpg"), []byte("a"), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		CopyEmptyDirs = copyEmptyDirs
+		if err := CopyDirectory(source, target, false, false, true); err != nil {
+			t.Fatalf("CopyDirectory with CopyEmptyDirs %v: %s", copyEmptyDirs, err)
+		}
+
+		if _, err := os.Stat(filepath.Join(target, "full", "a.jpg")); err != nil {
+			t.Errorf("CopyEmptyDirs %v: file not copied: %s", copyEmptyDirs, err)
+		}
+
+		_, err := os.Stat(filepath.Join(target, "empty", "nested"))
+		if copyEmptyDirs && err != nil {
+			t.Errorf("CopyEmptyDirs true: empty directory not recreated: %s", err)
+		}
+		if !copyEmptyDirs && !os.IsNotExist(err) {
+			t.Errorf("CopyEmptyDirs false: empty directory recreated")
+		}
+	}
+}
+
+func TestCopyDirectoryTrailingSlash(t *testing.T) {
+	source, target := t.TempDir(), t.TempDir()
+	os.MkdirAll(filepath.Join(source, "album"), 0755)
+	for _, file := range []string{"a.jpg", filepath.Join("album", "b.jpg")} {
+		if err := ioutil.WriteFile(filepath.Join(source, file), []byte(file), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := CopyDirectory(source+"/", target, false, false, true); err != nil {
+		t.Fatalf("CopyDirectory(%s/): %s", source, err)
+	}
+
+	for _, file := range []string{"a.jpg", filepath.Join("album", "b.jpg")} {
+		if data, err := ioutil.ReadFile(filepath.Join(target, file)); err != nil || string(data) != file {
+			t.Errorf("%s not copied under its name: %v", file, err)
+		}
+	}
+}
+
+var errWriteFailed = errors.New("write failed")
+
+// failingFile fails writing once more than limit bytes were written to it.
+type failingFile struct {
+	File
+	limit int
+}
+
+func (f *failingFile) Write(p []byte) (int, error) {
+	if len(p) > f.limit {
+		n, _ := f.File.Write(p[:f.limit])
+		f.limit = 0
+		return n, errWriteFailed
+	}
+
+	f.limit -= len(p)
+	return f.File.Write(p)
+}
+
+// failingStorage creates files failing midway through being written.
+type failingStorage struct {
+	LocalStorage
+}
+
+func (s failingStorage) Create(name string) (File, error) {
+	f, err := s.LocalStorage.Create(name)
+	if err != nil {
+		return nil, err
+	}
+	return &failingFile{File: f, limit: 1000}, nil
+}
+
+func TestDoCopyRemovesPartialTarget(t *testing.T) {
+	defer func(storage Storage) { TargetStorage = storage }(TargetStorage)
+	TargetStorage = failingStorage{}
+
+	dir := t.TempDir()
+	source := filepath.Join(dir, "a.jpg")
+	target := filepath.Join(dir, "b.jpg")
+	if err := ioutil.WriteFile(source, make([]byte, 100000), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := doCopy(source, target); err != errWriteFailed {
+		t.Fatalf("doCopy = %v, want %v", err, errWriteFailed)
+	}
+	if _, err := os.Stat(target); !os.IsNotExist(err) {
+		t.Errorf("partial target %s left after a failed copy", target)
+	}
+}
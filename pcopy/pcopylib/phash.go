@@ -0,0 +1,91 @@
+package pcopylib
+
+import (
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+)
+
+// NearDupThreshold is the largest perceptual hash distance (0 to 64) at which
+// two differing images are taken as the same photo, negative disables it.
+var NearDupThreshold int = -1
+
+// getPerceptualHash computes the dHash of an image: the brightness gradient
+// between neighbours of a 9x8 grayscale thumbnail, one bit per pair.
+func getPerceptualHash(fs Storage, filename string) (uint64, error) {
+	acquireFiles(1)
+	defer releaseFiles(1)
+
+	file, err := fs.Open(filename)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	img, _, err := image.Decode(file)
+	if err != nil {
+		return 0, err
+	}
+
+	const width, height, samples = 9, 8, 8
+	bounds := img.Bounds()
+	cellWidth := float64(bounds.Dx()) / width
+	cellHeight := float64(bounds.Dy()) / height
+
+	var thumb [height][width]float64
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			sum := 0.0
+			for sy := 0; sy < samples; sy++ {
+				for sx := 0; sx < samples; sx++ {
+					px := bounds.Min.X + int((float64(x)+(float64(sx)+0.5)/samples)*cellWidth)
+					py := bounds.Min.Y + int((float64(y)+(float64(sy)+0.5)/samples)*cellHeight)
+					r, g, b, _ := img.At(px, py).RGBA()
+					sum += 0.299*float64(r) + 0.587*float64(g) + 0.114*float64(b)
+				}
+			}
+			thumb[y][x] = sum / (samples * samples)
+		}
+	}
+
+	hash := uint64(0)
+	for y := 0; y < height; y++ {
+		for x := 0; x < width-1; x++ {
+			hash <<= 1
+			if thumb[y][x] < thumb[y][x+1] {
+				hash |= 1
+			}
+		}
+	}
+
+	return hash, nil
+}
+
+func hammingDistance(a, b uint64) int {
+	distance := 0
+	for diff := a ^ b; diff != 0; diff &= diff - 1 {
+		distance++
+	}
+	return distance
+}
+
+// isNearDuplicate reports whether source and target look like the same photo,
+// such as a re-encoded copy, when NearDupThreshold is enabled.
+func isNearDuplicate(source, target string) bool {
+	if NearDupThreshold < 0 {
+		return false
+	}
+
+	srcHash, err := getPerceptualHash(LocalStorage{}, source)
+	if err != nil {
+		return false
+	}
+
+	dstHash, err := getPerceptualHash(TargetStorage, target)
+	if err != nil {
+		return false
+	}
+
+	return hammingDistance(srcHash, dstHash) <= NearDupThreshold
+}
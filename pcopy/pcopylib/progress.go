@@ -0,0 +1,83 @@
+package pcopylib
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Progress reports the progress of copying files of at least
+// ProgressThreshold bytes on stderr, leaving the log on stdout untouched.
+var (
+	Progress          bool  = false
+	ProgressThreshold int64 = 100 * 1024 * 1024
+)
+
+var progressMutex sync.Mutex
+
+// progressReader is a reader counting the bytes read through it and reporting
+// the percentage and the estimated time left about once a second.
+type progressReader struct {
+	reader   io.Reader
+	name     string
+	total    int64
+	done     int64
+	start    time.Time
+	reported time.Time
+	width    int
+}
+
+func newProgressReader(reader io.Reader, name string, total int64) *progressReader {
+	now := time.Now()
+	return &progressReader{reader: reader, name: name, total: total, start: now, reported: now}
+}
+
+func (r *progressReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	r.done += int64(n)
+
+	if time.Since(r.reported) >= time.Second {
+		r.reported = time.Now()
+		r.report()
+	}
+
+	return n, err
+}
+
+func (r *progressReader) print(line string) {
+	progressMutex.Lock()
+	defer progressMutex.Unlock()
+
+	padding := ""
+	if len(line) < r.width {
+		padding = strings.Repeat(" ", r.width-len(line))
+	}
+	r.width = len(line)
+
+	fmt.Fprint(os.Stderr, "\r"+line+padding)
+}
+
+func (r *progressReader) report() {
+	if r.total <= 0 || r.done <= 0 {
+		return
+	}
+
+	elapsed := time.Since(r.start)
+	eta := time.Duration(float64(elapsed) * float64(r.total-r.done) / float64(r.done))
+	r.print(fmt.Sprintf("%s: %d%%, ETA %s", r.name, r.done*100/r.total, eta/time.Second*time.Second))
+}
+
+// finish clears the progress line.
+func (r *progressReader) finish() {
+	if r.width == 0 {
+		return
+	}
+
+	r.print("")
+	progressMutex.Lock()
+	fmt.Fprint(os.Stderr, "\r")
+	progressMutex.Unlock()
+}
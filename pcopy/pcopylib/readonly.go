@@ -0,0 +1,21 @@
+package pcopylib
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"syscall"
+)
+
+// IsReadOnlyDir reports whether files can not be created or removed in dir,
+// as on a write-protected memory card, by probing with a temporary file.
+// Moving out of such a directory would copy without removing anything.
+func IsReadOnlyDir(dir string) bool {
+	f, err := ioutil.TempFile(dir, ".photoutils-probe-")
+	if err != nil {
+		return os.IsPermission(err) || errors.Is(err, syscall.EROFS)
+	}
+
+	f.Close()
+	return os.Remove(f.Name()) != nil
+}
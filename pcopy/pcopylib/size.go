@@ -0,0 +1,40 @@
+package pcopylib
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+var sizeUnits = map[string]int64{
+	"":   1,
+	"B":  1,
+	"K":  1024,
+	"KB": 1024,
+	"M":  1024 * 1024,
+	"MB": 1024 * 1024,
+	"G":  1024 * 1024 * 1024,
+	"GB": 1024 * 1024 * 1024,
+	"T":  1024 * 1024 * 1024 * 1024,
+	"TB": 1024 * 1024 * 1024 * 1024,
+}
+
+// ParseSize parses a size in bytes, written like 4096, 500K, 100MB or 2G with
+// units of 1024.
+func ParseSize(value string) (int64, error) {
+	value = strings.ToUpper(strings.TrimSpace(value))
+	digits := strings.TrimRight(value, "BKMGT")
+
+	unit, ok := sizeUnits[value[len(digits):]]
+	if !ok || len(digits) == 0 {
+		return 0, errors.New(fmt.Sprintf("invalid size %s", value))
+	}
+
+	size, err := strconv.ParseInt(digits, 10, 64)
+	if err != nil || size < 0 {
+		return 0, errors.New(fmt.Sprintf("invalid size %s", value))
+	}
+
+	return size * unit, nil
+}
@@ -0,0 +1,136 @@
+package pcopylib
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// SpillTargets, when set, are target directories filled in turn, like several
+// external disks: a file goes to the first of them with enough free space
+// left. Targets are given under the first one and routed from there.
+var SpillTargets []string
+
+// spillReserve is the free space left on a spill target, so that it is never
+// filled to the last byte.
+const spillReserve = 64 * 1024 * 1024
+
+var errFreeSpaceUnsupported = errors.New("free space can not be read on this platform")
+
+var errTargetsFull = errors.New("no target has enough free space left")
+
+// spillPending is the bytes being copied to each spill target, not yet taken
+// from its free space.
+var (
+	spillPending      = map[string]int64{}
+	spillPendingMutex sync.Mutex
+)
+
+// spillRoot returns the spill target target is under and its path relative
+// to it, ok false when it is under none.
+func spillRoot(target string) (string, string, bool) {
+	for _, root := range SpillTargets {
+		relative, err := filepath.Rel(root, target)
+		if err == nil && relative != ".." && !strings.HasPrefix(relative, ".."+string(filepath.Separator)) {
+			return root, relative, true
+		}
+	}
+
+	return "", "", false
+}
+
+// routeTarget returns where target, given under the first spill target, goes:
+// where it already is if any spill target has it, so that it is found
+// identical or renamed as usual, and under the first spill target with room
+// for source otherwise. release gives back the space taken for the copy.
+func routeTarget(source, target string) (string, func(), error) {
+	release := func() {}
+
+	_, relative, ok := spillRoot(target)
+	if !ok {
+		return target, release, nil
+	}
+
+	for _, root := range SpillTargets {
+		if routed := filepath.Join(root, relative); isTargetTaken(routed) {
+			return routed, release, nil
+		}
+	}
+
+	size := int64(0)
+	if fileinfo, err := os.Stat(source); err == nil {
+		size = fileinfo.Size()
+	}
+
+	spillPendingMutex.Lock()
+	defer spillPendingMutex.Unlock()
+
+	for _, root := range SpillTargets {
+		free, err := freeSpace(root)
+		if err != nil && err != errFreeSpaceUnsupported {
+			continue
+		}
+		if err == nil && free-spillPending[root] < size+spillReserve {
+			continue
+		}
+
+		routed := filepath.Join(root, relative)
+		if err := MkdirAll(filepath.Dir(routed)); err != nil {
+			continue
+		}
+
+		spillPending[root] += size
+		release = func() {
+			spillPendingMutex.Lock()
+			spillPending[root] -= size
+			spillPendingMutex.Unlock()
+		}
+		return routed, release, nil
+	}
+
+	return target, release, errTargetsFull
+}
+
+// targetsManifest records the spill target every file went to, nil when
+// disabled.
+var (
+	targetsManifest     *syncWriter
+	targetsManifestFile *os.File
+)
+
+// OpenTargetsManifest starts recording the spill target every file copied,
+// moved or found identical is on to path, one tab separated line of source,
+// spill target and final target.
+func OpenTargetsManifest(path string) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	targetsManifestFile = file
+	targetsManifest = &syncWriter{writer: file}
+	fmt.Fprintln(targetsManifest, "source\tdisk\ttarget")
+	return nil
+}
+
+// CloseTargetsManifest stops recording spill targets.
+func CloseTargetsManifest() error {
+	if targetsManifestFile == nil {
+		return nil
+	}
+
+	targetsManifest = nil
+	return targetsManifestFile.Close()
+}
+
+func logTarget(source, target string) {
+	if targetsManifest == nil {
+		return
+	}
+
+	root, _, _ := spillRoot(target)
+	fmt.Fprintf(targetsManifest, "%s\t%s\t%s\n", source, root, target)
+}
@@ -0,0 +1,139 @@
+package pcopylib
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+// runState records the source files handled by runs, so that one resumed
+// after an interruption skips them, nil when disabled. runStateDone holds
+// those recorded by earlier runs, only read during the run.
+var (
+	runState     *syncWriter
+	runStateFile *os.File
+	runStateDone map[string]string
+	stateSkipped int64
+)
+
+// stateKey returns what runState records of source: its size, mtime and
+// absolute path, so that a file changed since is handled again.
+func stateKey(source string, info os.FileInfo) (string, string) {
+	path, err := filepath.Abs(source)
+	if err != nil {
+		path = source
+	}
+
+	return path, fmt.Sprintf("%d\t%d", info.Size(), info.ModTime().UnixNano())
+}
+
+// OpenRunState starts skipping the source files recorded as handled at path,
+// and appending a line to it for every file handled from then on, as soon as
+// it is. A missing path starts an empty state. Lines cut short by an
+// interruption are ignored.
+func OpenRunState(path string) error {
+	done := map[string]string{}
+	torn := false
+
+	f, err := os.Open(path)
+	switch {
+	case os.IsNotExist(err):
+	case err != nil:
+		return err
+	default:
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			fields := strings.SplitN(scanner.Text(), "\t", 3)
+			if len(fields) != 3 {
+				continue
+			}
+			if _, err := strconv.ParseInt(fields[0], 10, 64); err != nil {
+				continue
+			}
+			if _, err := strconv.ParseInt(fields[1], 10, 64); err != nil {
+				continue
+			}
+			done[fields[2]] = fields[0] + "\t" + fields[1]
+		}
+
+		// a line cut short must not run into the next one appended
+		if fi, err := f.Stat(); err == nil && fi.Size() > 0 {
+			last := make([]byte, 1)
+			if _, err := f.ReadAt(last, fi.Size()-1); err == nil && last[0] != '\n' {
+				torn = true
+			}
+		}
+		f.Close()
+
+		if err := scanner.Err(); err != nil {
+			return err
+		}
+	}
+
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+
+	if torn {
+		if _, err := file.Write([]byte("\n")); err != nil {
+			file.Close()
+			return err
+		}
+	}
+
+	runStateFile = file
+	runState = &syncWriter{writer: file}
+	runStateDone = done
+	return nil
+}
+
+// CloseRunState stops recording handled files.
+func CloseRunState() error {
+	if runStateFile == nil {
+		return nil
+	}
+
+	err := runStateFile.Close()
+	runStateFile = nil
+	runState = nil
+	return err
+}
+
+// IsDone reports whether an earlier run recorded source as handled, as it is
+// now, counting it as skipped when it did.
+func IsDone(source string, info os.FileInfo) bool {
+	if runStateDone == nil || info == nil {
+		return false
+	}
+
+	path, stamp := stateKey(source, info)
+	if runStateDone[path] != stamp {
+		return false
+	}
+
+	atomic.AddInt64(&stateSkipped, 1)
+	return true
+}
+
+// RecordDone appends source, as info found it before it was handled, to the
+// state in a single write, so that an interruption can only cut the last
+// line short.
+func RecordDone(source string, info os.FileInfo) {
+	if runState == nil || info == nil {
+		return
+	}
+
+	path, stamp := stateKey(source, info)
+	runState.Write([]byte(fmt.Sprintf("%s\t%s\n", stamp, path)))
+}
+
+// StateSkipped returns the number of files skipped as handled by an earlier
+// run.
+func StateSkipped() int64 {
+	return atomic.LoadInt64(&stateSkipped)
+}
@@ -0,0 +1,121 @@
+package pcopylib
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"sync/atomic"
+	"time"
+)
+
+// Stats counts what happened to the files of a run, it is safe for concurrent
+// use by the workers.
+type Stats struct {
+	Scanned   int64
+	Copied    int64
+	Moved     int64
+	Skipped   int64
+	Identical int64
+	Renamed   int64
+	Failed    int64
+	Bytes     int64
+}
+
+// RunStats accumulates the statistics of the current run.
+var RunStats Stats
+
+func (s *Stats) AddScanned() {
+	atomic.AddInt64(&s.Scanned, 1)
+}
+
+func (s *Stats) AddFailed() {
+	atomic.AddInt64(&s.Failed, 1)
+}
+
+func (s *Stats) addSkipped() {
+	atomic.AddInt64(&s.Skipped, 1)
+}
+
+// addIdentical counts a skip because the target has the same content.
+func (s *Stats) addIdentical() {
+	atomic.AddInt64(&s.Skipped, 1)
+	atomic.AddInt64(&s.Identical, 1)
+}
+
+func (s *Stats) addRenamed() {
+	atomic.AddInt64(&s.Renamed, 1)
+}
+
+func (s *Stats) addTransferred(moveMode bool, size int64) {
+	if moveMode {
+		atomic.AddInt64(&s.Moved, 1)
+	} else {
+		atomic.AddInt64(&s.Copied, 1)
+	}
+	atomic.AddInt64(&s.Bytes, size)
+}
+
+// Snapshot returns a copy of s that is safe to read.
+func (s *Stats) Snapshot() Stats {
+	return Stats{
+		Scanned:   atomic.LoadInt64(&s.Scanned),
+		Copied:    atomic.LoadInt64(&s.Copied),
+		Moved:     atomic.LoadInt64(&s.Moved),
+		Skipped:   atomic.LoadInt64(&s.Skipped),
+		Identical: atomic.LoadInt64(&s.Identical),
+		Renamed:   atomic.LoadInt64(&s.Renamed),
+		Failed:    atomic.LoadInt64(&s.Failed),
+		Bytes:     atomic.LoadInt64(&s.Bytes),
+	}
+}
+
+type statsReport struct {
+	Scanned        int64   `json:"scanned"`
+	Copied         int64   `json:"copied"`
+	Moved          int64   `json:"moved"`
+	Skipped        int64   `json:"skipped"`
+	Identical      int64   `json:"identical"`
+	Renamed        int64   `json:"renamed"`
+	Failed         int64   `json:"failed"`
+	Bytes          int64   `json:"bytes"`
+	ElapsedSeconds float64 `json:"elapsed_seconds"`
+	MBPerSecond    float64 `json:"mb_per_second"`
+}
+
+func newStatsReport(elapsed time.Duration) statsReport {
+	stats := RunStats.Snapshot()
+	report := statsReport{
+		Scanned:        stats.Scanned,
+		Copied:         stats.Copied,
+		Moved:          stats.Moved,
+		Skipped:        stats.Skipped,
+		Identical:      stats.Identical,
+		Renamed:        stats.Renamed,
+		Failed:         stats.Failed,
+		Bytes:          stats.Bytes,
+		ElapsedSeconds: elapsed.Seconds(),
+	}
+
+	if elapsed > 0 {
+		report.MBPerSecond = float64(stats.Bytes) / 1024 / 1024 / elapsed.Seconds()
+	}
+
+	return report
+}
+
+// Summary returns a one line human readable summary of RunStats.
+func Summary() string {
+	stats := RunStats.Snapshot()
+	return fmt.Sprintf("%d scanned, %d copied, %d moved, %d renamed, %d skipped (%d identical), %d failed",
+		stats.Scanned, stats.Copied, stats.Moved, stats.Renamed, stats.Skipped, stats.Identical, stats.Failed)
+}
+
+// WriteStatsJSON writes RunStats of a run that took elapsed to path as JSON.
+func WriteStatsJSON(path string, elapsed time.Duration) error {
+	data, err := json.MarshalIndent(newStatsReport(elapsed), "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(path, append(data, '\n'), 0644)
+}
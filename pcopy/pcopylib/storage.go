@@ -0,0 +1,98 @@
+package pcopylib
+
+import (
+	"io"
+	"os"
+	"time"
+)
+
+// File is an open file of a Storage.
+type File interface {
+	io.Reader
+	io.Writer
+	io.Seeker
+	io.Closer
+}
+
+// Storage is the file system files are copied to. Implement it to copy to
+// something other than a local directory, such as an object store.
+type Storage interface {
+	Open(name string) (File, error)
+	Create(name string) (File, error)
+	Stat(name string) (os.FileInfo, error)
+	Lstat(name string) (os.FileInfo, error)
+	Readlink(name string) (string, error)
+	Symlink(oldname, newname string) error
+	MkdirAll(path string, perm os.FileMode) error
+	Rename(oldpath, newpath string) error
+	Remove(name string) error
+	Chmod(name string, mode os.FileMode) error
+	Chtimes(name string, atime, mtime time.Time) error
+}
+
+// LocalStorage is the Storage of the local file system.
+type LocalStorage struct{}
+
+func (LocalStorage) Open(name string) (File, error) {
+	return os.Open(name)
+}
+
+func (LocalStorage) Create(name string) (File, error) {
+	return os.Create(name)
+}
+
+func (LocalStorage) Stat(name string) (os.FileInfo, error) {
+	return os.Stat(name)
+}
+
+func (LocalStorage) Lstat(name string) (os.FileInfo, error) {
+	return os.Lstat(name)
+}
+
+func (LocalStorage) Readlink(name string) (string, error) {
+	return os.Readlink(name)
+}
+
+func (LocalStorage) Symlink(oldname, newname string) error {
+	return os.Symlink(oldname, newname)
+}
+
+func (LocalStorage) MkdirAll(path string, perm os.FileMode) error {
+	return os.MkdirAll(path, perm)
+}
+
+func (LocalStorage) Rename(oldpath, newpath string) error {
+	return os.Rename(oldpath, newpath)
+}
+
+func (LocalStorage) Remove(name string) error {
+	return os.Remove(name)
+}
+
+func (LocalStorage) Chmod(name string, mode os.FileMode) error {
+	return os.Chmod(name, mode)
+}
+
+func (LocalStorage) Chtimes(name string, atime, mtime time.Time) error {
+	return os.Chtimes(name, atime, mtime)
+}
+
+// TargetStorage is where targets are written, the local file system by default.
+var TargetStorage Storage = LocalStorage{}
+
+func fileExistStatus(fs Storage, path string) FileExistStatus {
+	fileinfo, err := fs.Stat(path)
+	switch {
+	case err != nil:
+		return FileExistStatus_NotExist
+	case fileinfo.IsDir() == true:
+		return FileExistStatus_Directory
+	default:
+		return FileExistStatus_File
+	}
+}
+
+// IsTargetExist is IsFileExist for a path of TargetStorage.
+func IsTargetExist(path string) FileExistStatus {
+	return fileExistStatus(TargetStorage, path)
+}
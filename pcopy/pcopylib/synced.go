@@ -0,0 +1,97 @@
+package pcopylib
+
+import (
+	"bufio"
+	"crypto/md5"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// SyncedFileName is the name of the file RecordSynced writes in the target
+// of a run that left it in sync with its source. Walks skip it, so it is
+// never copied or moved.
+const SyncedFileName = ".photoutils.synced"
+
+// treeSignature hashes the names, sizes and modification times of what is
+// under root, without reading any file, along with the options copies
+// depend on. It is "" when root can not be walked.
+func treeSignature(root string, recursiveMode bool) string {
+	hash := md5.New()
+	fmt.Fprintf(hash, "gzip=%t encoding=%d recursive=%t copy-empty-dirs=%t\n", Gzip, TargetNameEncoding, recursiveMode, CopyEmptyDirs)
+
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if path == root {
+			return nil
+		}
+		if info.IsDir() && !recursiveMode {
+			return filepath.SkipDir
+		}
+		if info.Name() == LockFileName || info.Name() == SyncedFileName {
+			return nil
+		}
+
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(hash, "%s\t%s\t%d\t%d\n", filepath.ToSlash(rel), info.Mode().Type(), info.Size(), info.ModTime().UnixNano())
+		return nil
+	})
+	if err != nil {
+		return ""
+	}
+
+	return fmt.Sprintf("%x", hash.Sum(nil))
+}
+
+func readSynced(target string) (string, string) {
+	f, err := os.Open(filepath.Join(target, SyncedFileName))
+	if err != nil {
+		return "", ""
+	}
+	defer f.Close()
+
+	signatures := map[string]string{}
+	scanner := bufio.NewScanner(io.LimitReader(f, 4096))
+	for scanner.Scan() {
+		fields := strings.SplitN(scanner.Text(), " ", 2)
+		if len(fields) == 2 {
+			signatures[fields[0]] = fields[1]
+		}
+	}
+
+	return signatures["source"], signatures["target"]
+}
+
+// IsSynced reports whether neither source nor target changed since a run
+// recorded them in sync, telling by names, sizes and modification times only.
+func IsSynced(source, target string, recursiveMode bool) bool {
+	sourceSignature, targetSignature := readSynced(target)
+	if len(sourceSignature) == 0 || len(targetSignature) == 0 {
+		return false
+	}
+
+	return sourceSignature == treeSignature(source, recursiveMode) && targetSignature == treeSignature(target, recursiveMode)
+}
+
+// RecordSynced records source and target as they are, in sync, for IsSynced
+// to check on the next run.
+func RecordSynced(source, target string, recursiveMode bool) error {
+	sourceSignature := treeSignature(source, recursiveMode)
+	targetSignature := treeSignature(target, recursiveMode)
+	if len(sourceSignature) == 0 || len(targetSignature) == 0 {
+		return errors.New("tree can not be read")
+	}
+
+	data := fmt.Sprintf("source %s\ntarget %s\n", sourceSignature, targetSignature)
+	return ioutil.WriteFile(filepath.Join(target, SyncedFileName), []byte(data), 0644)
+}
@@ -0,0 +1,54 @@
+package pcopylib
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+// stuckReader returns data once, then blocks until release is closed, like a
+// read from a hung network share.
+type stuckReader struct {
+	data    io.Reader
+	release chan struct{}
+}
+
+func (r *stuckReader) Read(p []byte) (int, error) {
+	if n, _ := r.data.Read(p); n > 0 {
+		return n, nil
+	}
+
+	<-r.release
+	return 0, io.EOF
+}
+
+func TestCopyContextStalled(t *testing.T) {
+	src := &stuckReader{data: strings.NewReader("partial"), release: make(chan struct{})}
+	defer close(src.release)
+
+	var dst bytes.Buffer
+	start := time.Now()
+	written, err := copyContext(context.Background(), &dst, src, 100*time.Millisecond)
+	if err != context.DeadlineExceeded {
+		t.Fatalf("copyContext = %v, want %v", err, context.DeadlineExceeded)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("copyContext returned after %s, want about the timeout", elapsed)
+	}
+	if written != int64(len("partial")) || dst.String() != "partial" {
+		t.Errorf("copyContext wrote %d bytes, %q", written, dst.String())
+	}
+}
+
+func TestCopyContextComplete(t *testing.T) {
+	data := strings.Repeat("photo", 100000)
+
+	var dst bytes.Buffer
+	written, err := copyContext(context.Background(), &dst, strings.NewReader(data), time.Second)
+	if err != nil || written != int64(len(data)) || dst.String() != data {
+		t.Errorf("copyContext = %d, %v, want %d bytes copied", written, err, len(data))
+	}
+}
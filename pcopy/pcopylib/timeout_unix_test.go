@@ -0,0 +1,49 @@
+//go:build linux || darwin || freebsd || openbsd || netbsd
+// +build linux darwin freebsd openbsd netbsd
+
+package pcopylib
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// A source that stops sending data, here a FIFO whose writer goes quiet,
+// fails its copy within FileTimeout and leaves no partial target.
+func TestDoCopyStalledSource(t *testing.T) {
+	defer func(timeout time.Duration) { FileTimeout = timeout }(FileTimeout)
+	FileTimeout = 200 * time.Millisecond
+
+	dir := t.TempDir()
+	source := filepath.Join(dir, "a.jpg")
+	target := filepath.Join(dir, "b.jpg")
+	if err := syscall.Mkfifo(source, 0644); err != nil {
+		t.Skip("no FIFO:", err)
+	}
+
+	release := make(chan struct{})
+	defer close(release)
+	go func() {
+		w, err := os.OpenFile(source, os.O_WRONLY, 0)
+		if err != nil {
+			return
+		}
+		defer w.Close()
+		w.Write([]byte("partial"))
+		<-release
+	}()
+
+	start := time.Now()
+	if err := doCopy(source, target); err == nil {
+		t.Fatal("doCopy of a stalled source succeeded")
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("doCopy returned after %s, want about %s", elapsed, FileTimeout)
+	}
+	if _, err := os.Stat(target); !os.IsNotExist(err) {
+		t.Errorf("partial target %s left after a stalled copy", target)
+	}
+}
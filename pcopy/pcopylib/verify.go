@@ -0,0 +1,68 @@
+package pcopylib
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sort"
+)
+
+// VerifyReport lists the source files whose copy is not found intact at the
+// target path they are copied to, sorted.
+type VerifyReport struct {
+	Verified   int
+	Missing    []string
+	Mismatched []string
+}
+
+// Intact reports whether every source file has an identical copy.
+func (r VerifyReport) Intact() bool {
+	return len(r.Missing) == 0 && len(r.Mismatched) == 0
+}
+
+// expectedTarget returns where source is copied to under target, as copies
+// name it.
+func expectedTarget(target, rel string) string {
+	expected := filepath.Join(target, EncodeName(rel))
+	if Gzip {
+		expected += ".gz"
+	}
+	return expected
+}
+
+// VerifyCopy checks that every file of the local tree source has a copy of
+// the same content at its target path under target, comparing contents as
+// copies do, without writing anything.
+func VerifyCopy(source, target string, fullHashMode, recursiveMode bool) (VerifyReport, error) {
+	report := VerifyReport{}
+
+	if IsFileExist(source) != FileExistStatus_Directory {
+		return report, errors.New(fmt.Sprint("pcopy: error: ", source, ": No such directory"))
+	}
+	if IsTargetExist(target) != FileExistStatus_Directory {
+		return report, errors.New(fmt.Sprint("pcopy: error: ", target, ": Invalid target, a directory expected"))
+	}
+
+	files, err := listTree(source, recursiveMode)
+	if err != nil {
+		return report, errors.New(fmt.Sprintf("pcopy: error: %s: %s", source, err))
+	}
+
+	for rel := range files {
+		sourceFile := filepath.Join(source, rel)
+		targetFile := expectedTarget(target, rel)
+
+		switch {
+		case IsTargetExist(targetFile) != FileExistStatus_File:
+			report.Missing = append(report.Missing, sourceFile)
+		case !hasSameContent(sourceFile, targetFile, fullHashMode):
+			report.Mismatched = append(report.Mismatched, sourceFile)
+		default:
+			report.Verified++
+		}
+	}
+
+	sort.Strings(report.Missing)
+	sort.Strings(report.Mismatched)
+	return report, nil
+}
@@ -0,0 +1,55 @@
+package pcopylib
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// webhookTimeout bounds how long the end of a run waits on a webhook.
+const webhookTimeout = 30 * time.Second
+
+// webhookReport is the stats-json report along with how the run ended.
+type webhookReport struct {
+	Status string `json:"status"`
+	statsReport
+}
+
+// CheckWebhookURL reports whether rawURL is an http or https URL.
+func CheckWebhookURL(rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return err
+	}
+
+	if (u.Scheme != "http" && u.Scheme != "https") || len(u.Host) == 0 {
+		return errors.New("expected an http or https URL")
+	}
+	return nil
+}
+
+// PostWebhook posts RunStats of a run that took elapsed to rawURL as JSON, in
+// the format of WriteStatsJSON with the status the run ended with, like
+// finished or aborted.
+func PostWebhook(rawURL string, status string, elapsed time.Duration) error {
+	data, err := json.Marshal(webhookReport{Status: status, statsReport: newStatsReport(elapsed)})
+	if err != nil {
+		return err
+	}
+
+	client := http.Client{Timeout: webhookTimeout}
+	resp, err := client.Post(rawURL, "application/json", bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return errors.New(fmt.Sprintf("status %s", resp.Status))
+	}
+	return nil
+}
@@ -0,0 +1,289 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"photoutils/pcopy/pcopylib"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+)
+
+func shortUsage(errInfo string) error {
+	str := fmt.Sprintln("usage: pverify [-h] [-w] manifest dir")
+	str += fmt.Sprint(errInfo)
+	err := errors.New(str)
+	return err
+}
+
+func longUsage() {
+	fmt.Println("usage: pverify [-h] [-w] manifest dir")
+	fmt.Println("")
+	fmt.Println("positional arguments:")
+	fmt.Println("  manifest    manifest of the hashes of the files under dir")
+	fmt.Println("  dir         path of the archive to be verified")
+	fmt.Println("")
+	fmt.Println("optional arguments:")
+	fmt.Println("  -h, --help  show this help message and exit")
+	fmt.Println("  -w          hash every file under dir and write the manifest, instead of")
+	fmt.Println("              verifying dir against it")
+	fmt.Println("")
+	fmt.Println("paths may use environment variables like $HOME and a leading ~, write $$ for")
+	fmt.Println("a literal $")
+}
+
+var (
+	writeMode bool   = false
+	manifest  string = ""
+	dir       string = ""
+)
+
+func parseArgs() error {
+	flags := flag.NewFlagSet("pverify", flag.ContinueOnError)
+	flags.SetOutput(ioutil.Discard)
+	flags.BoolVar(&writeMode, "w", false, "")
+
+	remainder, err := pcopylib.ParseFlags(flags, os.Args[1:])
+	switch {
+	case err == flag.ErrHelp:
+		longUsage()
+		os.Exit(0)
+	case err != nil && strings.HasPrefix(err.Error(), "flag provided but not defined: "):
+		return shortUsage(fmt.Sprintf("pverify: error: unrecognized arguments: %s", strings.TrimPrefix(err.Error(), "flag provided but not defined: ")))
+	case err != nil:
+		return shortUsage(fmt.Sprintf("pverify: error: %s", err))
+	}
+
+	if len(remainder) > 2 {
+		return shortUsage(fmt.Sprintf("pverify: error: unrecognized arguments: %s", strings.Join(remainder[:len(remainder)-2], " ")))
+	}
+
+	if len(remainder) < 2 {
+		return shortUsage(fmt.Sprint("pverify: error: too few arguments"))
+	}
+
+	for idx, arg := range remainder {
+		remainder[idx] = pcopylib.ExpandPath(arg)
+	}
+
+	for _, arg := range remainder {
+		if len(arg) == 0 {
+			return shortUsage(fmt.Sprint("pverify: error: empty path argument"))
+		}
+	}
+
+	manifest = remainder[0]
+	dir = remainder[1]
+
+	return nil
+}
+
+// listFiles returns the paths of the regular files under root but the
+// manifest, relative to root and slash separated as written to manifests.
+func listFiles(root string) []string {
+	files := []string{}
+	manifestPath, _ := filepath.Abs(manifest)
+
+	filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			fmt.Printf("pverify: warning: %s: read failed, skipped\n", path)
+			return nil
+		}
+
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+
+		if absPath, _ := filepath.Abs(path); absPath == manifestPath {
+			return nil
+		}
+
+		relative, err := filepath.Rel(root, path)
+		if err != nil {
+			return nil
+		}
+
+		files = append(files, filepath.ToSlash(relative))
+		return nil
+	})
+
+	return files
+}
+
+// hashFiles returns the full hash of each of files under root, hashing them
+// with a worker per CPU. Files that can not be read hash to "".
+func hashFiles(root string, files []string) map[string]string {
+	hashes := make(map[string]string, len(files))
+	var hashesMutex sync.Mutex
+
+	hashJob := make(chan string, 100)
+	hashDone := make(chan struct{})
+
+	jobsNum := runtime.NumCPU()
+	for i := 0; i < jobsNum; i++ {
+		go func(hashDone chan<- struct{}, hashJob <-chan string) {
+			for file := range hashJob {
+				hash := pcopylib.FullHash(filepath.Join(root, filepath.FromSlash(file)))
+
+				hashesMutex.Lock()
+				hashes[file] = hash
+				hashesMutex.Unlock()
+			}
+
+			hashDone <- struct{}{}
+		}(hashDone, hashJob)
+	}
+
+	for _, file := range files {
+		hashJob <- file
+	}
+	close(hashJob)
+
+	for i := 0; i < jobsNum; i++ {
+		<-hashDone
+	}
+
+	return hashes
+}
+
+// readManifest reads a manifest written by writeManifest, in the format of
+// md5sum: a hash, two spaces and a path per line.
+func readManifest(path string) (map[string]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("pverify: error: %s: read manifest failed", path))
+	}
+	defer f.Close()
+
+	hashes := map[string]string{}
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		fields := strings.SplitN(scanner.Text(), "  ", 2)
+		if len(fields) != 2 {
+			return nil, errors.New(fmt.Sprintf("pverify: error: %s: line %d: malformed", path, line))
+		}
+		hashes[fields[1]] = fields[0]
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, errors.New(fmt.Sprintf("pverify: error: %s: read manifest failed", path))
+	}
+
+	return hashes, nil
+}
+
+func writeManifest(path string, hashes map[string]string) error {
+	files := make([]string, 0, len(hashes))
+	for file := range hashes {
+		files = append(files, file)
+	}
+	sort.Strings(files)
+
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	w := bufio.NewWriter(f)
+	for _, file := range files {
+		fmt.Fprintf(w, "%s  %s\n", hashes[file], file)
+	}
+
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+
+	return f.Close()
+}
+
+// verify compares the actual hashes of the files under dir to those expected
+// by the manifest, printing every file changed, unreadable, missing or new
+// since. It reports whether dir matched the manifest.
+func verify(expected, actual map[string]string) bool {
+	files := make([]string, 0, len(expected)+len(actual))
+	for file := range expected {
+		files = append(files, file)
+	}
+	for file := range actual {
+		if _, ok := expected[file]; !ok {
+			files = append(files, file)
+		}
+	}
+	sort.Strings(files)
+
+	verified, changed, unreadable, missing, added := 0, 0, 0, 0, 0
+	for _, file := range files {
+		want, inManifest := expected[file]
+		got, inDir := actual[file]
+
+		switch {
+		case !inDir:
+			fmt.Printf("missing     %s\n", file)
+			missing++
+		case !inManifest:
+			fmt.Printf("new         %s\n", file)
+			added++
+		case len(got) == 0:
+			fmt.Printf("unreadable  %s\n", file)
+			unreadable++
+		case got != want:
+			fmt.Printf("changed     %s\n", file)
+			changed++
+		default:
+			verified++
+		}
+	}
+
+	fmt.Printf("pverify: %d verified, %d changed, %d unreadable, %d missing, %d new\n", verified, changed, unreadable, missing, added)
+
+	return changed == 0 && unreadable == 0 && missing == 0 && added == 0
+}
+
+func main() {
+	runtime.GOMAXPROCS(runtime.NumCPU())
+
+	if err := parseArgs(); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	if pcopylib.IsFileExist(dir) != pcopylib.FileExistStatus_Directory {
+		fmt.Println(shortUsage(fmt.Sprintf("pverify: error: %s: No such directory", dir)))
+		os.Exit(1)
+	}
+
+	if writeMode {
+		hashes := hashFiles(dir, listFiles(dir))
+		for file, hash := range hashes {
+			if len(hash) == 0 {
+				fmt.Printf("pverify: warning: %s: read failed, left out of manifest\n", file)
+				delete(hashes, file)
+			}
+		}
+
+		if err := writeManifest(manifest, hashes); err != nil {
+			fmt.Println(shortUsage(fmt.Sprintf("pverify: error: %s: write manifest failed", manifest)))
+			os.Exit(1)
+		}
+
+		fmt.Printf("pverify: %d file(s) written to %s\n", len(hashes), manifest)
+		return
+	}
+
+	expected, err := readManifest(manifest)
+	if err != nil {
+		fmt.Println(shortUsage(fmt.Sprint(err)))
+		os.Exit(1)
+	}
+
+	if !verify(expected, hashFiles(dir, listFiles(dir))) {
+		os.Exit(1)
+	}
+}